@@ -0,0 +1,12 @@
+// goext-config validates and prints go-ext configuration files, see package configcli for usage.
+package main
+
+import (
+	"os"
+
+	"github.com/fize/go-ext/config/configcli"
+)
+
+func main() {
+	os.Exit(configcli.Run(os.Args[1:], os.Stdout, os.Stderr))
+}
@@ -0,0 +1,12 @@
+// goext-migrate applies the SQL migrations of a go-ext database, see package migratecli for usage.
+package main
+
+import (
+	"os"
+
+	"github.com/fize/go-ext/storage/migrate/migratecli"
+)
+
+func main() {
+	os.Exit(migratecli.Run(os.Args[1:], os.Stdout, os.Stderr))
+}
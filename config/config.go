@@ -5,7 +5,7 @@ package config
 
 import (
 	"fmt"
-	"strings"
+	"sort"
 	"sync"
 
 	"github.com/mitchellh/mapstructure"
@@ -17,7 +17,7 @@ type Email struct {
 	Account  string `fig:"account"`
 	SMTP     string `fig:"smtp"`
 	Port     int    `fig:"port"`
-	Password string `fig:"password"`
+	Password Secret `fig:"password"`
 }
 
 var once sync.Once
@@ -41,6 +41,13 @@ type BaseConfig struct {
 	Log *LogConfig `mapstructure:"log"`
 	// custom configuration, can be any type
 	Custom any `mapstructure:"custom"`
+
+	// origins records which layer supplied every key, see Explain
+	origins []Origin
+	// secretProviders resolve secret references in addition to the registered ones
+	secretProviders map[string]SecretProvider
+	// unresolvedSecrets only checks the syntax of secret references, see WithUnresolvedSecrets
+	unresolvedSecrets bool
 }
 
 // WithCustomConfig sets the custom configuration
@@ -51,6 +58,7 @@ func WithCustomConfig(custom any) func(*BaseConfig) {
 }
 
 // ParseCustomConfig parses the custom configuration into the provided interface
+// and validates it against its validate tags, e.g. `validate:"required,min=1"`
 func (bc *BaseConfig) ParseCustomConfig(out any) error {
 	if bc.Custom == nil {
 		return nil
@@ -72,41 +80,30 @@ func (bc *BaseConfig) ParseCustomConfig(out any) error {
 		return fmt.Errorf("failed to create decoder: %v", err)
 	}
 
-	return decoder.Decode(bc.Custom)
+	if err := decoder.Decode(bc.Custom); err != nil {
+		return err
+	}
+
+	// Validate the decoded config against its validate tags
+	return Validate(out, "custom")
 }
 
 // Load loads configuration from the specified file and optionally parses custom config
 // name: configuration file path
 // env: whether to load from environment variables
+//
+// Load panics on failure and only loads once per process.
+//
+// Deprecated: use Loader, which returns errors and can be used many times.
 func (bc *BaseConfig) Load(name string, env bool) {
 	once.Do(func() {
-		v := viper.New()
-
-		// Configure Viper to preserve key case sensitivity
-		v.SetEnvPrefix("ext")
-		v.AutomaticEnv()
-		v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
-		v.AllowEmptyEnv(true)
-
+		var opts []LoaderOption
 		if !env {
-			v.SetConfigFile(name)
-			if err := v.ReadInConfig(); err != nil {
-				panic(fmt.Errorf("failed to read config file: %v", err))
-			}
-		}
-
-		// Set default values
-		bc.setDefaults(v)
-
-		// Use Viper's Unmarshal to parse the configuration
-		if err := v.Unmarshal(bc, func(dc *mapstructure.DecoderConfig) {
-			dc.TagName = "mapstructure"
-		}); err != nil {
-			panic(fmt.Errorf("failed to unmarshal config: %v", err))
+			opts = append(opts, WithFile(name))
 		}
-
-		// Initialize and validate configuration
-		if err := bc.initAndValidate(); err != nil {
+		l := NewLoader(opts...)
+		l.custom = bc.Custom
+		if err := l.loadInto(bc); err != nil {
 			panic(err)
 		}
 	})
@@ -114,15 +111,11 @@ func (bc *BaseConfig) Load(name string, env bool) {
 
 // setDefaults sets default values for the configuration
 func (bc *BaseConfig) setDefaults(v *viper.Viper) {
-	// Set default database configuration
-	v.SetDefault("sql.type", defaultSQLConfig().Type)
-	v.SetDefault("sql.host", defaultSQLConfig().Host)
-	v.SetDefault("sql.user", defaultSQLConfig().User)
-	v.SetDefault("sql.password", defaultSQLConfig().Password)
-	v.SetDefault("sql.db", defaultSQLConfig().DB)
-	v.SetDefault("sql.maxIdleConns", defaultSQLConfig().MaxIdleConns)
-	v.SetDefault("sql.maxOpenConns", defaultSQLConfig().MaxOpenConns)
-	v.SetDefault("sql.debug", defaultSQLConfig().Debug)
+	// Set default database configuration, for the sql section and every named database
+	setSQLDefaults(v, "sql")
+	for name := range v.GetStringMap("sql.databases") {
+		setSQLDefaults(v, "sql.databases."+name)
+	}
 
 	// Set default log configuration
 	v.SetDefault("log.filename", defaultLogConfig().Filename)
@@ -153,23 +146,84 @@ func (bc *BaseConfig) setDefaults(v *viper.Viper) {
 	v.SetDefault("server.trace.excludeItem", defaultServerConfig().Trace.ExcludeItem)
 }
 
+// setSQLDefaults sets default values for the database configured under key
+func setSQLDefaults(v *viper.Viper, key string) {
+	v.SetDefault(key+".type", defaultSQLConfig().Type)
+	v.SetDefault(key+".host", defaultSQLConfig().Host)
+	v.SetDefault(key+".user", defaultSQLConfig().User)
+	v.SetDefault(key+".password", defaultSQLConfig().Password)
+	v.SetDefault(key+".db", defaultSQLConfig().DB)
+	v.SetDefault(key+".maxIdleConns", defaultSQLConfig().MaxIdleConns)
+	v.SetDefault(key+".maxOpenConns", defaultSQLConfig().MaxOpenConns)
+	v.SetDefault(key+".connMaxLifetime", defaultSQLConfig().ConnMaxLifetime)
+	v.SetDefault(key+".connMaxIdleTime", defaultSQLConfig().ConnMaxIdleTime)
+	v.SetDefault(key+".connectRetries", defaultSQLConfig().ConnectRetries)
+	v.SetDefault(key+".connectBackoff", defaultSQLConfig().ConnectBackoff)
+	v.SetDefault(key+".debug", defaultSQLConfig().Debug)
+	v.SetDefault(key+".cursorSecret", defaultSQLConfig().CursorSecret)
+	v.SetDefault(key+".replicas", defaultSQLConfig().Replicas)
+	v.SetDefault(key+".replicaPolicy", defaultSQLConfig().ReplicaPolicy)
+	v.SetDefault(key+".dsn", defaultSQLConfig().DSN)
+	v.SetDefault(key+".charset", defaultSQLConfig().Charset)
+	v.SetDefault(key+".collation", defaultSQLConfig().Collation)
+	v.SetDefault(key+".loc", defaultSQLConfig().Loc)
+	v.SetDefault(key+".tls", defaultSQLConfig().TLS)
+	v.SetDefault(key+".timeout", defaultSQLConfig().Timeout)
+	v.SetDefault(key+".readTimeout", defaultSQLConfig().ReadTimeout)
+	v.SetDefault(key+".writeTimeout", defaultSQLConfig().WriteTimeout)
+	v.SetDefault(key+".sslmode", defaultSQLConfig().SSLMode)
+	v.SetDefault(key+".searchPath", defaultSQLConfig().SearchPath)
+	v.SetDefault(key+".schema", defaultSQLConfig().Schema)
+	v.SetDefault(key+".journalMode", defaultSQLConfig().JournalMode)
+	v.SetDefault(key+".busyTimeout", defaultSQLConfig().BusyTimeout)
+	v.SetDefault(key+".foreignKeys", defaultSQLConfig().ForeignKeys)
+	v.SetDefault(key+".sharedCache", defaultSQLConfig().SharedCache)
+}
+
 // initAndValidate initializes and validates the configuration
 func (bc *BaseConfig) initAndValidate() error {
-	// Validate SQL config
-	sqlCfg, err := NewSQLConfig(
-		WithType(bc.SQL.Type),
-		WithHost(bc.SQL.Host),
-		WithUser(bc.SQL.User),
-		WithPassword(bc.SQL.Password),
-		WithDB(bc.SQL.DB),
-		WithMaxIdleConns(bc.SQL.MaxIdleConns),
-		WithMaxOpenConns(bc.SQL.MaxOpenConns),
-		WithDebug(bc.SQL.Debug),
-	)
+	// Resolve secret references such as file:// and env://
+	if err := bc.resolveSecrets(); err != nil {
+		return err
+	}
+
+	// Collect the violations of all sections
+	var errs ValidationErrors
+
+	// Validate SQL config and every named database
+	sqlOpts := sqlConfigOptions(bc.SQL)
+	names := make([]string, 0, len(bc.SQL.Databases))
+	for name := range bc.SQL.Databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key := "sql.databases." + name
+		db := bc.SQL.Databases[name]
+		if db == nil {
+			db = defaultSQLConfig()
+		}
+		if name == DefaultDatabase {
+			errs = append(errs, &FieldError{Key: key, Message: "name is reserved for the sql section"})
+			continue
+		}
+		if len(db.Databases) > 0 {
+			errs = append(errs, &FieldError{Key: key + ".databases", Message: "named databases cannot be nested"})
+			continue
+		}
+		dbCfg, err := NewSQLConfig(sqlConfigOptions(db)...)
+		if err != nil {
+			errs = appendErrors(errs, key, err)
+			continue
+		}
+		sqlOpts = append(sqlOpts, WithDatabase(name, dbCfg))
+	}
+	sqlCfg, err := NewSQLConfig(sqlOpts...)
 	if err != nil {
-		return fmt.Errorf("invalid SQL config: %v", err)
+		errs = appendErrors(errs, "sql", err)
+	} else {
+		bc.SQL = sqlCfg
 	}
-	bc.SQL = sqlCfg
 
 	// Validate Log config
 	logCfg, err := NewLogConfig(
@@ -183,9 +237,10 @@ func (bc *BaseConfig) initAndValidate() error {
 		WithOutput(bc.Log.Output),
 	)
 	if err != nil {
-		return fmt.Errorf("invalid Log config: %v", err)
+		errs = appendErrors(errs, "log", err)
+	} else {
+		bc.Log = logCfg
 	}
-	bc.Log = logCfg
 
 	serCfg, err := NewServerConfig(
 		WithBindAddr(bc.Server.BindAddr),
@@ -204,9 +259,16 @@ func (bc *BaseConfig) initAndValidate() error {
 		WithTraceExcludeItem(bc.Server.Trace.ExcludeItem),
 	)
 	if err != nil {
-		return fmt.Errorf("invalid Server config: %v", err)
+		errs = appendErrors(errs, "server", err)
+	} else {
+		bc.Server = serCfg
 	}
-	bc.Server = serCfg
 
+	// Validate custom config
+	errs = appendErrors(errs, "custom", Validate(bc.Custom, ""))
+
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
@@ -32,7 +32,7 @@ func TestLoadFromEnv(t *testing.T) {
 		os.Unsetenv("EXT_SQL_HOST")
 		os.Unsetenv("EXT_SQL_USER")
 		os.Unsetenv("EXT_SQL_PASSWORD")
-		os.Unsetenv("EXT_SQL_SQL")
+		os.Unsetenv("EXT_SQL_DB")
 		os.Unsetenv("EXT_LOG_LEVEL")
 		os.Unsetenv("EXT_LOG_FORMAT")
 		os.Unsetenv("EXT_SERVER_TRACE_ENABLED")
@@ -0,0 +1,158 @@
+// configcli package implements the goext-config command, which validates and prints configurations.
+//
+// Usage:
+//
+//	goext-config schema
+//	goext-config validate [-env-prefix PREFIX] [-resolve-secrets] FILE...
+//	goext-config print [-env-prefix PREFIX] [-format yaml|json] FILE...
+//
+// Files are layered in order, e.g. base.yaml prod.yaml. Environment variables are ignored
+// unless -env-prefix is set, so the result only depends on the files.
+// validate only checks the syntax of secret references such as file:// and env://
+// unless -resolve-secrets is set, so it runs where the secrets are missing, e.g. in CI.
+// Services with a custom section build their own command with RegisterCustom and Run.
+package configcli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/fize/go-ext/config"
+	"gopkg.in/yaml.v3"
+)
+
+const usage = `usage:
+  goext-config schema                                              print the JSON Schema of the configuration
+  goext-config validate [-env-prefix PREFIX] [-resolve-secrets] FILE...  validate configuration files
+  goext-config print [-env-prefix PREFIX] [-format yaml|json] FILE...  print the resolved configuration
+`
+
+var (
+	customMu sync.RWMutex
+	// custom is the registered custom configuration type
+	custom any
+)
+
+// RegisterCustom registers the custom configuration type, e.g. &MyConfig{},
+// it is used for the schema and to decode the custom section
+func RegisterCustom(c any) {
+	customMu.Lock()
+	defer customMu.Unlock()
+	custom = c
+}
+
+func registeredCustom() any {
+	customMu.RLock()
+	defer customMu.RUnlock()
+	return custom
+}
+
+// Run runs the command with args, without the program name, and returns the exit code
+func Run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "schema":
+		err = runSchema(stdout)
+	case "validate":
+		err = runValidate(args[1:], stdout, stderr)
+	case "print":
+		err = runPrint(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %s\n%s", args[0], usage)
+		return 2
+	}
+
+	if err != nil {
+		var verrs config.ValidationErrors
+		if errors.As(err, &verrs) {
+			for _, fe := range verrs {
+				fmt.Fprintln(stderr, fe)
+			}
+		} else {
+			fmt.Fprintln(stderr, err)
+		}
+		return 1
+	}
+	return 0
+}
+
+func runSchema(stdout io.Writer) error {
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(config.JSONSchema(registeredCustom()))
+}
+
+func runValidate(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	envPrefix := fs.String("env-prefix", "", "also read environment variables with this prefix, e.g. ext")
+	resolveSecrets := fs.Bool("resolve-secrets", false, "resolve secret references instead of only checking their syntax")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var opts []config.LoaderOption
+	if !*resolveSecrets {
+		opts = append(opts, config.WithUnresolvedSecrets())
+	}
+	if _, err := load(fs.Args(), *envPrefix, opts...); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "ok")
+	return nil
+}
+
+func runPrint(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("print", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	envPrefix := fs.String("env-prefix", "", "also read environment variables with this prefix, e.g. ext")
+	format := fs.String("format", "yaml", "output format, yaml or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := load(fs.Args(), *envPrefix)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "yaml":
+		enc := yaml.NewEncoder(stdout)
+		enc.SetIndent(2)
+		if err := enc.Encode(cfg.Settings()); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "json":
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(cfg.Settings())
+	default:
+		return fmt.Errorf("unsupported format %s", *format)
+	}
+}
+
+// load loads the layered files with the real validation rules
+func load(files []string, envPrefix string, opts ...config.LoaderOption) (*config.BaseConfig, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no configuration file given")
+	}
+	return config.NewLoader(append([]config.LoaderOption{
+		config.WithFiles(files...),
+		config.WithEnvPrefix(envPrefix),
+		config.WithCustom(registeredCustom()),
+	}, opts...)...).Load()
+}
@@ -0,0 +1,127 @@
+package configcli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	valid := writeFile(t, `
+sql:
+  type: mysql
+  host: 127.0.0.1:3306
+  password: s3cret
+log:
+  level: debug
+`)
+	invalid := writeFile(t, `
+sql:
+  type: oracle
+log:
+  format: xml
+`)
+	secretRef := writeFile(t, `
+sql:
+  type: mysql
+  host: 127.0.0.1:3306
+  password: file:///configcli-test/missing
+`)
+	emptySecretRef := writeFile(t, `
+sql:
+  type: mysql
+  host: 127.0.0.1:3306
+  password: "env://"
+`)
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout []string
+		wantStderr []string
+	}{
+		{name: "no command", wantCode: 2, wantStderr: []string{"usage:"}},
+		{name: "unknown command", args: []string{"lint"}, wantCode: 2, wantStderr: []string{"unknown command lint"}},
+		{name: "schema", args: []string{"schema"}, wantStdout: []string{`"$schema"`, `"sqlite3"`}},
+		{name: "validate", args: []string{"validate", valid}, wantStdout: []string{"ok"}},
+		{
+			name:       "validate invalid",
+			args:       []string{"validate", invalid},
+			wantCode:   1,
+			wantStderr: []string{"sql.type: must be one of [mysql postgres sqlite3], got oracle", "log.format: must be one of [string json], got xml"},
+		},
+		{name: "validate unresolved secret", args: []string{"validate", secretRef}, wantStdout: []string{"ok"}},
+		{
+			name:       "validate resolved secret",
+			args:       []string{"validate", "-resolve-secrets", secretRef},
+			wantCode:   1,
+			wantStderr: []string{"sql.password: failed to resolve secret file:///configcli-test/missing"},
+		},
+		{name: "validate empty secret reference", args: []string{"validate", emptySecretRef}, wantCode: 1, wantStderr: []string{"sql.password: secret reference env:// is empty"}},
+		{name: "validate without files", args: []string{"validate"}, wantCode: 1, wantStderr: []string{"no configuration file given"}},
+		{name: "print yaml", args: []string{"print", valid}, wantStdout: []string{"type: mysql", "level: debug", "password: '******'"}},
+		{name: "print unknown format", args: []string{"print", "-format", "xml", valid}, wantCode: 1, wantStderr: []string{"unsupported format xml"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := Run(tt.args, &stdout, &stderr); code != tt.wantCode {
+				t.Fatalf("Run() = %d, want %d, stderr: %s", code, tt.wantCode, stderr.String())
+			}
+			for _, want := range tt.wantStdout {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("stdout = %s, want %s", stdout.String(), want)
+				}
+			}
+			for _, want := range tt.wantStderr {
+				if !strings.Contains(stderr.String(), want) {
+					t.Errorf("stderr = %s, want %s", stderr.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunPrintJSON(t *testing.T) {
+	path := writeFile(t, `
+sql:
+  type: mysql
+  host: 127.0.0.1:3306
+  password: s3cret
+custom:
+  region: eu
+`)
+	type customConfig struct {
+		Region string `mapstructure:"region" validate:"oneof=eu us"`
+	}
+	RegisterCustom(&customConfig{})
+	defer RegisterCustom(nil)
+
+	var stdout, stderr bytes.Buffer
+	if code := Run([]string{"print", "-format", "json", path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("Run() = %d, stderr: %s", code, stderr.String())
+	}
+	var settings map[string]map[string]any
+	if err := json.Unmarshal(stdout.Bytes(), &settings); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	if got := settings["sql"]["password"]; got != "******" {
+		t.Errorf("password = %v, want redacted", got)
+	}
+	if got := settings["custom"]["region"]; got != "eu" {
+		t.Errorf("custom.region = %v, want eu", got)
+	}
+}
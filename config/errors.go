@@ -0,0 +1,76 @@
+// This file is used to describe configuration errors
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// LoadError describes a failure while loading the configuration
+type LoadError struct {
+	// Key is the configuration key that failed, e.g. sql.type,
+	// it is empty when the failure is not tied to a key
+	Key string
+	// Source is where the failing value came from, e.g. file config.yaml or env EXT_SQL_TYPE
+	Source string
+	// Err is the underlying error
+	Err error
+}
+
+// Error implements error
+func (e *LoadError) Error() string {
+	// every violation already reports its key and source
+	var verrs ValidationErrors
+	if errors.As(e.Err, &verrs) {
+		return verrs.Error()
+	}
+	if e.Key == "" {
+		return fmt.Sprintf("%s: %v", e.Source, e.Err)
+	}
+	return fmt.Sprintf("%s (from %s): %v", e.Key, e.Source, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// errorKey returns the key of the first violation in err
+func errorKey(err error) string {
+	var verrs ValidationErrors
+	if errors.As(err, &verrs) && len(verrs) > 0 {
+		return verrs[0].Key
+	}
+	return ""
+}
+
+// appendErrors appends the violations in err to errs with their keys prefixed by section
+func appendErrors(errs ValidationErrors, section string, err error) ValidationErrors {
+	if err == nil {
+		return errs
+	}
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) {
+		return append(errs, &FieldError{Key: section, Message: err.Error()})
+	}
+	for _, fe := range verrs {
+		key := section
+		if fe.Key != "" {
+			key = section + "." + fe.Key
+		}
+		errs = append(errs, &FieldError{Key: key, Rule: fe.Rule, Message: fe.Message, Source: fe.Source})
+	}
+	return errs
+}
+
+// decodeKeyPattern matches the key quoted in mapstructure errors, e.g. 'sql.maxIdleConns' expected type 'int'
+var decodeKeyPattern = regexp.MustCompile(`'([^']+)'`)
+
+// decodeErrorKey returns the key reported by a mapstructure decode error
+func decodeErrorKey(err error) string {
+	if m := decodeKeyPattern.FindStringSubmatch(err.Error()); m != nil {
+		return m[1]
+	}
+	return ""
+}
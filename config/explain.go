@@ -0,0 +1,107 @@
+// This file is used to report where every configuration value came from
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Layer is a configuration source, later layers take precedence over earlier ones
+type Layer string
+
+// Configuration layers in order of precedence
+const (
+	LayerDefault Layer = "default"
+	LayerFile    Layer = "file"
+	LayerEnv     Layer = "env"
+	LayerFlag    Layer = "flag"
+)
+
+// Origin records which layer supplied the value of a configuration key
+type Origin struct {
+	// Key is the configuration key, e.g. sql.maxIdleConns
+	Key string
+	// Layer is the layer that supplied the value
+	Layer Layer
+	// Source is the file path, environment variable or flag that supplied the value,
+	// built-in or loader for defaults
+	Source string
+}
+
+// String returns the origin in the form key: layer source
+func (o Origin) String() string {
+	return fmt.Sprintf("%s: %s", o.Key, o.describe())
+}
+
+// describe returns the layer and source, e.g. file prod.yaml or env EXT_SQL_TYPE
+func (o Origin) describe() string {
+	return fmt.Sprintf("%s %s", o.Layer, o.Source)
+}
+
+// Explain reports, for every resolved key, which layer supplied its value.
+// It is empty for configurations that were not loaded by a Loader.
+func (bc *BaseConfig) Explain() []Origin {
+	return bc.origins
+}
+
+// explain builds the origin of every key sorted by key
+func (l *Loader) explain(bc *BaseConfig, keys []string, origin func(key string) Origin) []Origin {
+	origins := make([]Origin, 0, len(keys))
+	for _, key := range keys {
+		if rest, ok := strings.CutPrefix(key, "custom."); ok && bc.Custom != nil {
+			key = "custom." + canonicalKey(reflect.TypeOf(bc.Custom), rest)
+		} else {
+			key = canonicalKey(reflect.TypeOf(bc), key)
+		}
+		origins = append(origins, origin(key))
+	}
+	sort.Slice(origins, func(i, j int) bool {
+		return origins[i].Key < origins[j].Key
+	})
+	return origins
+}
+
+// canonicalKey maps a lower-cased key used by viper to the key declared by mapstructure tags,
+// e.g. sql.maxidleconns to sql.maxIdleConns. Map keys such as database names are kept as they are.
+func canonicalKey(t reflect.Type, key string) string {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Map:
+			t = t.Elem()
+		case reflect.Struct:
+			field, name, ok := fieldByKey(t, part)
+			if !ok {
+				return strings.Join(parts, ".")
+			}
+			parts[i] = name
+			t = field.Type
+		default:
+			return strings.Join(parts, ".")
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// fieldByKey returns the field of struct t whose mapstructure name matches key ignoring case
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, string, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		if strings.EqualFold(name, key) {
+			return field, name, true
+		}
+	}
+	return reflect.StructField{}, "", false
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestLoaderLayers(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	prod := filepath.Join(dir, "prod.yaml")
+	if err := os.WriteFile(base, []byte(`
+sql:
+  type: mysql
+  host: base:3306
+  maxIdleConns: 5
+log:
+  level: warn
+  format: json
+server:
+  bindAddr: 127.0.0.1:8080
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(prod, []byte(`
+sql:
+  host: prod:3306
+log:
+  level: error
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LAYERTEST_LOG_LEVEL", "info")
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.String("server.bindAddr", "", "server bind address")
+	flags.String("log.format", "", "log format")
+	if err := flags.Parse([]string{"--server.bindAddr=127.0.0.1:9090"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := NewLoader(
+		WithFiles(base, prod),
+		WithEnvPrefix("layertest"),
+		WithFlags(flags),
+		WithDefaults(map[string]any{"sql.db": "app"}),
+	).Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		key    string
+		got    any
+		want   any
+		layer  Layer
+		source string
+	}{
+		{"sql.type", cfg.SQL.Type, "mysql", LayerFile, base},
+		{"sql.host", cfg.SQL.Host, "prod:3306", LayerFile, prod},
+		{"sql.maxIdleConns", cfg.SQL.MaxIdleConns, 5, LayerFile, base},
+		{"sql.db", cfg.SQL.DB, "app", LayerDefault, "loader"},
+		{"sql.maxOpenConns", cfg.SQL.MaxOpenConns, 0, LayerDefault, "built-in"},
+		{"log.level", cfg.Log.Level, "info", LayerEnv, "LAYERTEST_LOG_LEVEL"},
+		{"log.format", cfg.Log.Format, "json", LayerFile, base},
+		{"server.bindAddr", cfg.Server.BindAddr, "127.0.0.1:9090", LayerFlag, "--server.bindAddr"},
+	}
+
+	origins := make(map[string]Origin)
+	for _, o := range cfg.Explain() {
+		origins[o.Key] = o
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("%s = %v, want %v", tt.key, tt.got, tt.want)
+			}
+			o, ok := origins[tt.key]
+			if !ok {
+				t.Fatalf("Explain() has no origin for %s", tt.key)
+			}
+			if o.Layer != tt.layer || o.Source != tt.source {
+				t.Errorf("origin of %s = %s, want %s %s", tt.key, o.describe(), tt.layer, tt.source)
+			}
+		})
+	}
+}
+
+func TestOriginString(t *testing.T) {
+	o := Origin{Key: "sql.type", Layer: LayerEnv, Source: "EXT_SQL_TYPE"}
+	if got, want := o.String(), "sql.type: env EXT_SQL_TYPE"; got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+}
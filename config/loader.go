@@ -0,0 +1,229 @@
+// This file is used to load the configuration
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// default environment variable prefix, e.g. EXT_SQL_TYPE
+const _defaultEnvPrefix = "ext"
+
+// Loader loads a BaseConfig from layered sources, later layers take precedence:
+// built-in and loader defaults, configuration files in the given order,
+// environment variables and command-line flags.
+// Every Loader is independent of the others, so many configurations can be loaded in one process.
+type Loader struct {
+	// configuration file paths, later files override earlier ones
+	files []string
+	// environment variable prefix, empty disables environment variables
+	envPrefix string
+	// command-line flags named after configuration keys, e.g. --log.level
+	flags *pflag.FlagSet
+	// default values, keyed by configuration key such as sql.type
+	defaults map[string]any
+	// custom configuration, its type decides the type of BaseConfig.Custom
+	custom any
+	// secret providers of this loader, keyed by scheme
+	secretProviders map[string]SecretProvider
+	// only check the syntax of secret references instead of resolving them
+	unresolvedSecrets bool
+}
+
+// LoaderOption is used to configure the loader
+type LoaderOption func(*Loader)
+
+// NewLoader creates a new Loader with the given options
+func NewLoader(opts ...LoaderOption) *Loader {
+	l := &Loader{
+		envPrefix: _defaultEnvPrefix,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// WithFile adds a configuration file, yaml, json and toml are supported.
+// It can be used many times, e.g. base.yaml followed by an overlay such as prod.yaml.
+func WithFile(path string) LoaderOption {
+	return func(l *Loader) {
+		l.files = append(l.files, path)
+	}
+}
+
+// WithFiles adds configuration files, later files override earlier ones
+func WithFiles(paths ...string) LoaderOption {
+	return func(l *Loader) {
+		l.files = append(l.files, paths...)
+	}
+}
+
+// WithEnvPrefix sets the environment variable prefix, an empty prefix disables environment variables
+func WithEnvPrefix(prefix string) LoaderOption {
+	return func(l *Loader) {
+		l.envPrefix = prefix
+	}
+}
+
+// WithFlags sets the command-line flags, flags are named after configuration keys,
+// e.g. --log.level. Only flags set on the command line override other layers.
+func WithFlags(flags *pflag.FlagSet) LoaderOption {
+	return func(l *Loader) {
+		l.flags = flags
+	}
+}
+
+// WithDefaults sets default values keyed by configuration key, e.g. {"sql.type": "mysql"}.
+// They take precedence over the built-in defaults.
+func WithDefaults(defaults map[string]any) LoaderOption {
+	return func(l *Loader) {
+		l.defaults = defaults
+	}
+}
+
+// WithCustom sets the custom configuration type, custom must be a pointer, e.g. &MyConfig{}.
+// Every loaded BaseConfig gets its own value of this type.
+func WithCustom(custom any) LoaderOption {
+	return func(l *Loader) {
+		l.custom = custom
+	}
+}
+
+// Load loads and validates a new configuration
+func (l *Loader) Load() (*BaseConfig, error) {
+	bc := NewConfig()
+	bc.Custom = newCustom(l.custom)
+	if err := l.loadInto(bc); err != nil {
+		return nil, err
+	}
+	return bc, nil
+}
+
+// loadInto loads and validates the configuration into bc
+func (l *Loader) loadInto(bc *BaseConfig) error {
+	v := viper.New()
+	if l.envPrefix != "" {
+		v.SetEnvPrefix(l.envPrefix)
+		v.AutomaticEnv()
+		v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+		v.AllowEmptyEnv(true)
+	}
+
+	// Merge the files in order, remembering which keys every file supplies
+	fileKeys := make([]map[string]bool, len(l.files))
+	for i, file := range l.files {
+		fv := viper.New()
+		fv.SetConfigFile(file)
+		if err := fv.ReadInConfig(); err != nil {
+			return &LoadError{Source: "file " + file, Err: fmt.Errorf("failed to read config file: %v", err)}
+		}
+		if err := v.MergeConfigMap(fv.AllSettings()); err != nil {
+			return &LoadError{Source: "file " + file, Err: fmt.Errorf("failed to merge config file: %v", err)}
+		}
+		fileKeys[i] = make(map[string]bool)
+		for _, key := range fv.AllKeys() {
+			fileKeys[i][key] = true
+		}
+	}
+
+	if l.flags != nil {
+		if err := v.BindPFlags(l.flags); err != nil {
+			return &LoadError{Source: "flags", Err: fmt.Errorf("failed to bind flags: %v", err)}
+		}
+	}
+
+	// Set default values
+	bc.setDefaults(v)
+	for key, value := range l.defaults {
+		v.SetDefault(key, value)
+	}
+
+	origin := func(key string) Origin {
+		return l.origin(key, fileKeys)
+	}
+
+	// Use Viper's Unmarshal to parse the configuration
+	if err := v.Unmarshal(bc, func(dc *mapstructure.DecoderConfig) {
+		dc.TagName = "mapstructure"
+	}); err != nil {
+		key := decodeErrorKey(err)
+		return &LoadError{Key: key, Source: origin(key).describe(), Err: fmt.Errorf("failed to unmarshal config: %v", err)}
+	}
+
+	// Initialize and validate configuration
+	bc.secretProviders = l.secretProviders
+	bc.unresolvedSecrets = l.unresolvedSecrets
+	if err := bc.initAndValidate(); err != nil {
+		var verrs ValidationErrors
+		if errors.As(err, &verrs) {
+			for _, fe := range verrs {
+				fe.Source = origin(fe.Key).describe()
+			}
+		}
+		key := errorKey(err)
+		return &LoadError{Key: key, Source: origin(key).describe(), Err: err}
+	}
+
+	bc.origins = l.explain(bc, v.AllKeys(), origin)
+	return nil
+}
+
+// origin reports which layer supplied the value of key
+func (l *Loader) origin(key string, fileKeys []map[string]bool) Origin {
+	lower := strings.ToLower(key)
+	if l.flags != nil && key != "" {
+		if f := l.lookupFlag(lower); f != nil && f.Changed {
+			return Origin{Key: key, Layer: LayerFlag, Source: "--" + f.Name}
+		}
+	}
+	if l.envPrefix != "" && key != "" {
+		name := l.envName(key)
+		if _, ok := os.LookupEnv(name); ok {
+			return Origin{Key: key, Layer: LayerEnv, Source: name}
+		}
+	}
+	for i := len(l.files) - 1; i >= 0; i-- {
+		if key == "" || fileKeys[i][lower] || hasPrefixKey(fileKeys[i], lower) {
+			return Origin{Key: key, Layer: LayerFile, Source: l.files[i]}
+		}
+	}
+	for k := range l.defaults {
+		if strings.ToLower(k) == lower {
+			return Origin{Key: key, Layer: LayerDefault, Source: "loader"}
+		}
+	}
+	return Origin{Key: key, Layer: LayerDefault, Source: "built-in"}
+}
+
+// lookupFlag returns the flag named after key, ignoring case like viper does
+func (l *Loader) lookupFlag(key string) *pflag.Flag {
+	var found *pflag.Flag
+	l.flags.VisitAll(func(f *pflag.Flag) {
+		if strings.ToLower(f.Name) == key {
+			found = f
+		}
+	})
+	return found
+}
+
+// envName returns the environment variable name of key, e.g. EXT_SQL_TYPE
+func (l *Loader) envName(key string) string {
+	return strings.ToUpper(l.envPrefix + "_" + strings.ReplaceAll(key, ".", "_"))
+}
+
+// hasPrefixKey reports whether keys contains a key nested under section, e.g. sql.type under sql
+func hasPrefixKey(keys map[string]bool, section string) bool {
+	for key := range keys {
+		if strings.HasPrefix(key, section+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoaderLoad(t *testing.T) {
+	cfg, err := NewLoader(WithFile("testdata/config.yaml")).Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		got      any
+		expected any
+	}{
+		{"SQL.Type", cfg.SQL.Type, "sqlite3"},
+		{"SQL.DB", cfg.SQL.DB, "./test.db"},
+		{"Log.Filename", cfg.Log.Filename, "./test.log"},
+		{"Server.BindAddr", cfg.Server.BindAddr, "localhost:8080"},
+		{"Server.Metrics.ServiceName", cfg.Server.Metrics.ServiceName, "test_service"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.expected {
+				t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoaderParallel(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 8; i++ {
+		i := i
+		path := filepath.Join(dir, fmt.Sprintf("config%d.yaml", i))
+		content := fmt.Sprintf("sql:\n  db: ./db%d.db\n", i)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		t.Run(path, func(t *testing.T) {
+			t.Parallel()
+			cfg, err := NewLoader(WithFile(path), WithEnvPrefix("")).Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if want := fmt.Sprintf("./db%d.db", i); cfg.SQL.DB != want {
+				t.Errorf("SQL.DB = %s, want %s", cfg.SQL.DB, want)
+			}
+		})
+	}
+}
+
+func TestLoaderDefaultsAndCustom(t *testing.T) {
+	l := NewLoader(
+		WithFile("testdata/config_with_custom.yaml"),
+		WithDefaults(map[string]any{"server.bindAddr": "127.0.0.1:9000"}),
+		WithCustom(&CustomConfig{}),
+	)
+	first, err := l.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	second, err := l.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if first.Server.BindAddr != "127.0.0.1:9000" {
+		t.Errorf("Server.BindAddr = %s, want 127.0.0.1:9000", first.Server.BindAddr)
+	}
+	custom, ok := first.Custom.(*CustomConfig)
+	if !ok {
+		t.Fatalf("Custom = %T, want *CustomConfig", first.Custom)
+	}
+	if custom.ServerName != "test-server" {
+		t.Errorf("ServerName = %s, want test-server", custom.ServerName)
+	}
+	if first.Custom == second.Custom {
+		t.Error("loads must not share the custom configuration")
+	}
+}
+
+func TestLoaderErrors(t *testing.T) {
+	dir := t.TempDir()
+	invalidType := filepath.Join(dir, "invalid_type.yaml")
+	if err := os.WriteFile(invalidType, []byte("sql:\n  type: oracle\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	invalidSize := filepath.Join(dir, "invalid_size.yaml")
+	if err := os.WriteFile(invalidSize, []byte("log:\n  maxSize: big\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		opts       []LoaderOption
+		env        map[string]string
+		wantKey    string
+		wantSource string
+	}{
+		{
+			name:       "missing file",
+			opts:       []LoaderOption{WithFile(filepath.Join(dir, "missing.yaml"))},
+			wantKey:    "",
+			wantSource: "file " + filepath.Join(dir, "missing.yaml"),
+		},
+		{
+			name:       "invalid value in file",
+			opts:       []LoaderOption{WithFile(invalidType)},
+			wantKey:    "sql.type",
+			wantSource: "file " + invalidType,
+		},
+		{
+			name:       "invalid value type in file",
+			opts:       []LoaderOption{WithFile(invalidSize)},
+			wantKey:    "log.maxSize",
+			wantSource: "file " + invalidSize,
+		},
+		{
+			name:       "invalid value in env",
+			opts:       []LoaderOption{WithEnvPrefix("loadertest")},
+			env:        map[string]string{"LOADERTEST_SERVER_BINDADDR": "invalid:addr:8080"},
+			wantKey:    "server.bindAddr",
+			wantSource: "env LOADERTEST_SERVER_BINDADDR",
+		},
+		{
+			name:       "invalid loader default",
+			opts:       []LoaderOption{WithDefaults(map[string]any{"log.format": "xml"})},
+			wantKey:    "log.format",
+			wantSource: "default loader",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			_, err := NewLoader(tt.opts...).Load()
+			var le *LoadError
+			if !errors.As(err, &le) {
+				t.Fatalf("Load() error = %v, want *LoadError", err)
+			}
+			if le.Key != tt.wantKey {
+				t.Errorf("Key = %s, want %s", le.Key, tt.wantKey)
+			}
+			if le.Source != tt.wantSource {
+				t.Errorf("Source = %s, want %s", le.Source, tt.wantSource)
+			}
+			if !strings.Contains(le.Error(), tt.wantSource) {
+				t.Errorf("Error() = %s, want it to contain %s", le.Error(), tt.wantSource)
+			}
+		})
+	}
+}
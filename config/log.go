@@ -108,9 +108,9 @@ type LogConfig struct {
 	// log file compress
 	Compress bool `mapstructure:"compress"`
 	// log level, debug, info, warn, error, fatal
-	Level string `mapstructure:"level"`
+	Level string `mapstructure:"level" validate:"oneof=debug info warn error fatal"`
 	// log format, only support string and json
-	Format string `mapstructure:"format"`
+	Format string `mapstructure:"format" validate:"oneof=string json"`
 	// log output, only support stdout and file
 	Output string `mapstructure:"output"`
 }
@@ -138,26 +138,22 @@ func NewLogConfig(opts ...LogConfigConfigOption) (*LogConfig, error) {
 		opt(cfg)
 	}
 
-	// Validate log format
-	if cfg.Format != stringFormat && cfg.Format != jsonFormat {
-		return nil, fmt.Errorf("invalid log format: %s", cfg.Format)
-	}
-
-	// Validate log level
+	// Convert numeric log level to its name
 	if _, err := getLevelNum(cfg.Level); err != nil {
-		// Try to parse as number
 		levelNum := -1
 		if _, err := fmt.Sscanf(cfg.Level, "%d", &levelNum); err == nil {
 			levelStr, err := getLevelString(levelNum)
 			if err != nil {
-				return nil, err
+				return nil, ValidationErrors{{Key: "level", Rule: "oneof", Message: err.Error()}}
 			}
 			cfg.Level = levelStr
-		} else {
-			return nil, fmt.Errorf("invalid log level: %s", cfg.Level)
 		}
 	}
 
+	if err := Validate(cfg, ""); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
 
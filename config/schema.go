@@ -0,0 +1,181 @@
+// This file is used to describe the configuration with JSON Schema
+package config
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// _schemaDraft is the JSON Schema dialect of the generated schema
+const _schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+var (
+	secretType   = reflect.TypeOf(Secret(""))
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// JSONSchema returns the JSON Schema of BaseConfig, built from the mapstructure and validate tags.
+// Built-in defaults are reported as default values.
+// custom describes the custom section, e.g. &MyConfig{}, nil allows any custom section.
+func JSONSchema(custom any) map[string]any {
+	def := NewConfig()
+	schema := schemaFor(reflect.TypeOf(def), reflect.ValueOf(def), nil)
+	props := schema["properties"].(map[string]any)
+	if custom != nil {
+		props["custom"] = schemaFor(reflect.TypeOf(custom), reflect.Value{}, nil)
+	} else {
+		props["custom"] = map[string]any{}
+	}
+	schema["$schema"] = _schemaDraft
+	schema["title"] = "BaseConfig"
+	return schema
+}
+
+// schemaFor returns the schema of t, def holds the default value if it is valid.
+// parents counts the structs being described, a struct nested in itself is described once more,
+// e.g. the named databases of SQLConfig, and any deeper level as any object.
+func schemaFor(t reflect.Type, def reflect.Value, parents map[reflect.Type]int) map[string]any {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		if def.IsValid() {
+			if def.IsNil() {
+				def = reflect.Value{}
+			} else {
+				def = def.Elem()
+			}
+		}
+	}
+
+	schema := make(map[string]any)
+	switch {
+	case t == secretType:
+		schema["type"] = "string"
+		schema["writeOnly"] = true
+		return schema
+	case t == durationType:
+		schema["type"] = []string{"string", "integer"}
+		schema["description"] = "duration such as 5s or 1m30s"
+		if def.IsValid() && !def.IsZero() {
+			schema["default"] = time.Duration(def.Int()).String()
+		}
+		return schema
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		schema["type"] = "object"
+		if parents[t] > 1 {
+			return schema
+		}
+		nested := make(map[reflect.Type]int, len(parents)+1)
+		for p, n := range parents {
+			nested[p] = n
+		}
+		nested[t]++
+		props := make(map[string]any)
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+			if name == "" {
+				name = field.Name
+			}
+			var fieldDef reflect.Value
+			if def.IsValid() {
+				fieldDef = def.Field(i)
+			}
+			if field.Type.Kind() == reflect.Interface {
+				props[name] = map[string]any{}
+				continue
+			}
+			prop := schemaFor(field.Type, fieldDef, nested)
+			if applyRules(prop, field.Tag.Get("validate")) {
+				required = append(required, name)
+			}
+			props[name] = prop
+		}
+		schema["properties"] = props
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	case reflect.Map:
+		schema["type"] = "object"
+		schema["additionalProperties"] = schemaFor(t.Elem(), reflect.Value{}, parents)
+	case reflect.Slice, reflect.Array:
+		schema["type"] = "array"
+		schema["items"] = schemaFor(t.Elem(), reflect.Value{}, parents)
+	case reflect.String:
+		schema["type"] = "string"
+	case reflect.Bool:
+		schema["type"] = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema["type"] = "integer"
+	case reflect.Float32, reflect.Float64:
+		schema["type"] = "number"
+	}
+	if def.IsValid() && !def.IsZero() && def.CanInterface() {
+		schema["default"] = def.Interface()
+	}
+	return schema
+}
+
+// applyRules translates validate rules into schema keywords and reports whether the field is required
+func applyRules(schema map[string]any, tag string) bool {
+	required := false
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "skip_unless":
+			// the remaining rules are conditional, a schema cannot express them
+			return required
+		case "oneof":
+			var enum []any
+			for _, v := range strings.Fields(param) {
+				if schema["type"] == "integer" {
+					if n, err := strconv.Atoi(v); err == nil {
+						enum = append(enum, n)
+						continue
+					}
+				}
+				enum = append(enum, v)
+			}
+			schema["enum"] = enum
+		case "min", "max":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			schema[boundKeyword(schema["type"], name)] = n
+		}
+	}
+	return required
+}
+
+// boundKeyword returns the keyword of a min or max rule for a schema type
+func boundKeyword(typ any, rule string) string {
+	prefix := "min"
+	if rule == "max" {
+		prefix = "max"
+	}
+	switch typ {
+	case "string":
+		return prefix + "Length"
+	case "array":
+		return prefix + "Items"
+	case "object":
+		return prefix + "Properties"
+	}
+	if prefix == "min" {
+		return "minimum"
+	}
+	return "maximum"
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TimeoutConfig is a custom configuration with a duration
+type TimeoutConfig struct {
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+func TestJSONSchema(t *testing.T) {
+	schema := JSONSchema(&ValidatedCustomConfig{})
+	if schema["$schema"] != _schemaDraft {
+		t.Errorf("$schema = %v, want %s", schema["$schema"], _schemaDraft)
+	}
+	if _, err := json.Marshal(schema); err != nil {
+		t.Fatalf("schema is not JSON: %v", err)
+	}
+
+	prop := func(path ...string) map[string]any {
+		t.Helper()
+		cur := schema
+		for _, p := range path {
+			props, ok := cur["properties"].(map[string]any)
+			if !ok {
+				t.Fatalf("%v has no properties", path)
+			}
+			if cur, ok = props[p].(map[string]any); !ok {
+				t.Fatalf("missing property %v", path)
+			}
+		}
+		return cur
+	}
+
+	tests := []struct {
+		name    string
+		path    []string
+		keyword string
+		want    any
+	}{
+		{name: "enum", path: []string{"sql", "type"}, keyword: "enum", want: []any{"mysql", "postgres", "sqlite3"}},
+		{name: "default", path: []string{"log", "level"}, keyword: "default", want: "info"},
+		{name: "integer default", path: []string{"log", "maxSize"}, keyword: "default", want: 10},
+		{name: "secret", path: []string{"sql", "password"}, keyword: "writeOnly", want: true},
+		{name: "custom required", path: []string{"custom", "queue"}, keyword: "required", want: []string{"name"}},
+		{name: "custom minimum", path: []string{"custom", "queue", "workers"}, keyword: "minimum", want: float64(1)},
+		{name: "custom maximum", path: []string{"custom", "queue", "workers"}, keyword: "maximum", want: float64(64)},
+		{name: "custom minItems", path: []string{"custom", "tags"}, keyword: "minItems", want: float64(1)},
+		{name: "array items", path: []string{"server", "metrics", "excludeItem"}, keyword: "type", want: "array"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prop(tt.path...)[tt.keyword]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%v %s = %#v, want %#v", tt.path, tt.keyword, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONSchemaWithoutCustom(t *testing.T) {
+	props := JSONSchema(nil)["properties"].(map[string]any)
+	if custom := props["custom"].(map[string]any); len(custom) != 0 {
+		t.Errorf("custom = %v, want any value", custom)
+	}
+}
+
+func TestJSONSchemaDuration(t *testing.T) {
+	props := JSONSchema(&TimeoutConfig{})["properties"].(map[string]any)
+	custom := props["custom"].(map[string]any)["properties"].(map[string]any)
+	if got := custom["timeout"].(map[string]any)["type"]; !reflect.DeepEqual(got, []string{"string", "integer"}) {
+		t.Errorf("timeout type = %v, want string or integer", got)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	cfg := NewConfig()
+	cfg.SQL.Password = "s3cret"
+
+	settings := cfg.Settings()
+	sql := settings["sql"].(map[string]any)
+	if sql["password"] != redacted {
+		t.Errorf("password = %v, want redacted", sql["password"])
+	}
+	if sql["type"] != "sqlite3" {
+		t.Errorf("type = %v, want sqlite3", sql["type"])
+	}
+	if _, ok := settings["log"].(map[string]any)["level"]; !ok {
+		t.Error("log.level is missing")
+	}
+
+	cfg.Custom = &TimeoutConfig{Timeout: 90 * time.Second}
+	if got := cfg.Settings()["custom"].(map[string]any)["timeout"]; got != "1m30s" {
+		t.Errorf("custom.timeout = %v, want 1m30s", got)
+	}
+}
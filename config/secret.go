@@ -0,0 +1,195 @@
+// This file is used to resolve and redact secrets in the configuration
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// redacted replaces secrets in formatted output
+const redacted = "******"
+
+// Secret is a credential in the configuration, e.g. a database password.
+// Its value never shows up in formatted output, logs or JSON, use Value to read it.
+// A secret can reference its value with a registered scheme such as
+// file:///run/secrets/db_pw or env://DB_PASSWORD, which is resolved while loading.
+type Secret string
+
+// Value returns the secret value
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String implements fmt.Stringer and redacts the secret
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString implements fmt.GoStringer and redacts the secret
+func (s Secret) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+// MarshalJSON implements json.Marshaler and redacts the secret
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// SecretProvider resolves secret references of one scheme, e.g. a Vault backend
+type SecretProvider interface {
+	// Resolve returns the secret referenced by ref, ref is the part after scheme://
+	Resolve(ref string) (string, error)
+}
+
+// SecretProviderFunc is a function that implements SecretProvider
+type SecretProviderFunc func(ref string) (string, error)
+
+// Resolve implements SecretProvider
+func (f SecretProviderFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+var (
+	secretProvidersMu sync.RWMutex
+	// secretProviders are the providers known to every Loader, keyed by scheme
+	secretProviders = map[string]SecretProvider{
+		"file": SecretProviderFunc(resolveFileSecret),
+		"env":  SecretProviderFunc(resolveEnvSecret),
+	}
+)
+
+// RegisterSecretProvider registers p for references with the given scheme for every Loader
+func RegisterSecretProvider(scheme string, p SecretProvider) {
+	secretProvidersMu.Lock()
+	defer secretProvidersMu.Unlock()
+	secretProviders[scheme] = p
+}
+
+// WithSecretProvider sets the provider for references with the given scheme for this loader only,
+// it takes precedence over providers registered with RegisterSecretProvider
+func WithSecretProvider(scheme string, p SecretProvider) LoaderOption {
+	return func(l *Loader) {
+		if l.secretProviders == nil {
+			l.secretProviders = make(map[string]SecretProvider)
+		}
+		l.secretProviders[scheme] = p
+	}
+}
+
+// WithUnresolvedSecrets only checks that secret references name a known scheme and a reference,
+// they are left unresolved, e.g. to validate a configuration in CI without the secret files or variables
+func WithUnresolvedSecrets() LoaderOption {
+	return func(l *Loader) {
+		l.unresolvedSecrets = true
+	}
+}
+
+// resolveFileSecret reads the secret from a file, e.g. a mounted Kubernetes secret
+func resolveFileSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %v", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// resolveEnvSecret reads the secret from an environment variable
+func resolveEnvSecret(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// secretProvider returns the provider for scheme
+func (bc *BaseConfig) secretProvider(scheme string) (SecretProvider, bool) {
+	if p, ok := bc.secretProviders[scheme]; ok {
+		return p, true
+	}
+	secretProvidersMu.RLock()
+	defer secretProvidersMu.RUnlock()
+	p, ok := secretProviders[scheme]
+	return p, ok
+}
+
+// resolveSecrets replaces every secret reference in the configuration with its value
+func (bc *BaseConfig) resolveSecrets() error {
+	if fe := bc.resolveValue(reflect.ValueOf(bc).Elem(), ""); fe != nil {
+		return ValidationErrors{fe}
+	}
+	return nil
+}
+
+// resolveValue walks v and resolves the secrets it contains, key is the configuration key of v
+func (bc *BaseConfig) resolveValue(v reflect.Value, key string) *FieldError {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return bc.resolveValue(v.Elem(), key)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+			if name == "" {
+				name = field.Name
+			}
+			if key != "" {
+				name = key + "." + name
+			}
+			if fe := bc.resolveValue(v.Field(i), name); fe != nil {
+				return fe
+			}
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			if fe := bc.resolveValue(v.MapIndex(k), fmt.Sprintf("%s.%v", key, k.Interface())); fe != nil {
+				return fe
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if fe := bc.resolveValue(v.Index(i), fmt.Sprintf("%s[%d]", key, i)); fe != nil {
+				return fe
+			}
+		}
+	case reflect.String:
+		if v.Type() != reflect.TypeOf(Secret("")) || !v.CanSet() {
+			return nil
+		}
+		scheme, ref, ok := strings.Cut(v.String(), "://")
+		if !ok {
+			return nil
+		}
+		p, ok := bc.secretProvider(scheme)
+		if !ok {
+			// not a reference, e.g. a password that happens to contain ://
+			return nil
+		}
+		if bc.unresolvedSecrets {
+			if ref == "" {
+				return &FieldError{Key: key, Rule: "secret", Message: fmt.Sprintf("secret reference %s:// is empty", scheme)}
+			}
+			return nil
+		}
+		value, err := p.Resolve(ref)
+		if err != nil {
+			return &FieldError{Key: key, Rule: "secret", Message: fmt.Sprintf("failed to resolve secret %s://%s: %v", scheme, ref, err)}
+		}
+		v.SetString(value)
+	}
+	return nil
+}
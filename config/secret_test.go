@@ -0,0 +1,138 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeVault is a local stand-in for a Vault-style secret backend
+type fakeVault map[string]string
+
+func (f fakeVault) Resolve(ref string) (string, error) {
+	value, ok := f[ref]
+	if !ok {
+		return "", fmt.Errorf("secret %s not found", ref)
+	}
+	return value, nil
+}
+
+// SecretCustomConfig is a custom configuration with a credential
+type SecretCustomConfig struct {
+	Mail *Email `mapstructure:"mail"`
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "db_pw")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SECRETTEST_MAIL_PASSWORD", "from-env")
+
+	tests := []struct {
+		name     string
+		password string
+		want     string
+	}{
+		{"file reference", "file://" + secretFile, "from-file"},
+		{"env reference", "env://SECRETTEST_MAIL_PASSWORD", "from-env"},
+		{"provider reference", "vault://db/password", "from-vault"},
+		{"plain value", "plain", "plain"},
+		{"unknown scheme", "unknown://value", "unknown://value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			content := fmt.Sprintf("sql:\n  password: %q\ncustom:\n  mail:\n    password: %q\n", tt.password, tt.password)
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := NewLoader(
+				WithFile(path),
+				WithEnvPrefix(""),
+				WithCustom(&SecretCustomConfig{}),
+				WithSecretProvider("vault", fakeVault{"db/password": "from-vault"}),
+			).Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got := cfg.SQL.Password.Value(); got != tt.want {
+				t.Errorf("SQL.Password = %s, want %s", got, tt.want)
+			}
+			custom := cfg.Custom.(*SecretCustomConfig)
+			if got := custom.Mail.Password.Value(); got != tt.want {
+				t.Errorf("Mail.Password = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSecretsError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("sql:\n  password: env://SECRETTEST_MISSING\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewLoader(WithFile(path)).Load()
+	var le *LoadError
+	if !errors.As(err, &le) {
+		t.Fatalf("Load() error = %v, want *LoadError", err)
+	}
+	if le.Key != "sql.password" {
+		t.Errorf("Key = %s, want sql.password", le.Key)
+	}
+}
+
+func TestRegisterSecretProvider(t *testing.T) {
+	RegisterSecretProvider("registered", SecretProviderFunc(func(ref string) (string, error) {
+		return "registered-" + ref, nil
+	}))
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("sql:\n  password: registered://pw\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := NewLoader(WithFile(path)).Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.SQL.Password.Value(); got != "registered-pw" {
+		t.Errorf("SQL.Password = %s, want registered-pw", got)
+	}
+}
+
+func TestSecretRedaction(t *testing.T) {
+	cfg := &SQLConfig{User: "root", Password: "s3cr3t"}
+
+	outputs := []string{
+		fmt.Sprintf("%v", cfg),
+		fmt.Sprintf("%+v", *cfg),
+		fmt.Sprintf("%#v", *cfg),
+		fmt.Sprintf("%s", cfg.Password),
+		fmt.Sprint(cfg.Password),
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs = append(outputs, string(data))
+
+	for _, out := range outputs {
+		if strings.Contains(out, "s3cr3t") {
+			t.Errorf("secret leaked in %s", out)
+		}
+	}
+	if cfg.Password.Value() != "s3cr3t" {
+		t.Errorf("Value() = %s, want s3cr3t", cfg.Password.Value())
+	}
+	if Secret("").String() != "" {
+		t.Error("empty secret must format as empty")
+	}
+}
@@ -15,7 +15,7 @@ const (
 // Metrics defines the metrics configuration options
 type Metrics struct {
 	Enabled     bool   `mapstructure:"enabled"`
-	ServiceName string `mapstructure:"serviceName"`
+	ServiceName string `mapstructure:"serviceName" validate:"skip_unless=Enabled true,required,metricname"`
 	Path        string `mapstructure:"path"`
 	Port        int    `mapstructure:"port"`
 	// TimeSensitive is a flag to enable time sensitive metrics buckets
@@ -40,7 +40,7 @@ type Trace struct {
 // ServerConfig defines the server configuration options
 type ServerConfig struct {
 	// Server bind address, e.g. 0.0.0.0:8080
-	BindAddr string `mapstructure:"bindAddr"`
+	BindAddr string `mapstructure:"bindAddr" validate:"hostport"`
 	// Metrics
 	Metrics *Metrics `mapstructure:"metrics"`
 	// Trace
@@ -73,18 +73,10 @@ func NewServerConfig(opts ...ServerConfigOption) (*ServerConfig, error) {
 		opt(cfg)
 	}
 
-	if err := validateAddr(cfg.BindAddr); err != nil {
+	if err := Validate(cfg, ""); err != nil {
 		return nil, err
 	}
 
-	if cfg.Metrics != nil {
-		if cfg.Metrics.Enabled {
-			if err := validateMetricsServiceName(cfg.Metrics.ServiceName); err != nil {
-				return nil, err
-			}
-		}
-	}
-
 	return cfg, nil
 }
 
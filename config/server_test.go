@@ -293,6 +293,27 @@ func TestServerConfigWithMetrics(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "invalid service name of disabled metrics",
+			opts: []ServerConfigOption{
+				WithBindAddr("127.0.0.1:8080"),
+				WithMetrics(&Metrics{
+					Enabled:     false,
+					ServiceName: "invalid@service",
+				}),
+			},
+			want: &ServerConfig{
+				BindAddr: "127.0.0.1:8080",
+				Metrics: &Metrics{
+					Enabled:     false,
+					ServiceName: "invalid@service",
+				},
+				Trace: &Trace{
+					Enabled: false,
+				},
+			},
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,71 @@
+// This file is used to print the resolved configuration
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Settings returns the resolved configuration as a map keyed like the configuration file,
+// with defaults filled in and secrets redacted. It is meant for printing the configuration.
+func (bc *BaseConfig) Settings() map[string]any {
+	settings, _ := toSetting(reflect.ValueOf(bc)).(map[string]any)
+	return settings
+}
+
+// toSetting converts v into plain maps, slices and values
+func toSetting(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return toSetting(v.Elem())
+	}
+
+	switch v.Type() {
+	case secretType:
+		return v.Interface().(Secret).String()
+	case durationType:
+		return time.Duration(v.Int()).String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		m := make(map[string]any)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+			if name == "" {
+				name = field.Name
+			}
+			m[name] = toSetting(v.Field(i))
+		}
+		return m
+	case reflect.Map:
+		m := make(map[string]any)
+		for _, k := range v.MapKeys() {
+			m[fmt.Sprint(k.Interface())] = toSetting(v.MapIndex(k))
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		s := make([]any, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s = append(s, toSetting(v.Index(i)))
+		}
+		return s
+	default:
+		return v.Interface()
+	}
+}
@@ -2,7 +2,8 @@
 package config
 
 import (
-	"fmt"
+	"sort"
+	"time"
 )
 
 // default configuration
@@ -11,32 +12,103 @@ const (
 	_defaultSQLType = "sqlite3"
 	// default database file
 	_defaultSQL = "./sqlite.db"
+	// default mysql character set
+	_defaultCharset = "utf8mb4"
+	// default mysql time zone
+	_defaultLoc = "Local"
+	// default wait before the first connect retry
+	_defaultConnectBackoff = time.Second
 )
 
-// support mysql and sqlite
+// support mysql, postgres and sqlite
 const (
-	MySQL   = "mysql"
-	Sqlite3 = "sqlite3"
+	MySQL    = "mysql"
+	Postgres = "postgres"
+	Sqlite3  = "sqlite3"
 )
 
+// routing policies of the reads to replicas
+const (
+	ReplicaRandom           = "random"
+	ReplicaRoundRobin       = "round-robin"
+	ReplicaLeastConnections = "least-connections"
+)
+
+// DefaultDatabase is the name of the database configured directly under the sql key
+const DefaultDatabase = "default"
+
 // SQLConfig is used to configure the SQL-database
 type SQLConfig struct {
-	// Database type only support mysql and sqlite, default sqlite
-	Type string `mapstructure:"type"`
-	// Database host, include port such as 127.0.0.1:3306
+	// Database type only support mysql, postgres and sqlite, default sqlite
+	Type string `mapstructure:"type" validate:"oneof=mysql postgres sqlite3"`
+	// Database host, include port such as 127.0.0.1:3306 or 127.0.0.1:5432
 	Host string `mapstructure:"host"`
 	// Database user
 	User string `mapstructure:"user"`
-	// Database password
-	Password string `mapstructure:"password"`
-	// Database name
+	// Database password, can reference a secret such as file:///run/secrets/db_pw
+	Password Secret `mapstructure:"password"`
+	// Database name, the database file for sqlite such as ./sqlite.db or :memory:
 	DB string `mapstructure:"db"`
-	// Maximum number of idle connections
-	MaxIdleConns int `mapstructure:"maxIdleConns"`
-	// Maximum number of open connections
-	MaxOpenConns int `mapstructure:"maxOpenConns"`
-	// Print raw sql for debugging
+	// Raw data source name passed to the driver as it is, e.g. user:pw@tcp(127.0.0.1:3306)/app?parseTime=true.
+	// It takes precedence over the connection fields and options below.
+	DSN Secret `mapstructure:"dsn"`
+	// Additional driver parameters added to the data source name, e.g. {"autocommit": "true"}
+	Params map[string]string `mapstructure:"params"`
+	// Connection character set for mysql, default utf8mb4
+	Charset string `mapstructure:"charset"`
+	// Connection collation for mysql, e.g. utf8mb4_unicode_ci, default is the server default of the charset
+	Collation string `mapstructure:"collation"`
+	// Time zone of time values for mysql and postgres, e.g. UTC or Asia/Shanghai, default Local
+	Loc string `mapstructure:"loc" validate:"omitempty,timezone"`
+	// TLS mode for mysql, one of true, false, skip-verify and preferred, default disabled
+	TLS string `mapstructure:"tls" validate:"omitempty,oneof=true false skip-verify preferred"`
+	// Dial timeout such as 5s, whole seconds for postgres, default is the driver default
+	Timeout time.Duration `mapstructure:"timeout" validate:"min=0"`
+	// I/O read timeout for mysql such as 30s, default none
+	ReadTimeout time.Duration `mapstructure:"readTimeout" validate:"min=0"`
+	// I/O write timeout for mysql such as 30s, default none
+	WriteTimeout time.Duration `mapstructure:"writeTimeout" validate:"min=0"`
+	// SSL mode for postgres, one of disable, allow, prefer, require, verify-ca and verify-full, default prefer
+	SSLMode string `mapstructure:"sslmode" validate:"omitempty,oneof=disable allow prefer require verify-ca verify-full"`
+	// Schema search path for postgres, e.g. app,public
+	SearchPath string `mapstructure:"searchPath"`
+	// Schema of the tables for postgres, table names are qualified with it, e.g. app.users
+	Schema string `mapstructure:"schema"`
+	// Journal mode for sqlite, one of delete, truncate, persist, memory, wal and off, default delete
+	JournalMode string `mapstructure:"journalMode" validate:"omitempty,oneof=delete truncate persist memory wal off"`
+	// How long sqlite waits for a locked database such as 5s, default 0 fails at once
+	BusyTimeout time.Duration `mapstructure:"busyTimeout" validate:"min=0"`
+	// Enforce foreign key constraints for sqlite
+	ForeignKeys bool `mapstructure:"foreignKeys"`
+	// Share the cache between connections for sqlite, required for an in-memory database
+	// used by more than one connection
+	SharedCache bool `mapstructure:"sharedCache"`
+	// Maximum number of idle connections, 0 keeps the driver default of 2
+	MaxIdleConns int `mapstructure:"maxIdleConns" validate:"min=0"`
+	// Maximum number of open connections, 0 means unlimited
+	MaxOpenConns int `mapstructure:"maxOpenConns" validate:"min=0"`
+	// Maximum time a connection may be reused such as 1h, 0 means forever
+	ConnMaxLifetime time.Duration `mapstructure:"connMaxLifetime" validate:"min=0"`
+	// Maximum time a connection may be idle such as 10m, 0 means forever
+	ConnMaxIdleTime time.Duration `mapstructure:"connMaxIdleTime" validate:"min=0"`
+	// Number of times a failed connection is retried on open, e.g. while the database restarts during a deploy
+	ConnectRetries int `mapstructure:"connectRetries" validate:"min=0"`
+	// Wait before the first connect retry, it doubles after every retry up to 30s, default 1s
+	ConnectBackoff time.Duration `mapstructure:"connectBackoff" validate:"min=0"`
+	// Print raw sql for debugging, every statement is logged instead of slow and failed ones only
 	Debug bool `mapstructure:"debug"`
+	// Key signing the cursors of cursor pagination, share it between the instances of a service,
+	// a random key is generated if it is empty, so cursors only work within one process
+	CursorSecret Secret `mapstructure:"cursorSecret"`
+	// Read replicas sharing the other settings of this database, reads go to a replica and writes to the primary.
+	// Every entry replaces the host, e.g. 10.0.0.2:3306, or the database file for sqlite. Replicas cannot be used with dsn.
+	Replicas []string `mapstructure:"replicas"`
+	// Policy picking the replica of a read, one of random, round-robin and least-connections, default random
+	ReplicaPolicy string `mapstructure:"replicaPolicy" validate:"omitempty,oneof=random round-robin least-connections"`
+	// Additional named databases, e.g. a read-only reporting database.
+	// Every entry is configured like the sql section and gets the same defaults,
+	// names are lower-cased and DefaultDatabase is reserved for the sql section itself.
+	Databases map[string]*SQLConfig `mapstructure:"databases"`
 }
 
 // SQLConfigOption is used to configure the SQL-database
@@ -44,8 +116,11 @@ type SQLConfigOption func(*SQLConfig)
 
 func defaultSQLConfig() *SQLConfig {
 	return &SQLConfig{
-		Type: _defaultSQLType,
-		DB:   _defaultSQL,
+		Type:           _defaultSQLType,
+		DB:             _defaultSQL,
+		Charset:        _defaultCharset,
+		Loc:            _defaultLoc,
+		ConnectBackoff: _defaultConnectBackoff,
 	}
 }
 
@@ -57,9 +132,8 @@ func NewSQLConfig(opts ...SQLConfigOption) (*SQLConfig, error) {
 		opt(cfg)
 	}
 
-	// Validate database type
-	if cfg.Type != MySQL && cfg.Type != Sqlite3 {
-		return nil, fmt.Errorf("invalid database type: %s", cfg.Type)
+	if err := Validate(cfg, ""); err != nil {
+		return nil, err
 	}
 
 	return cfg, nil
@@ -89,7 +163,7 @@ func WithUser(user string) SQLConfigOption {
 // WithPassword sets the database password
 func WithPassword(password string) SQLConfigOption {
 	return func(c *SQLConfig) {
-		c.Password = password
+		c.Password = Secret(password)
 	}
 }
 
@@ -114,9 +188,239 @@ func WithMaxOpenConns(n int) SQLConfigOption {
 	}
 }
 
+// WithConnMaxLifetime sets the maximum time a connection may be reused
+func WithConnMaxLifetime(d time.Duration) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.ConnMaxLifetime = d
+	}
+}
+
+// WithConnMaxIdleTime sets the maximum time a connection may be idle
+func WithConnMaxIdleTime(d time.Duration) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.ConnMaxIdleTime = d
+	}
+}
+
+// WithConnectRetries sets the number of connect retries on open
+func WithConnectRetries(n int) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.ConnectRetries = n
+	}
+}
+
+// WithConnectBackoff sets the wait before the first connect retry
+func WithConnectBackoff(d time.Duration) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.ConnectBackoff = d
+	}
+}
+
 // WithDebug sets the SQL debug mode
 func WithDebug(debug bool) SQLConfigOption {
 	return func(c *SQLConfig) {
 		c.Debug = debug
 	}
 }
+
+// WithCursorSecret sets the key signing pagination cursors
+func WithCursorSecret(secret string) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.CursorSecret = Secret(secret)
+	}
+}
+
+// WithReplicas sets the read replicas
+func WithReplicas(replicas ...string) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.Replicas = replicas
+	}
+}
+
+// WithReplicaPolicy sets the policy picking the replica of a read
+func WithReplicaPolicy(policy string) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.ReplicaPolicy = policy
+	}
+}
+
+// WithDSN sets the raw data source name, it takes precedence over the other connection options
+func WithDSN(dsn string) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.DSN = Secret(dsn)
+	}
+}
+
+// WithParams sets additional driver parameters
+func WithParams(params map[string]string) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.Params = params
+	}
+}
+
+// WithCharset sets the mysql connection character set
+func WithCharset(charset string) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.Charset = charset
+	}
+}
+
+// WithCollation sets the mysql connection collation
+func WithCollation(collation string) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.Collation = collation
+	}
+}
+
+// WithLoc sets the mysql time zone
+func WithLoc(loc string) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.Loc = loc
+	}
+}
+
+// WithTLS sets the mysql TLS mode
+func WithTLS(tls string) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.TLS = tls
+	}
+}
+
+// WithTimeout sets the dial timeout
+func WithTimeout(d time.Duration) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.Timeout = d
+	}
+}
+
+// WithReadTimeout sets the mysql I/O read timeout
+func WithReadTimeout(d time.Duration) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.ReadTimeout = d
+	}
+}
+
+// WithWriteTimeout sets the mysql I/O write timeout
+func WithWriteTimeout(d time.Duration) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.WriteTimeout = d
+	}
+}
+
+// WithSSLMode sets the postgres SSL mode
+func WithSSLMode(mode string) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.SSLMode = mode
+	}
+}
+
+// WithSearchPath sets the postgres schema search path
+func WithSearchPath(path string) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.SearchPath = path
+	}
+}
+
+// WithSchema sets the postgres schema of the tables
+func WithSchema(schema string) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.Schema = schema
+	}
+}
+
+// WithJournalMode sets the sqlite journal mode
+func WithJournalMode(mode string) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.JournalMode = mode
+	}
+}
+
+// WithBusyTimeout sets how long sqlite waits for a locked database
+func WithBusyTimeout(d time.Duration) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.BusyTimeout = d
+	}
+}
+
+// WithForeignKeys enables sqlite foreign key constraints
+func WithForeignKeys(enabled bool) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.ForeignKeys = enabled
+	}
+}
+
+// WithSharedCache enables the sqlite shared cache
+func WithSharedCache(enabled bool) SQLConfigOption {
+	return func(c *SQLConfig) {
+		c.SharedCache = enabled
+	}
+}
+
+// WithDatabase adds a named database
+func WithDatabase(name string, db *SQLConfig) SQLConfigOption {
+	return func(c *SQLConfig) {
+		if c.Databases == nil {
+			c.Databases = make(map[string]*SQLConfig)
+		}
+		c.Databases[name] = db
+	}
+}
+
+// Database returns the configuration of the named database,
+// DefaultDatabase returns the sql section itself
+func (c *SQLConfig) Database(name string) (*SQLConfig, bool) {
+	if name == DefaultDatabase {
+		return c, true
+	}
+	db, ok := c.Databases[name]
+	return db, ok && db != nil
+}
+
+// DatabaseNames returns the names of all databases in order, starting with DefaultDatabase
+func (c *SQLConfig) DatabaseNames() []string {
+	names := make([]string, 0, len(c.Databases))
+	for name, db := range c.Databases {
+		if db != nil && name != DefaultDatabase {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{DefaultDatabase}, names...)
+}
+
+// sqlConfigOptions returns the options that build a copy of c without its named databases
+func sqlConfigOptions(c *SQLConfig) []SQLConfigOption {
+	return []SQLConfigOption{
+		WithType(c.Type),
+		WithHost(c.Host),
+		WithUser(c.User),
+		WithPassword(c.Password.Value()),
+		WithDB(c.DB),
+		WithMaxIdleConns(c.MaxIdleConns),
+		WithMaxOpenConns(c.MaxOpenConns),
+		WithConnMaxLifetime(c.ConnMaxLifetime),
+		WithConnMaxIdleTime(c.ConnMaxIdleTime),
+		WithConnectRetries(c.ConnectRetries),
+		WithConnectBackoff(c.ConnectBackoff),
+		WithDebug(c.Debug),
+		WithCursorSecret(c.CursorSecret.Value()),
+		WithReplicas(c.Replicas...),
+		WithReplicaPolicy(c.ReplicaPolicy),
+		WithDSN(c.DSN.Value()),
+		WithParams(c.Params),
+		WithCharset(c.Charset),
+		WithCollation(c.Collation),
+		WithLoc(c.Loc),
+		WithTLS(c.TLS),
+		WithTimeout(c.Timeout),
+		WithReadTimeout(c.ReadTimeout),
+		WithWriteTimeout(c.WriteTimeout),
+		WithSSLMode(c.SSLMode),
+		WithSearchPath(c.SearchPath),
+		WithSchema(c.Schema),
+		WithJournalMode(c.JournalMode),
+		WithBusyTimeout(c.BusyTimeout),
+		WithForeignKeys(c.ForeignKeys),
+		WithSharedCache(c.SharedCache),
+	}
+}
@@ -1,6 +1,13 @@
 package config
 
-import "testing"
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
 
 func TestNewSQLConfig(t *testing.T) {
 	tests := []struct {
@@ -26,8 +33,83 @@ func TestNewSQLConfig(t *testing.T) {
 		},
 		{
 			name: "invalid db type",
+			opts: []SQLConfigOption{
+				WithType("oracle"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid connection options",
+			opts: []SQLConfigOption{
+				WithType("mysql"),
+				WithLoc("Asia/Shanghai"),
+				WithTLS("preferred"),
+				WithTimeout(5 * time.Second),
+				WithParams(map[string]string{"autocommit": "true"}),
+			},
+			wantErr: false,
+		},
+		{
+			name: "valid postgres config",
 			opts: []SQLConfigOption{
 				WithType("postgres"),
+				WithHost("localhost:5432"),
+				WithSSLMode("verify-full"),
+				WithSearchPath("app,public"),
+				WithSchema("app"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid ssl mode",
+			opts: []SQLConfigOption{
+				WithType("postgres"),
+				WithSSLMode("on"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid tls mode",
+			opts: []SQLConfigOption{
+				WithTLS("always"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid time zone",
+			opts: []SQLConfigOption{
+				WithLoc("Nowhere/City"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative timeout",
+			opts: []SQLConfigOption{
+				WithReadTimeout(-time.Second),
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid replicas",
+			opts: []SQLConfigOption{
+				WithType("mysql"),
+				WithReplicas("replica-1:3306", "replica-2:3306"),
+				WithReplicaPolicy(ReplicaLeastConnections),
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid replica policy",
+			opts: []SQLConfigOption{
+				WithReplicas("replica-1:3306"),
+				WithReplicaPolicy("nearest"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid journal mode",
+			opts: []SQLConfigOption{
+				WithJournalMode("fast"),
 			},
 			wantErr: true,
 		},
@@ -46,3 +128,142 @@ func TestNewSQLConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestSQLConfigDatabases(t *testing.T) {
+	reporting := &SQLConfig{Type: MySQL, Host: "reporting:3306", DB: "reports"}
+	cfg, err := NewSQLConfig(
+		WithType(MySQL),
+		WithHost("primary:3306"),
+		WithDatabase("reporting", reporting),
+		WithDatabase("cache", defaultSQLConfig()),
+	)
+	if err != nil {
+		t.Fatalf("NewSQLConfig() error = %v", err)
+	}
+
+	if got := cfg.DatabaseNames(); !reflect.DeepEqual(got, []string{DefaultDatabase, "cache", "reporting"}) {
+		t.Errorf("DatabaseNames() = %v", got)
+	}
+	if db, ok := cfg.Database(DefaultDatabase); !ok || db != cfg {
+		t.Errorf("Database(%s) = %v, %v, want the sql section", DefaultDatabase, db, ok)
+	}
+	if db, ok := cfg.Database("reporting"); !ok || db != reporting {
+		t.Errorf("Database(reporting) = %v, %v", db, ok)
+	}
+	if _, ok := cfg.Database("missing"); ok {
+		t.Error("Database(missing) should not be found")
+	}
+}
+
+func TestLoaderDatabases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(`
+sql:
+  type: mysql
+  host: primary:3306
+  db: app
+  databases:
+    reporting:
+      type: mysql
+      host: reporting:3306
+      db: reports
+      maxOpenConns: 5
+    cache:
+      db: ./cache.db
+      journalMode: wal
+      busyTimeout: 5s
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DBTEST_SQL_DATABASES_REPORTING_USER", "reader")
+
+	cfg, err := NewLoader(WithFile(path), WithEnvPrefix("dbtest")).Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.SQL.Host != "primary:3306" {
+		t.Errorf("sql.host = %s, want primary:3306", cfg.SQL.Host)
+	}
+	reporting, ok := cfg.SQL.Database("reporting")
+	if !ok {
+		t.Fatal("reporting database is missing")
+	}
+	if reporting.Host != "reporting:3306" || reporting.MaxOpenConns != 5 || reporting.User != "reader" {
+		t.Errorf("reporting = %+v", reporting)
+	}
+	cache, ok := cfg.SQL.Database("cache")
+	if !ok {
+		t.Fatal("cache database is missing")
+	}
+	if cache.Type != Sqlite3 || cache.DB != "./cache.db" || cache.JournalMode != "wal" || cache.BusyTimeout != 5*time.Second {
+		t.Errorf("cache = %+v, want sqlite3 defaults", cache)
+	}
+
+	origins := make(map[string]Origin)
+	for _, o := range cfg.Explain() {
+		origins[o.Key] = o
+	}
+	if o := origins["sql.databases.reporting.maxOpenConns"]; o.Layer != LayerFile {
+		t.Errorf("origin of sql.databases.reporting.maxOpenConns = %v, want file", o)
+	}
+	if o := origins["sql.databases.reporting.user"]; o.Layer != LayerEnv {
+		t.Errorf("origin of sql.databases.reporting.user = %v, want env", o)
+	}
+	if o := origins["sql.databases.cache.type"]; o.Layer != LayerDefault {
+		t.Errorf("origin of sql.databases.cache.type = %v, want default", o)
+	}
+}
+
+func TestLoaderDatabasesValidation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(`
+sql:
+  databases:
+    reporting:
+      type: oracle
+    default:
+      db: ./other.db
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewLoader(WithFile(path), WithEnvPrefix("")).Load()
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) {
+		t.Fatalf("Load() error = %v, want ValidationErrors", err)
+	}
+	var keys []string
+	for _, fe := range verrs {
+		keys = append(keys, fe.Key)
+	}
+	if want := []string{"sql.databases.default", "sql.databases.reporting.type"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+}
+
+func TestLoaderReplicas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(`
+sql:
+  type: mysql
+  host: primary:3306
+  replicas:
+    - replica-1:3306
+    - replica-2:3306
+  replicaPolicy: round-robin
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := NewLoader(WithFile(path), WithEnvPrefix("")).Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(cfg.SQL.Replicas, []string{"replica-1:3306", "replica-2:3306"}) {
+		t.Errorf("sql.replicas = %v", cfg.SQL.Replicas)
+	}
+	if cfg.SQL.ReplicaPolicy != ReplicaRoundRobin {
+		t.Errorf("sql.replicaPolicy = %s, want round-robin", cfg.SQL.ReplicaPolicy)
+	}
+}
@@ -0,0 +1,256 @@
+// This file is used to validate the configuration with validate struct tags
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FieldError is a violation of a validation rule
+type FieldError struct {
+	// Key is the full configuration key, e.g. custom.queue.workers
+	Key string
+	// Rule is the violated rule, e.g. min
+	Rule string
+	// Message describes the violation, e.g. must be >= 1
+	Message string
+	// Source is where the value came from, it is set when the configuration is loaded by a Loader
+	Source string
+}
+
+// Error implements error
+func (e *FieldError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("%s: %s", e.Key, e.Message)
+	}
+	return fmt.Sprintf("%s: %s (from %s)", e.Key, e.Message, e.Source)
+}
+
+// ValidationErrors aggregates all violations found in a configuration
+type ValidationErrors []*FieldError
+
+// Error implements error
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ValidationFunc checks a field against the parameter of its rule, e.g. 1 for min=1.
+// The returned error message is reported as the violation.
+type ValidationFunc func(field reflect.Value, param string) error
+
+var (
+	validationsMu sync.RWMutex
+	// validations are the rules usable in validate tags besides required, required_if, skip_unless and omitempty
+	validations = map[string]ValidationFunc{
+		"min":        validateMin,
+		"max":        validateMax,
+		"oneof":      validateOneOf,
+		"hostport":   validateHostPort,
+		"metricname": validateMetricName,
+		"timezone":   validateTimezone,
+	}
+)
+
+// RegisterValidation registers a rule usable in validate tags
+func RegisterValidation(rule string, fn ValidationFunc) {
+	validationsMu.Lock()
+	defer validationsMu.Unlock()
+	validations[rule] = fn
+}
+
+// Validate checks v against its validate tags, e.g. `validate:"required,min=1,hostport"`.
+// Keys are built from mapstructure tags and prefixed with prefix.
+// All violations are returned as ValidationErrors.
+func Validate(v any, prefix string) error {
+	var errs ValidationErrors
+	validateValue(reflect.ValueOf(v), prefix, &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateValue walks v and checks the fields of every struct it contains
+func validateValue(v reflect.Value, key string, errs *ValidationErrors) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			validateValue(v.Elem(), key, errs)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+			if name == "" {
+				name = field.Name
+			}
+			if key != "" {
+				name = key + "." + name
+			}
+			if tag := field.Tag.Get("validate"); tag != "" {
+				if fe := validateField(v, v.Field(i), name, tag); fe != nil {
+					*errs = append(*errs, fe)
+					continue
+				}
+			}
+			validateValue(v.Field(i), name, errs)
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			validateValue(v.MapIndex(k), fmt.Sprintf("%s.%v", key, k.Interface()), errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", key, i), errs)
+		}
+	}
+}
+
+// validateField checks field against the rules of tag, parent is the struct holding field
+func validateField(parent, field reflect.Value, key, tag string) *FieldError {
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "omitempty":
+			if isZero(field) {
+				return nil
+			}
+		case "required":
+			if isZero(field) {
+				return &FieldError{Key: key, Rule: name, Message: "is required"}
+			}
+		case "required_if":
+			other, value, _ := strings.Cut(param, " ")
+			f := parent.FieldByName(other)
+			if f.IsValid() && fmt.Sprint(f.Interface()) == value && isZero(field) {
+				return &FieldError{Key: key, Rule: name, Message: fmt.Sprintf("is required when %s is %s", other, value)}
+			}
+		case "skip_unless":
+			// the remaining rules only apply when the other field has the value, e.g. skip_unless=Enabled true
+			other, value, _ := strings.Cut(param, " ")
+			if f := parent.FieldByName(other); !f.IsValid() || fmt.Sprint(f.Interface()) != value {
+				return nil
+			}
+		default:
+			validationsMu.RLock()
+			fn, ok := validations[name]
+			validationsMu.RUnlock()
+			if !ok {
+				return &FieldError{Key: key, Rule: name, Message: fmt.Sprintf("unknown validation rule %s", name)}
+			}
+			if err := fn(field, param); err != nil {
+				return &FieldError{Key: key, Rule: name, Message: err.Error()}
+			}
+		}
+	}
+	return nil
+}
+
+// isZero reports whether v is the zero value, nil pointers and empty collections included
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+// size returns the number compared by min and max: the value of numbers and the length of anything else
+func size(v reflect.Value) (float64, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), nil
+	default:
+		return 0, fmt.Errorf("unsupported type %s", v.Type())
+	}
+}
+
+func validateMin(v reflect.Value, param string) error {
+	min, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return fmt.Errorf("invalid min parameter %s", param)
+	}
+	n, err := size(v)
+	if err != nil {
+		return err
+	}
+	if n < min {
+		if v.Kind() == reflect.String || v.Kind() == reflect.Slice || v.Kind() == reflect.Map {
+			return fmt.Errorf("length must be >= %s", param)
+		}
+		return fmt.Errorf("must be >= %s", param)
+	}
+	return nil
+}
+
+func validateMax(v reflect.Value, param string) error {
+	max, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return fmt.Errorf("invalid max parameter %s", param)
+	}
+	n, err := size(v)
+	if err != nil {
+		return err
+	}
+	if n > max {
+		if v.Kind() == reflect.String || v.Kind() == reflect.Slice || v.Kind() == reflect.Map {
+			return fmt.Errorf("length must be <= %s", param)
+		}
+		return fmt.Errorf("must be <= %s", param)
+	}
+	return nil
+}
+
+func validateOneOf(v reflect.Value, param string) error {
+	value := fmt.Sprint(v.Interface())
+	for _, allowed := range strings.Fields(param) {
+		if value == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of [%s], got %s", strings.Join(strings.Fields(param), " "), value)
+}
+
+func validateHostPort(v reflect.Value, _ string) error {
+	if v.Kind() != reflect.String {
+		return errors.New("hostport applies to strings only")
+	}
+	return validateAddr(v.String())
+}
+
+func validateMetricName(v reflect.Value, _ string) error {
+	if v.Kind() != reflect.String {
+		return errors.New("metricname applies to strings only")
+	}
+	return validateMetricsServiceName(v.String())
+}
+
+func validateTimezone(v reflect.Value, _ string) error {
+	if v.Kind() != reflect.String {
+		return errors.New("timezone applies to strings only")
+	}
+	if _, err := time.LoadLocation(v.String()); err != nil {
+		return fmt.Errorf("unknown time zone %s", v.String())
+	}
+	return nil
+}
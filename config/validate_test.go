@@ -0,0 +1,174 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// QueueConfig is a nested custom section with validate tags
+type QueueConfig struct {
+	Name    string `mapstructure:"name" validate:"required"`
+	Workers int    `mapstructure:"workers" validate:"min=1,max=64"`
+	Broker  string `mapstructure:"broker" validate:"omitempty,hostport"`
+	Mode    string `mapstructure:"mode" validate:"oneof=fifo lifo"`
+}
+
+// ValidatedCustomConfig is a custom configuration with validate tags
+type ValidatedCustomConfig struct {
+	Queue *QueueConfig `mapstructure:"queue"`
+	Tags  []string     `mapstructure:"tags" validate:"min=1"`
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    any
+		wantKeys []string
+	}{
+		{
+			name: "valid",
+			value: &ValidatedCustomConfig{
+				Queue: &QueueConfig{Name: "jobs", Workers: 4, Broker: "127.0.0.1:5672", Mode: "fifo"},
+				Tags:  []string{"a"},
+			},
+		},
+		{
+			name: "all violations are collected",
+			value: &ValidatedCustomConfig{
+				Queue: &QueueConfig{Workers: 0, Broker: "broker", Mode: "random"},
+			},
+			wantKeys: []string{"custom.queue.name", "custom.queue.workers", "custom.queue.broker", "custom.queue.mode", "custom.tags"},
+		},
+		{
+			name: "max",
+			value: &ValidatedCustomConfig{
+				Queue: &QueueConfig{Name: "jobs", Workers: 100, Mode: "lifo"},
+				Tags:  []string{"a"},
+			},
+			wantKeys: []string{"custom.queue.workers"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.value, "custom")
+			if len(tt.wantKeys) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			var verrs ValidationErrors
+			if !errors.As(err, &verrs) {
+				t.Fatalf("Validate() error = %v, want ValidationErrors", err)
+			}
+			var keys []string
+			for _, fe := range verrs {
+				keys = append(keys, fe.Key)
+			}
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("keys = %v, want %v", keys, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestValidateMessages(t *testing.T) {
+	err := Validate(&QueueConfig{Name: "jobs", Workers: 0, Mode: "fifo"}, "custom.queue")
+	if got, want := err.Error(), "custom.queue.workers: must be >= 1"; got != want {
+		t.Errorf("Error() = %s, want %s", got, want)
+	}
+}
+
+func TestParseCustomConfigValidation(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Custom = map[string]any{
+		"queue": map[string]any{
+			"name":    "jobs",
+			"workers": 0,
+			"mode":    "fifo",
+		},
+		"tags": []string{"a"},
+	}
+
+	var custom ValidatedCustomConfig
+	err := cfg.ParseCustomConfig(&custom)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	if !strings.Contains(err.Error(), "custom.queue.workers: must be >= 1") {
+		t.Errorf("Error() = %s, want custom.queue.workers violation", err)
+	}
+	if custom.Queue == nil || custom.Queue.Name != "jobs" {
+		t.Errorf("custom config was not decoded: %#v", custom.Queue)
+	}
+}
+
+func TestLoaderValidationErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(`
+sql:
+  type: oracle
+log:
+  format: xml
+server:
+  bindAddr: nowhere
+custom:
+  queue:
+    name: jobs
+    workers: 0
+    mode: fifo
+  tags: [a]
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewLoader(WithFile(path), WithEnvPrefix(""), WithCustom(&ValidatedCustomConfig{})).Load()
+	var verrs ValidationErrors
+	if !errors.As(err, &verrs) {
+		t.Fatalf("Load() error = %v, want ValidationErrors", err)
+	}
+
+	want := map[string]bool{
+		"sql.type":             true,
+		"log.format":           true,
+		"server.bindAddr":      true,
+		"custom.queue.workers": true,
+	}
+	for _, fe := range verrs {
+		if !want[fe.Key] {
+			t.Errorf("unexpected violation %s", fe)
+		}
+		delete(want, fe.Key)
+		if fe.Source != "file "+path {
+			t.Errorf("Source of %s = %s, want file %s", fe.Key, fe.Source, path)
+		}
+	}
+	for key := range want {
+		t.Errorf("missing violation for %s", key)
+	}
+}
+
+func TestRegisterValidation(t *testing.T) {
+	RegisterValidation("even", func(v reflect.Value, _ string) error {
+		if v.Int()%2 != 0 {
+			return fmt.Errorf("must be even")
+		}
+		return nil
+	})
+
+	type config struct {
+		Replicas int `mapstructure:"replicas" validate:"even"`
+	}
+	if err := Validate(&config{Replicas: 2}, ""); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	if err := Validate(&config{Replicas: 3}, ""); err == nil || err.Error() != "replicas: must be even" {
+		t.Errorf("Validate() error = %v, want replicas: must be even", err)
+	}
+}
@@ -0,0 +1,168 @@
+// This file is used to hot-reload the configuration
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// Watcher keeps a BaseConfig in sync with its configuration files.
+// Every change of a file is decoded and validated into a new BaseConfig,
+// which replaces the current one atomically. An invalid change is rejected
+// and the last good configuration is kept.
+type Watcher struct {
+	loader  *Loader
+	current atomic.Pointer[BaseConfig]
+	closed  atomic.Bool
+
+	// mu serializes reloads and guards the subscriptions
+	mu     sync.Mutex
+	server []func(old, new *ServerConfig)
+	sql    []func(old, new *SQLConfig)
+	log    []func(old, new *LogConfig)
+	custom []func(old, new any)
+	errs   []func(err error)
+}
+
+// Watch loads configuration from the specified file and keeps watching it for changes.
+// bc is used as the initial configuration, its Custom field decides the type of
+// the custom configuration of every reloaded configuration.
+func (bc *BaseConfig) Watch(name string) (*Watcher, error) {
+	l := NewLoader(WithFile(name))
+	l.custom = bc.Custom
+	if err := l.loadInto(bc); err != nil {
+		return nil, err
+	}
+	return l.watch(bc), nil
+}
+
+// Watch loads the configuration and keeps watching the configuration files for changes
+func (l *Loader) Watch() (*Watcher, error) {
+	if len(l.files) == 0 {
+		return nil, fmt.Errorf("no configuration file to watch")
+	}
+	bc, err := l.Load()
+	if err != nil {
+		return nil, err
+	}
+	return l.watch(bc), nil
+}
+
+// watch starts watching the configuration files with bc as the current configuration
+func (l *Loader) watch(bc *BaseConfig) *Watcher {
+	w := &Watcher{loader: l}
+	w.current.Store(bc)
+
+	for _, file := range l.files {
+		v := viper.New()
+		v.SetConfigFile(file)
+		v.OnConfigChange(func(fsnotify.Event) {
+			w.reload()
+		})
+		v.WatchConfig()
+	}
+	return w
+}
+
+// Config returns the current configuration, it must be treated as read-only
+func (w *Watcher) Config() *BaseConfig {
+	return w.current.Load()
+}
+
+// OnServerChange registers fn to be called when the server configuration changes
+func (w *Watcher) OnServerChange(fn func(old, new *ServerConfig)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.server = append(w.server, fn)
+}
+
+// OnSQLChange registers fn to be called when the SQL configuration changes
+func (w *Watcher) OnSQLChange(fn func(old, new *SQLConfig)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sql = append(w.sql, fn)
+}
+
+// OnLogChange registers fn to be called when the log configuration changes
+func (w *Watcher) OnLogChange(fn func(old, new *LogConfig)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.log = append(w.log, fn)
+}
+
+// OnCustomChange registers fn to be called when the custom configuration changes
+func (w *Watcher) OnCustomChange(fn func(old, new any)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.custom = append(w.custom, fn)
+}
+
+// OnError registers fn to be called when a change of the file is rejected
+func (w *Watcher) OnError(fn func(err error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.errs = append(w.errs, fn)
+}
+
+// Close stops reloading the configuration and notifying subscribers.
+// viper offers no way to stop its file watcher, so the watch goroutine keeps running.
+func (w *Watcher) Close() {
+	w.closed.Store(true)
+}
+
+// reload reads the file again and swaps in the new configuration if it is valid
+func (w *Watcher) reload() {
+	if w.closed.Load() {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	old := w.current.Load()
+	bc := NewConfig()
+	bc.Custom = newCustom(old.Custom)
+	if err := w.loader.loadInto(bc); err != nil {
+		for _, fn := range w.errs {
+			fn(err)
+		}
+		return
+	}
+
+	w.current.Store(bc)
+
+	if !reflect.DeepEqual(old.Server, bc.Server) {
+		for _, fn := range w.server {
+			fn(old.Server, bc.Server)
+		}
+	}
+	if !reflect.DeepEqual(old.SQL, bc.SQL) {
+		for _, fn := range w.sql {
+			fn(old.SQL, bc.SQL)
+		}
+	}
+	if !reflect.DeepEqual(old.Log, bc.Log) {
+		for _, fn := range w.log {
+			fn(old.Log, bc.Log)
+		}
+	}
+	if !reflect.DeepEqual(old.Custom, bc.Custom) {
+		for _, fn := range w.custom {
+			fn(old.Custom, bc.Custom)
+		}
+	}
+}
+
+// newCustom returns an empty value with the same type as custom,
+// so that a reload decodes into a fresh value instead of the current one
+func newCustom(custom any) any {
+	t := reflect.TypeOf(custom)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return nil
+	}
+	return reflect.New(t.Elem()).Interface()
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeConfig atomically replaces the file at path, like editors and ConfigMap updates do
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, `
+log:
+  level: info
+server:
+  metrics:
+    excludeItem: ["/health"]
+`)
+
+	cfg := NewConfig()
+	w, err := cfg.Watch(path)
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	defer w.Close()
+
+	if w.Config().Log.Level != "info" {
+		t.Fatalf("Log.Level = %s, want info", w.Config().Log.Level)
+	}
+
+	logChanges := make(chan [2]*LogConfig, 1)
+	w.OnLogChange(func(old, new *LogConfig) {
+		logChanges <- [2]*LogConfig{old, new}
+	})
+	serverChanges := make(chan *ServerConfig, 1)
+	w.OnServerChange(func(old, new *ServerConfig) {
+		serverChanges <- new
+	})
+	var sqlChanged atomic.Bool
+	w.OnSQLChange(func(old, new *SQLConfig) {
+		sqlChanged.Store(true)
+	})
+	errs := make(chan error, 1)
+	w.OnError(func(err error) {
+		errs <- err
+	})
+
+	writeConfig(t, path, `
+log:
+  level: debug
+server:
+  metrics:
+    excludeItem: ["/health", "/ready"]
+`)
+
+	select {
+	case change := <-logChanges:
+		if change[0].Level != "info" || change[1].Level != "debug" {
+			t.Errorf("log change = %s -> %s, want info -> debug", change[0].Level, change[1].Level)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for log change")
+	}
+	select {
+	case server := <-serverChanges:
+		if len(server.Metrics.ExcludeItem) != 2 {
+			t.Errorf("Metrics.ExcludeItem = %v, want 2 items", server.Metrics.ExcludeItem)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for server change")
+	}
+	if sqlChanged.Load() {
+		t.Error("unexpected SQL change notification")
+	}
+	if w.Config().Log.Level != "debug" {
+		t.Errorf("Log.Level = %s, want debug", w.Config().Log.Level)
+	}
+
+	// An invalid edit is rejected and the last good configuration is kept
+	writeConfig(t, path, `
+log:
+  level: debug
+  format: xml
+`)
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("expected reload error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reload error")
+	}
+	if w.Config().Log.Format != "string" {
+		t.Errorf("Log.Format = %s, want string", w.Config().Log.Format)
+	}
+}
+
+func TestWatchCustomConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, `
+custom:
+  serverName: first
+`)
+
+	cfg := NewConfig()
+	cfg.Custom = &CustomConfig{}
+	w, err := cfg.Watch(path)
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	defer w.Close()
+
+	changes := make(chan [2]any, 1)
+	w.OnCustomChange(func(old, new any) {
+		changes <- [2]any{old, new}
+	})
+
+	writeConfig(t, path, `
+custom:
+  serverName: second
+`)
+
+	select {
+	case change := <-changes:
+		old, ok := change[0].(*CustomConfig)
+		if !ok || old.ServerName != "first" {
+			t.Errorf("old custom = %#v, want ServerName first", change[0])
+		}
+		updated, ok := change[1].(*CustomConfig)
+		if !ok || updated.ServerName != "second" {
+			t.Errorf("new custom = %#v, want ServerName second", change[1])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for custom change")
+	}
+}
+
+func TestWatchInvalidFile(t *testing.T) {
+	cfg := NewConfig()
+	if _, err := cfg.Watch(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
@@ -0,0 +1,68 @@
+package ginserver
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/fize/go-ext/log"
+	"github.com/fize/go-ext/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// codes of ExceptResponse for storage errors
+const (
+	// CodeInternal is an unexpected error
+	CodeInternal = 1000
+	// CodeNotFound is returned for storage.ErrNotFound
+	CodeNotFound = 1001
+	// CodeConflict is returned for storage.ErrConflict
+	CodeConflict = 1002
+	// CodeDuplicate is returned for storage.ErrDuplicate
+	CodeDuplicate = 1003
+	// CodeInvalidFilter is returned for storage.ErrInvalidFilter and storage.ErrInvalidCursor
+	CodeInvalidFilter = 1004
+	// CodeTimeout is returned for storage.ErrTimeout
+	CodeTimeout = 1005
+	// CodeForbidden is returned for a *storage.TenantError
+	CodeForbidden = 1006
+	// CodeNoTenant is returned for storage.ErrNoTenant, the request carries no tenant, e.g. no valid token
+	CodeNoTenant = 1007
+)
+
+// StorageErrorResponse returns the HTTP status and the except response of a storage error.
+// Every class is answered with a fixed message, so driver errors, tables and columns are not disclosed,
+// the error itself is logged. Unexpected errors are answered with 500.
+func StorageErrorResponse(err error) (int, *Response) {
+	var tenantErr *storage.TenantError
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		log.Infof("storage error: %v", err)
+		return http.StatusNotFound, ExceptResponse(CodeNotFound, "not found")
+	case errors.Is(err, storage.ErrConflict):
+		return http.StatusConflict, ExceptResponse(CodeConflict, storage.ErrConflict.Error())
+	case errors.Is(err, storage.ErrDuplicate):
+		return http.StatusConflict, ExceptResponse(CodeDuplicate, "duplicate key")
+	case errors.Is(err, storage.ErrInvalidFilter):
+		log.Infof("storage error: %v", err)
+		return http.StatusBadRequest, ExceptResponse(CodeInvalidFilter, "invalid filter")
+	case errors.Is(err, storage.ErrTimeout):
+		return http.StatusGatewayTimeout, ExceptResponse(CodeTimeout, "timeout")
+	case errors.As(err, &tenantErr):
+		return http.StatusForbidden, ExceptResponse(CodeForbidden, "forbidden")
+	case errors.Is(err, storage.ErrNoTenant):
+		return http.StatusUnauthorized, ExceptResponse(CodeNoTenant, "no tenant")
+	default:
+		log.Errorf("storage error: %v", err)
+		return http.StatusInternalServerError, ExceptResponse(CodeInternal, "internal error")
+	}
+}
+
+// AbortWithStorageError aborts the request with the HTTP status and the except response of a storage error, e.g.
+//
+//	if err := store.Get(ctx, id, &user); err != nil {
+//		ginserver.AbortWithStorageError(c, err)
+//		return
+//	}
+func AbortWithStorageError(c *gin.Context, err error) {
+	c.AbortWithStatusJSON(StorageErrorResponse(err))
+}
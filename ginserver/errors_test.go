@@ -0,0 +1,61 @@
+package ginserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fize/go-ext/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorageErrorResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   int
+		msg    string
+	}{
+		{"not found", storage.ErrNotFound, http.StatusNotFound, CodeNotFound, "not found"},
+		{"wrapped not found", fmt.Errorf("get user: %w", storage.ErrNotFound), http.StatusNotFound, CodeNotFound, "not found"},
+		{"conflict", storage.ErrConflict, http.StatusConflict, CodeConflict, storage.ErrConflict.Error()},
+		{"duplicate", fmt.Errorf("Error 1062: %w", storage.ErrDuplicate), http.StatusConflict, CodeDuplicate, "duplicate key"},
+		{"invalid filter", fmt.Errorf("Error 1054: Unknown column 'secret' in 'users': %w", storage.ErrInvalidFilter), http.StatusBadRequest, CodeInvalidFilter, "invalid filter"},
+		{"invalid query string", invalidQuery("sorting by field age is not allowed"), http.StatusBadRequest, CodeInvalidFilter, "invalid filter"},
+		{"invalid cursor", storage.ErrInvalidCursor, http.StatusBadRequest, CodeInvalidFilter, "invalid filter"},
+		{"timeout", storage.ErrTimeout, http.StatusGatewayTimeout, CodeTimeout, "timeout"},
+		{"tenant", &storage.TenantError{Tenant: "a", Owner: "b", Table: "orders"}, http.StatusForbidden, CodeForbidden, "forbidden"},
+		{"no tenant", storage.ErrNoTenant, http.StatusUnauthorized, CodeNoTenant, "no tenant"},
+		{"internal", errors.New("connection refused"), http.StatusInternalServerError, CodeInternal, "internal error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := StorageErrorResponse(tt.err)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.code, resp.State.Code)
+			assert.Equal(t, tt.msg, resp.State.Msg)
+		})
+	}
+}
+
+func TestAbortWithStorageError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/users/:id", func(c *gin.Context) {
+		AbortWithStorageError(c, storage.ErrNotFound)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var resp Response
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, CodeNotFound, resp.State.Code)
+	assert.Equal(t, "not found", resp.State.Msg)
+}
@@ -0,0 +1,311 @@
+package ginserver
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fize/go-ext/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// default maximum page size of a QueryBinder
+const _defaultMaxLimit = 100
+
+// filterKeyPattern matches filter[field] and filter[field][op]
+var filterKeyPattern = regexp.MustCompile(`^filter\[([^\[\]]+)\](?:\[([^\[\]]+)\])?$`)
+
+// QueryBinder turns list query strings into a storage.Query, e.g.
+// ?filter[name][like]=foo%&sort=-created_at,name&page=2&limit=50&fields=id,name&include=RelatedModels.
+// Only whitelisted fields can be filtered, sorted, selected and included.
+//
+// filter[field]=v compares with eq, filter[field][op]=v with any operator of storage.Op.
+// The values of in, nin and between are separated by commas, the value of isnull is true or false.
+// sort lists the fields in order, a leading - sorts in descending order.
+// cursor is passed to storage.Query.Cursor for cursor pagination, where page is ignored.
+type QueryBinder struct {
+	// filterable fields and their operators, nil operators allow all of them
+	filters map[string][]storage.Op
+	// sortable fields
+	sorts map[string]bool
+	// selectable fields
+	fields map[string]bool
+	// associations that can be included
+	includes map[string]bool
+	// page size when limit is not given
+	defaultLimit int
+	// maximum page size
+	maxLimit int
+	// sort when sort is not given, e.g. -created_at
+	defaultSort string
+}
+
+// QueryBinderOption is used to configure the QueryBinder
+type QueryBinderOption func(*QueryBinder)
+
+// NewQueryBinder creates a new QueryBinder with the given options
+func NewQueryBinder(opts ...QueryBinderOption) *QueryBinder {
+	b := &QueryBinder{
+		filters:      make(map[string][]storage.Op),
+		sorts:        make(map[string]bool),
+		fields:       make(map[string]bool),
+		includes:     make(map[string]bool),
+		defaultLimit: _defaultPageSize,
+		maxLimit:     _defaultMaxLimit,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// WithFilter allows filtering field with the given operators, all operators if none is given
+func WithFilter(field string, ops ...storage.Op) QueryBinderOption {
+	return func(b *QueryBinder) {
+		b.filters[field] = ops
+	}
+}
+
+// WithSort allows sorting by the given fields
+func WithSort(fields ...string) QueryBinderOption {
+	return func(b *QueryBinder) {
+		for _, f := range fields {
+			b.sorts[f] = true
+		}
+	}
+}
+
+// WithFields allows selecting the given fields
+func WithFields(fields ...string) QueryBinderOption {
+	return func(b *QueryBinder) {
+		for _, f := range fields {
+			b.fields[f] = true
+		}
+	}
+}
+
+// WithInclude allows including the given associations
+func WithInclude(associations ...string) QueryBinderOption {
+	return func(b *QueryBinder) {
+		for _, a := range associations {
+			b.includes[a] = true
+		}
+	}
+}
+
+// WithDefaultLimit sets the page size when limit is not given, default 20
+func WithDefaultLimit(n int) QueryBinderOption {
+	return func(b *QueryBinder) {
+		b.defaultLimit = n
+	}
+}
+
+// WithMaxLimit sets the maximum page size, default 100
+func WithMaxLimit(n int) QueryBinderOption {
+	return func(b *QueryBinder) {
+		b.maxLimit = n
+	}
+}
+
+// WithDefaultSort sets the sort when sort is not given, e.g. -created_at
+func WithDefaultSort(sort string) QueryBinderOption {
+	return func(b *QueryBinder) {
+		b.defaultSort = sort
+	}
+}
+
+// Bind parses the query string of the request
+func (b *QueryBinder) Bind(c *gin.Context) (*storage.Query, error) {
+	return b.Parse(c.Request.URL.Query())
+}
+
+// Parse parses query string values into a validated storage.Query
+func (b *QueryBinder) Parse(values url.Values) (*storage.Query, error) {
+	query := &storage.Query{
+		Page:   _defaultCurrentPage,
+		Size:   b.defaultLimit,
+		Cursor: values.Get("cursor"),
+	}
+
+	var err error
+	if v := values.Get("page"); v != "" {
+		if query.Page, err = strconv.Atoi(v); err != nil || query.Page < 1 {
+			return nil, invalidQuery("invalid page %s", v)
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		if query.Size, err = strconv.Atoi(v); err != nil || query.Size < 1 {
+			return nil, invalidQuery("invalid limit %s", v)
+		}
+		if query.Size > b.maxLimit {
+			return nil, invalidQuery("limit %d exceeds the maximum %d", query.Size, b.maxLimit)
+		}
+	}
+
+	if query.Where, err = b.parseFilters(values); err != nil {
+		return nil, err
+	}
+
+	sortValue := values.Get("sort")
+	if sortValue == "" {
+		sortValue = b.defaultSort
+	}
+	if query.Sort, err = b.parseSort(sortValue); err != nil {
+		return nil, err
+	}
+
+	if query.Fields, err = parseList(values.Get("fields"), b.fields, "field"); err != nil {
+		return nil, err
+	}
+	if query.Include, err = parseList(values.Get("include"), b.includes, "include"); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// parseFilters parses the filter parameters into conditions combined by AND
+func (b *QueryBinder) parseFilters(values url.Values) (storage.Expr, error) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if strings.HasPrefix(key, "filter[") {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	sort.Strings(keys)
+
+	var conds []storage.Expr
+	for _, key := range keys {
+		m := filterKeyPattern.FindStringSubmatch(key)
+		if m == nil {
+			return nil, invalidQuery("invalid filter %s", key)
+		}
+		field, op := m[1], storage.Op(m[2])
+		if op == "" {
+			op = storage.OpEq
+		}
+		if !b.filterable(field, op) {
+			return nil, invalidQuery("filter %s on field %s is not allowed", op, field)
+		}
+		for _, v := range values[key] {
+			cond, err := condition(field, op, v)
+			if err != nil {
+				return nil, err
+			}
+			conds = append(conds, cond)
+		}
+	}
+	return storage.And(conds...), nil
+}
+
+// filterable reports whether field can be filtered with op
+func (b *QueryBinder) filterable(field string, op storage.Op) bool {
+	ops, ok := b.filters[field]
+	if !ok {
+		return false
+	}
+	if len(ops) == 0 {
+		return true
+	}
+	for _, allowed := range ops {
+		if allowed == op {
+			return true
+		}
+	}
+	return false
+}
+
+// condition builds the condition of a filter parameter
+func condition(field string, op storage.Op, value string) (storage.Condition, error) {
+	switch op {
+	case storage.OpEq, storage.OpNe, storage.OpGt, storage.OpGte, storage.OpLt, storage.OpLte,
+		storage.OpLike, storage.OpILike:
+		return storage.Condition{Field: field, Op: op, Value: value}, nil
+	case storage.OpIn, storage.OpNin:
+		return storage.Condition{Field: field, Op: op, Value: splitList(value)}, nil
+	case storage.OpBetween:
+		bounds := splitList(value)
+		if len(bounds) != 2 {
+			return storage.Condition{}, invalidQuery("filter between on field %s needs two values separated by a comma", field)
+		}
+		return storage.Between(field, bounds[0], bounds[1]), nil
+	case storage.OpIsNull:
+		null, err := strconv.ParseBool(value)
+		if err != nil {
+			return storage.Condition{}, invalidQuery("filter isnull on field %s needs true or false", field)
+		}
+		return storage.IsNull(field, null), nil
+	default:
+		return storage.Condition{}, invalidQuery("unknown filter operator %s", op)
+	}
+}
+
+// parseSort parses a sort parameter such as -created_at,name
+func (b *QueryBinder) parseSort(value string) ([]storage.Sort, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var result []storage.Sort
+	for _, field := range splitList(value) {
+		s := storage.Asc(field)
+		if name, ok := strings.CutPrefix(field, "-"); ok {
+			s = storage.Desc(name)
+		}
+		if !b.sorts[s.Field] {
+			return nil, invalidQuery("sorting by field %s is not allowed", s.Field)
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// parseList parses a comma separated list whose items must be allowed
+func parseList(value string, allowed map[string]bool, kind string) ([]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	items := splitList(value)
+	for _, item := range items {
+		if !allowed[item] {
+			return nil, invalidQuery("%s %s is not allowed", kind, item)
+		}
+	}
+	return items, nil
+}
+
+// queryError is an invalid query string, it is classified with storage.ErrInvalidFilter
+// so AbortWithStorageError answers it with 400
+type queryError struct {
+	err error
+}
+
+// Error implements error
+func (e *queryError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns storage.ErrInvalidFilter and the error, so errors.Is matches both
+func (e *queryError) Unwrap() []error {
+	return []error{storage.ErrInvalidFilter, e.err}
+}
+
+// invalidQuery returns an error classified with storage.ErrInvalidFilter
+func invalidQuery(format string, a ...any) error {
+	return &queryError{err: fmt.Errorf(format, a...)}
+}
+
+// splitList splits a comma separated list, ignoring empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,145 @@
+package ginserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/fize/go-ext/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func testBinder() *QueryBinder {
+	return NewQueryBinder(
+		WithFilter("name"),
+		WithFilter("age", storage.OpGt, storage.OpBetween),
+		WithFilter("status", storage.OpIn),
+		WithFilter("email", storage.OpIsNull),
+		WithSort("name", "created_at"),
+		WithFields("id", "name"),
+		WithInclude("RelatedModels"),
+		WithMaxLimit(50),
+	)
+}
+
+func TestQueryBinder_Parse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  *storage.Query
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  &storage.Query{Page: 1, Size: 20},
+		},
+		{
+			name:  "pagination",
+			query: "page=3&limit=50",
+			want:  &storage.Query{Page: 3, Size: 50},
+		},
+		{
+			name:  "filters",
+			query: "filter[name]=foo&filter[age][gt]=18&filter[status][in]=a,b&filter[email][isnull]=true",
+			want: &storage.Query{
+				Page: 1,
+				Size: 20,
+				Where: storage.And(
+					storage.Condition{Field: "age", Op: storage.OpGt, Value: "18"},
+					storage.IsNull("email", true),
+					storage.Condition{Field: "name", Op: storage.OpEq, Value: "foo"},
+					storage.Condition{Field: "status", Op: storage.OpIn, Value: []string{"a", "b"}},
+				),
+			},
+		},
+		{
+			name:  "between",
+			query: "filter[age][between]=18,30",
+			want: &storage.Query{
+				Page:  1,
+				Size:  20,
+				Where: storage.And(storage.Between("age", "18", "30")),
+			},
+		},
+		{
+			name:  "cursor",
+			query: "cursor=abc.def&limit=10",
+			want:  &storage.Query{Page: 1, Size: 10, Cursor: "abc.def"},
+		},
+		{
+			name:  "sort fields and include",
+			query: "sort=-created_at,name&fields=id,name&include=RelatedModels",
+			want: &storage.Query{
+				Page:    1,
+				Size:    20,
+				Sort:    []storage.Sort{storage.Desc("created_at"), storage.Asc("name")},
+				Fields:  []string{"id", "name"},
+				Include: []string{"RelatedModels"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			assert.NoError(t, err)
+			got, err := testBinder().Parse(values)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestQueryBinder_ParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{"unknown filter field", "filter[password]=x", "filter eq on field password is not allowed"},
+		{"operator not allowed", "filter[age][like]=1", "filter like on field age is not allowed"},
+		{"unknown operator", "filter[name][regex]=x", "unknown filter operator regex"},
+		{"malformed filter", "filter[name=x", "invalid filter filter[name"},
+		{"between needs two values", "filter[age][between]=1", "filter between on field age needs two values separated by a comma"},
+		{"isnull needs a bool", "filter[email][isnull]=maybe", "filter isnull on field email needs true or false"},
+		{"sort not allowed", "sort=-age", "sorting by field age is not allowed"},
+		{"field not allowed", "fields=id,password", "field password is not allowed"},
+		{"include not allowed", "include=Secrets", "include Secrets is not allowed"},
+		{"invalid page", "page=0", "invalid page 0"},
+		{"invalid limit", "limit=abc", "invalid limit abc"},
+		{"limit too large", "limit=51", "limit 51 exceeds the maximum 50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			assert.NoError(t, err)
+			_, err = testBinder().Parse(values)
+			assert.EqualError(t, err, tt.wantErr)
+			assert.ErrorIs(t, err, storage.ErrInvalidFilter)
+		})
+	}
+}
+
+func TestQueryBinder_DefaultSort(t *testing.T) {
+	b := NewQueryBinder(WithSort("created_at"), WithDefaultSort("-created_at"), WithDefaultLimit(10))
+	got, err := b.Parse(url.Values{})
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.Sort{storage.Desc("created_at")}, got.Sort)
+	assert.Equal(t, 10, got.Size)
+}
+
+func TestQueryBinder_Bind(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/users?filter[name][like]=jo%25&sort=name&page=2", nil)
+
+	got, err := testBinder().Bind(c)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, got.Page)
+	assert.Equal(t, []storage.Sort{storage.Asc("name")}, got.Sort)
+	assert.Equal(t, storage.And(storage.Like("name", "jo%")), got.Where)
+}
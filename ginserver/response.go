@@ -64,6 +64,32 @@ func ListResponse(total int, data any) *Response {
 	}
 }
 
+// CursorListData multiple data struct of cursor pagination
+type CursorListData struct {
+	// multiple data
+	Items any `json:"items,omitempty"`
+	// cursor of the next page, empty on the last page
+	Next string `json:"next,omitempty"`
+	// cursor of the previous page, empty on the first page
+	Prev string `json:"prev,omitempty"`
+}
+
+// CursorListResponse multiple data response of cursor pagination,
+// clients pass next or prev as the cursor query parameter to move between pages
+func CursorListResponse(next, prev string, data any) *Response {
+	return &Response{
+		State: State{
+			Code: 0,
+			Msg:  success,
+		},
+		Data: CursorListData{
+			Items: data,
+			Next:  next,
+			Prev:  prev,
+		},
+	}
+}
+
 // OkResponse success response without data
 func OkResponse() *Response {
 	return &Response{
@@ -1,6 +1,7 @@
 package ginserver
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -29,6 +30,17 @@ func TestListResponse(t *testing.T) {
 	assert.Equal(t, 2, resp.Data.(ListData).Total)
 }
 
+func TestCursorListResponse(t *testing.T) {
+	data := []string{"item1", "item2"}
+	resp := CursorListResponse("next", "", data)
+	assert.Equal(t, 0, resp.State.Code)
+	assert.Equal(t, CursorListData{Items: data, Next: "next"}, resp.Data)
+
+	body, err := json.Marshal(resp.Data)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"items":["item1","item2"],"next":"next"}`, string(body))
+}
+
 func TestOkResponse(t *testing.T) {
 	resp := OkResponse()
 	assert.Equal(t, 0, resp.State.Code)
@@ -6,6 +6,7 @@ import (
 
 	"github.com/fize/go-ext/config"
 	"go.uber.org/zap"
+	"gorm.io/gorm/logger"
 )
 
 var defaultLogger *Logger
@@ -146,3 +147,12 @@ func WithContext(ctx context.Context) *Logger {
 	}
 	return newLogger
 }
+
+// GormLogger returns a GORM logger that writes to the default logger at the given GORM level,
+// it discards the logs if the default logger is not initialized
+func GormLogger(level logger.LogLevel) *ZapGormLogger {
+	if defaultLogger == nil {
+		return NewZapGormLogger(zap.NewNop(), level)
+	}
+	return NewZapGormLogger(defaultLogger.baselogger, level)
+}
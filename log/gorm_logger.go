@@ -8,26 +8,37 @@ import (
 	"gorm.io/gorm/logger"
 )
 
-// ZapGormLogger is a logger that implements the GORM logger interface using zap
+// slow SQL threshold, slower statements are logged as warnings
+const _slowThreshold = 200 * time.Millisecond
+
+// ZapGormLogger is a logger that implements the GORM logger interface using zap.
+// The level follows GORM: Silent logs nothing, Error logs failed statements,
+// Warn adds slow statements and Info logs every statement.
 type ZapGormLogger struct {
 	logger *zap.Logger
+	level  logger.LogLevel
 }
 
 // NewZapGormLogger creates a new ZapGormLogger
 func NewZapGormLogger(zapLogger *zap.Logger, level logger.LogLevel) *ZapGormLogger {
 	return &ZapGormLogger{
 		logger: zapLogger,
+		level:  level,
 	}
 }
 
 // LogMode sets the log level
 func (l *ZapGormLogger) LogMode(level logger.LogLevel) logger.Interface {
 	newLogger := *l
+	newLogger.level = level
 	return &newLogger
 }
 
 // Info logs an info message
 func (l *ZapGormLogger) Info(ctx context.Context, msg string, data ...any) {
+	if l.level < logger.Info {
+		return
+	}
 	if traceID, ok := ctx.Value(traceIDKey).(string); ok && traceID != "" {
 		l.logger.With(zap.String(traceIDKey, traceID)).Sugar().Infow(msg, data...)
 		return
@@ -37,6 +48,9 @@ func (l *ZapGormLogger) Info(ctx context.Context, msg string, data ...any) {
 
 // Warn logs a warning message
 func (l *ZapGormLogger) Warn(ctx context.Context, msg string, data ...any) {
+	if l.level < logger.Warn {
+		return
+	}
 	if traceID, ok := ctx.Value(traceIDKey).(string); ok && traceID != "" {
 		l.logger.With(zap.String(traceIDKey, traceID)).Sugar().Warnw(msg, data...)
 		return
@@ -46,6 +60,9 @@ func (l *ZapGormLogger) Warn(ctx context.Context, msg string, data ...any) {
 
 // Error logs an error message
 func (l *ZapGormLogger) Error(ctx context.Context, msg string, data ...any) {
+	if l.level < logger.Error {
+		return
+	}
 	if traceID, ok := ctx.Value(traceIDKey).(string); ok && traceID != "" {
 		l.logger.With(zap.String(traceIDKey, traceID)).Sugar().Errorw(msg, data...)
 		return
@@ -55,9 +72,12 @@ func (l *ZapGormLogger) Error(ctx context.Context, msg string, data ...any) {
 
 // Trace logs a trace message
 func (l *ZapGormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
 	elapsed := time.Since(begin)
 	switch {
-	case err != nil:
+	case err != nil && l.level >= logger.Error:
 		sql, rows := fc()
 		if traceID, ok := ctx.Value(traceIDKey).(string); ok && traceID != "" {
 			l.logger.With(zap.String(traceIDKey, traceID)).Sugar().Errorw("trace",
@@ -74,7 +94,7 @@ func (l *ZapGormLogger) Trace(ctx context.Context, begin time.Time, fc func() (s
 			"rows", rows,
 			"sql", sql,
 		)
-	case elapsed > 200*time.Millisecond:
+	case elapsed > _slowThreshold && l.level >= logger.Warn:
 		sql, rows := fc()
 		if traceID, ok := ctx.Value(traceIDKey).(string); ok && traceID != "" {
 			l.logger.With(zap.String(traceIDKey, traceID)).Sugar().Warnw("trace",
@@ -89,7 +109,7 @@ func (l *ZapGormLogger) Trace(ctx context.Context, begin time.Time, fc func() (s
 			"rows", rows,
 			"sql", sql,
 		)
-	default:
+	case l.level >= logger.Info:
 		sql, rows := fc()
 		if traceID, ok := ctx.Value(traceIDKey).(string); ok && traceID != "" {
 			l.logger.With(zap.String(traceIDKey, traceID)).Sugar().Infow("trace",
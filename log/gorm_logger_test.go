@@ -77,3 +77,42 @@ func TestZapGormLogger_Trace(t *testing.T) {
 	assert.Contains(t, buf.String(), `"sql":"SELECT * FROM users"`)
 	assert.Contains(t, buf.String(), `"rows":10`)
 }
+
+func TestZapGormLogger_Level(t *testing.T) {
+	fc := func() (string, int64) {
+		return "SELECT * FROM users", 1
+	}
+	slow := time.Now().Add(-time.Second)
+
+	tests := []struct {
+		name  string
+		level logger.LogLevel
+		log   func(l logger.Interface)
+		want  bool
+	}{
+		{"silent error", logger.Silent, func(l logger.Interface) { l.Trace(context.Background(), time.Now(), fc, assert.AnError) }, false},
+		{"error error", logger.Error, func(l logger.Interface) { l.Trace(context.Background(), time.Now(), fc, assert.AnError) }, true},
+		{"error slow", logger.Error, func(l logger.Interface) { l.Trace(context.Background(), slow, fc, nil) }, false},
+		{"warn slow", logger.Warn, func(l logger.Interface) { l.Trace(context.Background(), slow, fc, nil) }, true},
+		{"warn statement", logger.Warn, func(l logger.Interface) { l.Trace(context.Background(), time.Now(), fc, nil) }, false},
+		{"info statement", logger.Info, func(l logger.Interface) { l.Trace(context.Background(), time.Now(), fc, nil) }, true},
+		{"warn info", logger.Warn, func(l logger.Interface) { l.Info(context.Background(), "info") }, false},
+		{"error warn", logger.Error, func(l logger.Interface) { l.Warn(context.Background(), "warn") }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zapLogger, buf := setupLogger()
+			tt.log(NewZapGormLogger(zapLogger, logger.Info).LogMode(tt.level))
+			assert.Equal(t, tt.want, buf.Len() > 0, buf.String())
+		})
+	}
+}
+
+func TestGormLoggerWithoutDefaultLogger(t *testing.T) {
+	saved := defaultLogger
+	defaultLogger = nil
+	defer func() { defaultLogger = saved }()
+
+	gormLogger := GormLogger(logger.Info)
+	assert.NotPanics(t, func() { gormLogger.Info(context.Background(), "info message") })
+}
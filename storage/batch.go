@@ -0,0 +1,292 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// default number of records written by one statement of Upsert and UpdateWhere
+const _defaultBatchSize = 100
+
+// Progress reports the progress of a batch operation after every batch
+type Progress struct {
+	// Done is the number of records written successfully
+	Done int
+	// Failed is the number of records of failed batches
+	Failed int
+	// Total is the number of records to write
+	Total int
+}
+
+// BatchFailure is a failed batch of a batch operation
+type BatchFailure struct {
+	// Offset is the position of the first record of the batch
+	Offset int
+	// Size is the number of records of the batch
+	Size int
+	// Err is the error of the batch
+	Err error
+}
+
+// BatchError is returned when batches of a batch operation failed, the other batches were written
+type BatchError struct {
+	// Done is the number of records written successfully
+	Done int
+	// Failed is the number of records of failed batches
+	Failed int
+	// Failures are the failed batches in order
+	Failures []BatchFailure
+}
+
+// Error implements error
+func (e *BatchError) Error() string {
+	first := e.Failures[0]
+	return fmt.Sprintf("%d of %d records not written in %d failed batches, first at record %d: %v",
+		e.Failed, e.Done+e.Failed, len(e.Failures), first.Offset, first.Err)
+}
+
+// Unwrap returns the errors of the failed batches
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		errs = append(errs, f.Err)
+	}
+	return errs
+}
+
+// batchOptions are the options of a batch operation
+type batchOptions struct {
+	size            int
+	progress        func(Progress)
+	continueOnError bool
+}
+
+// BatchOption is used to configure a batch operation
+type BatchOption func(*batchOptions)
+
+// WithBatchSize sets the number of records written by one statement of Upsert and UpdateWhere, default 100
+func WithBatchSize(size int) BatchOption {
+	return func(o *batchOptions) {
+		o.size = size
+	}
+}
+
+// WithProgress sets a callback called after every batch, e.g. to log the progress of an ingest job
+func WithProgress(fn func(Progress)) BatchOption {
+	return func(o *batchOptions) {
+		o.progress = fn
+	}
+}
+
+// WithContinueOnError continues with the next batches when a batch fails, instead of stopping.
+// Within a postgres transaction a failed statement aborts the transaction, so the next batches fail too.
+func WithContinueOnError() BatchOption {
+	return func(o *batchOptions) {
+		o.continueOnError = true
+	}
+}
+
+func newBatchOptions(opts []BatchOption) *batchOptions {
+	o := &batchOptions{size: _defaultBatchSize}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// batchRun records the results of the batches of an operation
+type batchRun struct {
+	opts  *batchOptions
+	total int
+	err   BatchError
+}
+
+// record records a batch of size records at offset and reports whether to continue
+func (r *batchRun) record(ctx context.Context, offset, size int, err error) bool {
+	if err != nil {
+		err = translateError(err)
+		r.err.Failed += size
+		r.err.Failures = append(r.err.Failures, BatchFailure{Offset: offset, Size: size, Err: err})
+	} else {
+		r.err.Done += size
+	}
+	if r.opts.progress != nil {
+		r.opts.progress(Progress{Done: r.err.Done, Failed: r.err.Failed, Total: r.total})
+	}
+	return err == nil || (r.opts.continueOnError && ctx.Err() == nil)
+}
+
+// result returns the BatchError of the run, nil if no batch failed
+func (r *batchRun) result() error {
+	if len(r.err.Failures) == 0 {
+		return nil
+	}
+	return &r.err
+}
+
+// CreateBatch implements Storage.CreateBatch
+func (s *sqlStorage) CreateBatch(ctx context.Context, models any, batchSize int, opts ...BatchOption) error {
+	o := newBatchOptions(opts)
+	o.size = batchSize
+	return s.inBatches(ctx, models, o, func(db *gorm.DB, batch any) error {
+		return db.Create(batch).Error
+	})
+}
+
+// Upsert implements Storage.Upsert
+func (s *sqlStorage) Upsert(ctx context.Context, models any, conflictColumns, updateColumns []string, opts ...BatchOption) error {
+	db := s.conn(ctx)
+	sch, err := parseSchema(db, models)
+	if err != nil {
+		return err
+	}
+
+	onConflict := clause.OnConflict{UpdateAll: len(updateColumns) == 0}
+	if len(conflictColumns) == 0 {
+		for _, field := range sch.PrimaryFields {
+			onConflict.Columns = append(onConflict.Columns, clause.Column{Name: field.DBName})
+		}
+	}
+	for _, name := range conflictColumns {
+		column, err := lookupColumn(sch, name)
+		if err != nil {
+			return invalidFilter("invalid upsert: %v", err)
+		}
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: column})
+	}
+	columns := make([]string, 0, len(updateColumns))
+	for _, name := range updateColumns {
+		column, err := lookupColumn(sch, name)
+		if err != nil {
+			return invalidFilter("invalid upsert: %v", err)
+		}
+		columns = append(columns, column)
+	}
+	if len(columns) > 0 {
+		onConflict.DoUpdates = clause.AssignmentColumns(columns)
+	}
+	if cond := tenantConditionOf(ctx, sch.Table); cond != nil {
+		onConflict = cond.guard(db.Dialector.Name(), sch, onConflict)
+	}
+
+	return s.inBatches(ctx, models, newBatchOptions(opts), func(db *gorm.DB, batch any) error {
+		return db.Clauses(onConflict).Create(batch).Error
+	})
+}
+
+// inBatches calls write with the batches of models, a slice or a pointer to it.
+// The batches share the array of models, so generated primary keys are set on models.
+func (s *sqlStorage) inBatches(ctx context.Context, models any, o *batchOptions, write func(db *gorm.DB, batch any) error) error {
+	rv := reflect.Indirect(reflect.ValueOf(models))
+	if rv.Kind() != reflect.Slice {
+		return fmt.Errorf("models must be a slice, got %T", models)
+	}
+	total := rv.Len()
+	size := o.size
+	if size <= 0 {
+		size = total
+	}
+
+	run := &batchRun{opts: o, total: total}
+	for offset := 0; offset < total; offset += size {
+		end := min(offset+size, total)
+		batch := reflect.New(rv.Type())
+		batch.Elem().Set(rv.Slice(offset, end))
+		if !run.record(ctx, offset, end-offset, write(s.conn(ctx), batch.Interface())) {
+			break
+		}
+	}
+	return run.result()
+}
+
+// UpdateWhere implements Storage.UpdateWhere
+func (s *sqlStorage) UpdateWhere(ctx context.Context, query *Query, model any, values map[string]any, opts ...BatchOption) (int64, error) {
+	if len(values) == 0 {
+		return 0, invalidFilter("invalid update: no values")
+	}
+	if len(query.Filter) == 0 && query.Where == nil {
+		return 0, invalidFilter("filter cannot be empty")
+	}
+	db := s.conn(ctx)
+	sch, err := parseSchema(db, model)
+	if err != nil {
+		return 0, err
+	}
+	pk := sch.PrioritizedPrimaryField
+	if pk == nil {
+		return 0, fmt.Errorf("%s has no primary key", sch.Name)
+	}
+
+	version := versionField(sch)
+	assignments := make(map[string]any, len(values)+1)
+	for key, value := range values {
+		field := sch.LookUpField(key)
+		if field == nil || field.DBName == "" {
+			return 0, invalidFilter("invalid update: unknown column %s", key)
+		}
+		if field.PrimaryKey {
+			return 0, invalidFilter("invalid update: cannot change the primary key %s", field.DBName)
+		}
+		assignments[field.DBName] = value
+	}
+	if version != nil {
+		assignments[version.DBName] = gorm.Expr("? + 1", clause.Column{Name: version.DBName})
+	}
+
+	o := newBatchOptions(opts)
+	run := &batchRun{opts: o, total: -1}
+	if o.progress != nil {
+		matching, err := s.Count(ContextWithPrimary(ctx), query, model)
+		if err != nil {
+			return 0, err
+		}
+		run.total = int(matching)
+	}
+	size := o.size
+	if size <= 0 {
+		size = _defaultBatchSize
+	}
+
+	// Walk the matching records in primary key order, so updated records are not visited again
+	column := clause.Column{Table: clause.CurrentTable, Name: pk.DBName}
+	var rows int64
+	var last any
+	for {
+		db, err := where(s.conn(ctx), query, model)
+		if err != nil {
+			return rows, err
+		}
+		if last != nil {
+			db = db.Where(clause.Gt{Column: column, Value: last})
+		}
+		ids := reflect.New(reflect.SliceOf(pk.FieldType))
+		if err := db.Order(clause.OrderByColumn{Column: column}).Limit(size).Pluck(pk.DBName, ids.Interface()).Error; err != nil {
+			return rows, translateError(err)
+		}
+		n := ids.Elem().Len()
+		if n == 0 {
+			break
+		}
+		in := make([]any, n)
+		for i := range in {
+			in[i] = ids.Elem().Index(i).Interface()
+		}
+		last = in[n-1]
+
+		update := s.conn(ctx).Model(model)
+		if query.IncludeDeleted {
+			update = update.Unscoped()
+		}
+		result := update.Where(clause.IN{Column: column, Values: in}).Updates(maps.Clone(assignments))
+		rows += result.RowsAffected
+		if !run.record(ctx, run.err.Done+run.err.Failed, n, result.Error) || n < size {
+			break
+		}
+	}
+	return rows, run.result()
+}
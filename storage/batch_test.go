@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tag is a model with a unique column
+type Tag struct {
+	ID    uint64 `gorm:"primaryKey"`
+	Name  string `gorm:"uniqueIndex"`
+	Views int
+}
+
+func setupTags(t *testing.T, names ...string) *Repository[Tag] {
+	t.Helper()
+	db := setupSqliteDB(t)
+	assert.NoError(t, db.AutoMigrate(&Tag{}, &Doc{}))
+	repo := NewRepository[Tag](&sqlStorage{db: db})
+	for _, name := range names {
+		assert.NoError(t, repo.Create(context.Background(), &Tag{Name: name}))
+	}
+	return repo
+}
+
+func tags(names ...string) []Tag {
+	result := make([]Tag, 0, len(names))
+	for _, name := range names {
+		result = append(result, Tag{Name: name})
+	}
+	return result
+}
+
+func TestCreateBatch(t *testing.T) {
+	repo := setupTags(t)
+	ctx := context.Background()
+
+	var progress []Progress
+	models := tags("a", "b", "c", "d", "e", "f", "g")
+	err := repo.CreateBatch(ctx, models, 3, WithProgress(func(p Progress) {
+		progress = append(progress, p)
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, []Progress{{Done: 3, Total: 7}, {Done: 6, Total: 7}, {Done: 7, Total: 7}}, progress)
+	for _, m := range models {
+		assert.NotZero(t, m.ID)
+	}
+
+	n, err := repo.Count(ctx, Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), n)
+
+	assert.EqualError(t, repo.Storage().CreateBatch(ctx, &Tag{}, 10), "models must be a slice, got *storage.Tag")
+	assert.NoError(t, repo.CreateBatch(ctx, nil, 10))
+}
+
+func TestCreateBatchPartialFailure(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []BatchOption
+		wantDone     int
+		wantFailures []BatchFailure
+		wantCount    int64
+	}{
+		{
+			name:         "stop at the first failure",
+			wantFailures: []BatchFailure{{Offset: 2, Size: 2}},
+			wantDone:     2,
+			wantCount:    3,
+		},
+		{
+			name:         "continue on error",
+			opts:         []BatchOption{WithContinueOnError()},
+			wantFailures: []BatchFailure{{Offset: 2, Size: 2}},
+			wantDone:     3,
+			wantCount:    4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := setupTags(t, "c")
+			ctx := context.Background()
+
+			// The batch with c violates the unique index
+			err := repo.CreateBatch(ctx, tags("a", "b", "c", "d", "e"), 2, tt.opts...)
+			var berr *BatchError
+			if !errors.As(err, &berr) {
+				t.Fatalf("CreateBatch() error = %v, want *BatchError", err)
+			}
+			assert.Equal(t, tt.wantDone, berr.Done)
+			assert.Equal(t, 2, berr.Failed)
+			if assert.Len(t, berr.Failures, len(tt.wantFailures)) {
+				for i, f := range tt.wantFailures {
+					assert.Equal(t, f.Offset, berr.Failures[i].Offset)
+					assert.Equal(t, f.Size, berr.Failures[i].Size)
+					assert.ErrorContains(t, berr.Failures[i].Err, "UNIQUE constraint failed")
+				}
+			}
+			assert.Len(t, berr.Unwrap(), len(tt.wantFailures))
+			assert.Contains(t, err.Error(), fmt.Sprintf("2 of %d records not written in 1 failed batches, first at record 2", tt.wantDone+2))
+
+			n, err := repo.Count(ctx, Query{})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantCount, n)
+		})
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	repo := setupTags(t, "a", "b")
+	ctx := context.Background()
+
+	models := []Tag{{Name: "b", Views: 5}, {Name: "c", Views: 1}}
+	err := repo.Storage().Upsert(ctx, models, []string{"name"}, []string{"views"}, WithBatchSize(1))
+	assert.NoError(t, err)
+
+	page, err := repo.List(ctx, Query{Sort: []Sort{Asc("name")}})
+	assert.NoError(t, err)
+	assert.Len(t, page.Items, 3)
+	assert.Equal(t, []int{0, 5, 1}, []int{page.Items[0].Views, page.Items[1].Views, page.Items[2].Views})
+
+	err = repo.Storage().Upsert(ctx, models, []string{"password"}, nil)
+	assert.EqualError(t, err, "invalid upsert: unknown column password")
+	err = repo.Storage().Upsert(ctx, models, nil, []string{"password"})
+	assert.EqualError(t, err, "invalid upsert: unknown column password")
+}
+
+// TestUpsertMySQL verifies the upsert statement of mysql
+func TestUpsertMySQL(t *testing.T) {
+	db, mock, err := setupMockDB()
+	assert.NoError(t, err)
+	store := &sqlStorage{db: db}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `tags` (`name`,`views`) VALUES (?,?),(?,?) ON DUPLICATE KEY UPDATE `views`=VALUES(`views`)")).
+		WithArgs("a", 1, "b", 2).
+		WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectCommit()
+
+	err = store.Upsert(context.Background(), []Tag{{Name: "a", Views: 1}, {Name: "b", Views: 2}}, []string{"name"}, []string{"views"})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateWhere(t *testing.T) {
+	repo := setupTags(t)
+	docs := NewRepository[Doc](repo.Storage())
+	ctx := context.Background()
+	for i := 1; i <= 5; i++ {
+		assert.NoError(t, docs.Create(ctx, &Doc{Title: fmt.Sprintf("d%d", i), Views: i, Version: 1}))
+	}
+
+	var progress []Progress
+	rows, err := docs.UpdateWhere(ctx, Query{Where: Gte("views", 2)}, map[string]any{"title": "popular"},
+		WithBatchSize(2), WithProgress(func(p Progress) { progress = append(progress, p) }))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), rows)
+	assert.Equal(t, []Progress{{Done: 2, Total: 4}, {Done: 4, Total: 4}}, progress)
+
+	n, err := docs.Count(ctx, Query{Filter: map[string]any{"title": "popular", "version": 2}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+
+	_, err = docs.UpdateWhere(ctx, Query{}, map[string]any{"title": "x"})
+	assert.EqualError(t, err, "filter cannot be empty")
+	_, err = docs.UpdateWhere(ctx, Query{Where: Eq("id", 1)}, nil)
+	assert.EqualError(t, err, "invalid update: no values")
+	_, err = docs.UpdateWhere(ctx, Query{Where: Eq("id", 1)}, map[string]any{"secret": 1})
+	assert.EqualError(t, err, "invalid update: unknown column secret")
+	_, err = docs.UpdateWhere(ctx, Query{Where: Eq("id", 1)}, map[string]any{"id": 2})
+	assert.EqualError(t, err, "invalid update: cannot change the primary key id")
+}
+
+func TestUpdateWherePartialFailure(t *testing.T) {
+	repo := setupTags(t, "a", "b", "c")
+	ctx := context.Background()
+
+	// The second record cannot get the same unique name
+	rows, err := repo.UpdateWhere(ctx, Query{Where: In("name", "a", "b", "c")}, map[string]any{"name": "same"}, WithBatchSize(1))
+	assert.Equal(t, int64(1), rows)
+	var berr *BatchError
+	if assert.True(t, errors.As(err, &berr)) {
+		assert.Equal(t, 1, berr.Done)
+		assert.Equal(t, 1, berr.Failed)
+		assert.Equal(t, 1, berr.Failures[0].Offset)
+	}
+}
@@ -0,0 +1,391 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fize/go-ext/ginserver/middleware"
+	"github.com/fize/go-ext/log"
+	"go.opentelemetry.io/otel/attribute"
+	api "go.opentelemetry.io/otel/metric"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+)
+
+// default time to live of cached reads
+const _defaultCacheTTL = time.Minute
+
+// Cache is the backend of a CachedStorage, e.g. an LRUCache or a Redis-like store shared by the instances of a service
+type Cache interface {
+	// Get returns the value of key, false if it is missing or expired
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores the value of key, it does not expire if ttl is 0
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// CacheStats are the hits and misses of a CachedStorage
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// CachedStorage is a Storage caching the results of Get and GetBy.
+// Results are cached with encoding/gob under the generation of their table, a write to a table starts a new generation,
+// so the cached reads of the table are not used anymore and expire with their ttl. Concurrent misses of
+// the same read are collapsed into one query. Reads in a transaction are not cached, writes in a transaction
+// invalidate the cache after the transaction.
+type CachedStorage struct {
+	Storage
+	core *cacheCore
+	// tx collects the tables written in a transaction, nil outside transactions
+	tx *txTables
+}
+
+// cacheCore is the cache shared by a CachedStorage and its transactions
+type cacheCore struct {
+	cache  Cache
+	ttl    time.Duration
+	prefix string
+	group  singleflight.Group
+
+	hits, misses        atomic.Uint64
+	hitCount, missCount api.Int64Counter
+}
+
+// txTables are the tables written in a transaction
+type txTables struct {
+	mu     sync.Mutex
+	tables map[string]struct{}
+}
+
+// CacheOption is used to configure the CachedStorage
+type CacheOption func(*cacheCore)
+
+// WithCache sets the cache backend, default an LRUCache of 1024 entries
+func WithCache(c Cache) CacheOption {
+	return func(core *cacheCore) {
+		core.cache = c
+	}
+}
+
+// WithCacheTTL sets the time to live of cached reads, default 1m
+func WithCacheTTL(ttl time.Duration) CacheOption {
+	return func(core *cacheCore) {
+		core.ttl = ttl
+	}
+}
+
+// WithCachePrefix sets the prefix of the cache keys, e.g. the service name for a shared cache
+func WithCachePrefix(prefix string) CacheOption {
+	return func(core *cacheCore) {
+		core.prefix = prefix
+	}
+}
+
+// NewCachedStorage creates a new CachedStorage caching the reads of s.
+// Hits and misses are counted by Stats and exported once the metrics middleware is set up.
+func NewCachedStorage(s Storage, opts ...CacheOption) *CachedStorage {
+	core := &cacheCore{ttl: _defaultCacheTTL}
+	for _, opt := range opts {
+		opt(core)
+	}
+	if core.cache == nil {
+		core.cache = NewLRUCache(_defaultCacheSize)
+	}
+	if meter := middleware.Meter(); meter != nil {
+		if err := core.registerMetrics(meter); err != nil {
+			log.Warnf("failed to register database cache metrics: %v", err)
+		}
+	}
+	return &CachedStorage{Storage: s, core: core}
+}
+
+// registerMetrics creates the hit and miss counters with meter
+func (core *cacheCore) registerMetrics(meter api.Meter) error {
+	var err error
+	if core.hitCount, err = meter.Int64Counter("db_cache_hits", api.WithDescription("number of reads served by the cache")); err != nil {
+		return err
+	}
+	core.missCount, err = meter.Int64Counter("db_cache_misses", api.WithDescription("number of reads missing the cache"))
+	return err
+}
+
+// Stats returns the hits and misses of the cache
+func (c *CachedStorage) Stats() CacheStats {
+	return CacheStats{Hits: c.core.hits.Load(), Misses: c.core.misses.Load()}
+}
+
+// Unwrap returns the cached storage
+func (c *CachedStorage) Unwrap() Storage {
+	return c.Storage
+}
+
+// Transaction implements Storage.Transaction, the tables written in the transaction are invalidated after it
+func (c *CachedStorage) Transaction(ctx context.Context, fn func(tx Storage) error, opts ...TxOption) error {
+	pending := c.pending(ctx)
+	if pending == nil {
+		tables := &txTables{tables: make(map[string]struct{})}
+		defer func() {
+			for table := range tables.tables {
+				c.core.invalidate(ctx, table)
+			}
+		}()
+		pending = tables
+	}
+	return c.Storage.Transaction(ctx, func(tx Storage) error {
+		return fn(&CachedStorage{Storage: tx, core: c.core, tx: pending})
+	}, opts...)
+}
+
+// Get implements Storage.Get
+func (c *CachedStorage) Get(ctx context.Context, id uint64, result any) error {
+	return c.read(ctx, result, "get:"+strconv.FormatUint(id, 10), func(ctx context.Context, result any) error {
+		return c.Storage.Get(ctx, id, result)
+	})
+}
+
+// GetBy implements Storage.GetBy
+func (c *CachedStorage) GetBy(ctx context.Context, filter map[string]any, result any) error {
+	// Map keys are sorted by json, so equal filters have the same key
+	data, err := json.Marshal(filter)
+	if err != nil {
+		return c.Storage.GetBy(ctx, filter, result)
+	}
+	return c.read(ctx, result, "getby:"+string(data), func(ctx context.Context, result any) error {
+		return c.Storage.GetBy(ctx, filter, result)
+	})
+}
+
+// Create implements Storage.Create
+func (c *CachedStorage) Create(ctx context.Context, model any) error {
+	defer c.invalidate(ctx, model)
+	return c.Storage.Create(ctx, model)
+}
+
+// CreateBatch implements Storage.CreateBatch
+func (c *CachedStorage) CreateBatch(ctx context.Context, models any, batchSize int, opts ...BatchOption) error {
+	defer c.invalidate(ctx, models)
+	return c.Storage.CreateBatch(ctx, models, batchSize, opts...)
+}
+
+// Upsert implements Storage.Upsert
+func (c *CachedStorage) Upsert(ctx context.Context, models any, conflictColumns, updateColumns []string, opts ...BatchOption) error {
+	defer c.invalidate(ctx, models)
+	return c.Storage.Upsert(ctx, models, conflictColumns, updateColumns, opts...)
+}
+
+// Update implements Storage.Update
+func (c *CachedStorage) Update(ctx context.Context, id uint64, data any) error {
+	defer c.invalidate(ctx, data)
+	return c.Storage.Update(ctx, id, data)
+}
+
+// UpdateBy implements Storage.UpdateBy
+func (c *CachedStorage) UpdateBy(ctx context.Context, filter map[string]any, data any) (int64, error) {
+	defer c.invalidate(ctx, data)
+	return c.Storage.UpdateBy(ctx, filter, data)
+}
+
+// UpdateWhere implements Storage.UpdateWhere
+func (c *CachedStorage) UpdateWhere(ctx context.Context, query *Query, model any, values map[string]any, opts ...BatchOption) (int64, error) {
+	defer c.invalidate(ctx, model)
+	return c.Storage.UpdateWhere(ctx, query, model, values, opts...)
+}
+
+// Patch implements Storage.Patch
+func (c *CachedStorage) Patch(ctx context.Context, id uint64, model any, changes map[string]any) error {
+	defer c.invalidate(ctx, model)
+	return c.Storage.Patch(ctx, id, model, changes)
+}
+
+// PatchFields implements Storage.PatchFields
+func (c *CachedStorage) PatchFields(ctx context.Context, id uint64, model any, fields ...string) error {
+	defer c.invalidate(ctx, model)
+	return c.Storage.PatchFields(ctx, id, model, fields...)
+}
+
+// Delete implements Storage.Delete
+func (c *CachedStorage) Delete(ctx context.Context, id uint64, model any) error {
+	defer c.invalidate(ctx, model)
+	return c.Storage.Delete(ctx, id, model)
+}
+
+// DeleteBy implements Storage.DeleteBy
+func (c *CachedStorage) DeleteBy(ctx context.Context, filter map[string]any, model any) error {
+	defer c.invalidate(ctx, model)
+	return c.Storage.DeleteBy(ctx, filter, model)
+}
+
+// Restore implements Storage.Restore
+func (c *CachedStorage) Restore(ctx context.Context, id uint64, model any) error {
+	defer c.invalidate(ctx, model)
+	return c.Storage.Restore(ctx, id, model)
+}
+
+// Purge implements Storage.Purge
+func (c *CachedStorage) Purge(ctx context.Context, id uint64, model any) error {
+	defer c.invalidate(ctx, model)
+	return c.Storage.Purge(ctx, id, model)
+}
+
+// read serves the read op of result from the cache, on a miss load reads it once for all concurrent callers
+func (c *CachedStorage) read(ctx context.Context, result any, op string, load func(ctx context.Context, result any) error) error {
+	if c.tx != nil {
+		return load(ctx, result)
+	}
+	if _, ok := TxFromContext(ctx); ok {
+		return load(ctx, result)
+	}
+
+	table := c.table(result)
+	// Results of several types may read the same table, e.g. a model and a summary of it
+	key := c.core.prefix + table + ":" + c.core.generation(ctx, table) + ":" + reflect.TypeOf(result).Elem().String() + ":" + op
+	// The reads of tenants are cached apart, e.g. when the cache is shared by their databases
+	if tenant, ok := TenantFromContext(ctx); ok {
+		key += ":tenant=" + tenant
+	}
+	if data, ok := c.core.get(ctx, key); ok && decodeResult(data, result) == nil {
+		c.core.count(ctx, table, true)
+		return nil
+	}
+	c.core.count(ctx, table, false)
+
+	// The query runs on behalf of every waiting caller, so it is not canceled with the first one
+	ch := c.core.group.DoChan(key, func() (any, error) {
+		fresh := reflect.New(reflect.TypeOf(result).Elem()).Interface()
+		if err := load(context.WithoutCancel(ctx), fresh); err != nil {
+			return nil, err
+		}
+		data, err := encodeResult(fresh)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode the cached result: %v", err)
+		}
+		c.core.set(ctx, key, data, c.core.ttl)
+		return data, nil
+	})
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case r := <-ch:
+		if r.Err != nil {
+			return r.Err
+		}
+		return decodeResult(r.Val.([]byte), result)
+	}
+}
+
+// encodeResult encodes a result for the cache. gob copies the fields themselves,
+// unlike JSON it ignores json tags such as json:"-" and custom MarshalJSON methods of API models.
+func encodeResult(result any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(result); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeResult decodes a cached result into result, replacing all its fields
+func decodeResult(data []byte, result any) error {
+	fresh := reflect.New(reflect.TypeOf(result).Elem())
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(fresh.Interface()); err != nil {
+		return err
+	}
+	reflect.ValueOf(result).Elem().Set(fresh.Elem())
+	return nil
+}
+
+// invalidate starts a new generation of the cached reads of the table of model,
+// in a transaction the table is invalidated after the transaction
+func (c *CachedStorage) invalidate(ctx context.Context, model any) {
+	table := c.table(model)
+	if pending := c.pending(ctx); pending != nil {
+		pending.mu.Lock()
+		pending.tables[table] = struct{}{}
+		pending.mu.Unlock()
+		return
+	}
+	c.core.invalidate(ctx, table)
+}
+
+// pending returns the tables written in the transaction of c or of ctx, nil outside transactions
+func (c *CachedStorage) pending(ctx context.Context) *txTables {
+	if c.tx != nil {
+		return c.tx
+	}
+	if tx, ok := TxFromContext(ctx); ok {
+		if cs, ok := tx.(*CachedStorage); ok && cs.core == c.core {
+			return cs.tx
+		}
+	}
+	return nil
+}
+
+// table returns the table of model, the name of its type if it is not a GORM model
+func (c *CachedStorage) table(model any) string {
+	if db, ok := c.Storage.Client().(*gorm.DB); ok {
+		if sch, err := parseSchema(db, model); err == nil {
+			return sch.Table
+		}
+	}
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.String()
+}
+
+// generation returns the current generation of table, a table without one gets a new generation,
+// so evicting the generation never brings back older cached reads
+func (core *cacheCore) generation(ctx context.Context, table string) string {
+	if data, ok := core.get(ctx, core.prefix+table+":gen"); ok {
+		return string(data)
+	}
+	return core.invalidate(ctx, table)
+}
+
+// invalidate starts a new generation of table and returns it
+func (core *cacheCore) invalidate(ctx context.Context, table string) string {
+	gen := strconv.FormatUint(rand.Uint64(), 36)
+	core.set(ctx, core.prefix+table+":gen", []byte(gen), 0)
+	return gen
+}
+
+// get returns the cached value of key, failures of the cache are logged and count as a miss
+func (core *cacheCore) get(ctx context.Context, key string) ([]byte, bool) {
+	data, ok, err := core.cache.Get(ctx, key)
+	if err != nil {
+		log.Warnf("failed to read cache key %s: %v", key, err)
+		return nil, false
+	}
+	return data, ok
+}
+
+// set caches the value of key, failures of the cache are logged
+func (core *cacheCore) set(ctx context.Context, key string, value []byte, ttl time.Duration) {
+	if err := core.cache.Set(ctx, key, value, ttl); err != nil {
+		log.Warnf("failed to write cache key %s: %v", key, err)
+	}
+}
+
+// count records a hit or a miss of a read of table
+func (core *cacheCore) count(ctx context.Context, table string, hit bool) {
+	counter := core.missCount
+	if hit {
+		core.hits.Add(1)
+		counter = core.hitCount
+	} else {
+		core.misses.Add(1)
+	}
+	if counter != nil {
+		counter.Add(ctx, 1, api.WithAttributes(attribute.String("db.table", table)))
+	}
+}
@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// countingStorage counts the reads reaching the database
+type countingStorage struct {
+	Storage
+	reads atomic.Int64
+	// release blocks the reads until it is closed if it is set
+	release chan struct{}
+}
+
+func (s *countingStorage) Get(ctx context.Context, id uint64, result any) error {
+	s.reads.Add(1)
+	if s.release != nil {
+		<-s.release
+	}
+	return s.Storage.Get(ctx, id, result)
+}
+
+func (s *countingStorage) GetBy(ctx context.Context, filter map[string]any, result any) error {
+	s.reads.Add(1)
+	return s.Storage.GetBy(ctx, filter, result)
+}
+
+func setupCache(t *testing.T) (*CachedStorage, *countingStorage) {
+	t.Helper()
+	counting := &countingStorage{Storage: &sqlStorage{db: setupSqliteDB(t)}}
+	cached := NewCachedStorage(counting)
+	assert.NoError(t, cached.Create(context.Background(), &TestModel{ID: 1, Name: "alice"}))
+	return cached, counting
+}
+
+func TestCachedStorage(t *testing.T) {
+	cached, counting := setupCache(t)
+	ctx := context.Background()
+
+	var model TestModel
+	for range 3 {
+		assert.NoError(t, cached.Get(ctx, 1, &model))
+		assert.Equal(t, "alice", model.Name)
+	}
+	for range 2 {
+		model = TestModel{}
+		assert.NoError(t, cached.GetBy(ctx, map[string]any{"name": "alice"}, &model))
+		assert.Equal(t, uint64(1), model.ID)
+	}
+	assert.Equal(t, int64(2), counting.reads.Load())
+	assert.Equal(t, CacheStats{Hits: 3, Misses: 2}, cached.Stats())
+
+	// A write to the table invalidates its cached reads
+	assert.NoError(t, cached.Update(ctx, 1, &TestModel{Name: "bob"}))
+	assert.NoError(t, cached.Get(ctx, 1, &model))
+	assert.Equal(t, "bob", model.Name)
+	assert.Equal(t, int64(3), counting.reads.Load())
+
+	// Missing records are not cached
+	assert.ErrorIs(t, cached.Get(ctx, 2, &model), gorm.ErrRecordNotFound)
+	assert.NoError(t, cached.Create(ctx, &TestModel{ID: 2, Name: "carol"}))
+	assert.NoError(t, cached.Get(ctx, 2, &model))
+	assert.Equal(t, "carol", model.Name)
+
+	// Writes to another table keep the cached reads
+	reads := counting.reads.Load()
+	assert.NoError(t, cached.Create(ctx, &RelatedTestModel{ModelID: 1}))
+	assert.NoError(t, cached.Get(ctx, 2, &model))
+	assert.Equal(t, reads, counting.reads.Load())
+}
+
+// Account is a model with fields left out of its JSON
+type Account struct {
+	ID     uint64 `gorm:"primaryKey" json:"id"`
+	Name   string `json:"name"`
+	Secret string `json:"-"`
+}
+
+func TestCachedStorageJSONTags(t *testing.T) {
+	db := setupSqliteDB(t)
+	assert.NoError(t, db.AutoMigrate(&Account{}))
+	counting := &countingStorage{Storage: &sqlStorage{db: db}}
+	cached := NewCachedStorage(counting)
+	ctx := context.Background()
+	assert.NoError(t, cached.Create(ctx, &Account{ID: 1, Name: "alice", Secret: "s3cret"}))
+
+	// Fields hidden from JSON are cached, and leftovers of result are replaced
+	for range 2 {
+		account := Account{Name: "stale"}
+		assert.NoError(t, cached.Get(ctx, 1, &account))
+		assert.Equal(t, Account{ID: 1, Name: "alice", Secret: "s3cret"}, account)
+	}
+	assert.Equal(t, int64(1), counting.reads.Load())
+}
+
+// AccountSummary reads the table of Account without its secret
+type AccountSummary struct {
+	ID   uint64
+	Name string
+}
+
+func (AccountSummary) TableName() string {
+	return "accounts"
+}
+
+func TestCachedStorageResultTypes(t *testing.T) {
+	db := setupSqliteDB(t)
+	assert.NoError(t, db.AutoMigrate(&Account{}))
+	cached := NewCachedStorage(&sqlStorage{db: db})
+	ctx := context.Background()
+	assert.NoError(t, cached.Create(ctx, &Account{ID: 1, Name: "alice", Secret: "s3cret"}))
+
+	// The cached summary is not served for the full model of the same table
+	var summary AccountSummary
+	assert.NoError(t, cached.Get(ctx, 1, &summary))
+	assert.Equal(t, AccountSummary{ID: 1, Name: "alice"}, summary)
+	var account Account
+	assert.NoError(t, cached.Get(ctx, 1, &account))
+	assert.Equal(t, Account{ID: 1, Name: "alice", Secret: "s3cret"}, account)
+	assert.Equal(t, CacheStats{Misses: 2}, cached.Stats())
+}
+
+func TestCachedStorageTransaction(t *testing.T) {
+	cached, counting := setupCache(t)
+	ctx := context.Background()
+
+	var model TestModel
+	assert.NoError(t, cached.Get(ctx, 1, &model))
+	err := cached.Transaction(ctx, func(tx Storage) error {
+		if err := tx.Update(ctx, 1, &TestModel{Name: "bob"}); err != nil {
+			return err
+		}
+		// Reads in the transaction see its writes
+		var inTx TestModel
+		if err := tx.Get(ctx, 1, &inTx); err != nil {
+			return err
+		}
+		assert.Equal(t, "bob", inTx.Name)
+		// Calls joining the transaction with the context do as well
+		txCtx := ContextWithTx(ctx, tx)
+		if err := cached.Get(txCtx, 1, &inTx); err != nil {
+			return err
+		}
+		assert.Equal(t, "bob", inTx.Name)
+		return cached.Update(txCtx, 1, &TestModel{Name: "carol"})
+	})
+	assert.NoError(t, err)
+	// The read joining the transaction with the context bypassed the cache
+	assert.Equal(t, int64(2), counting.reads.Load())
+
+	assert.NoError(t, cached.Get(ctx, 1, &model))
+	assert.Equal(t, "carol", model.Name)
+
+	// A rolled back transaction changes nothing
+	err = cached.Transaction(ctx, func(tx Storage) error {
+		if err := tx.Update(ctx, 1, &TestModel{Name: "dave"}); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	assert.EqualError(t, err, "rollback")
+	assert.NoError(t, cached.Get(ctx, 1, &model))
+	assert.Equal(t, "carol", model.Name)
+}
+
+func TestCachedStorageSingleflight(t *testing.T) {
+	cached, counting := setupCache(t)
+	counting.release = make(chan struct{})
+
+	const callers = 10
+	var wg sync.WaitGroup
+	names := make([]string, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var model TestModel
+			assert.NoError(t, cached.Get(context.Background(), 1, &model))
+			names[i] = model.Name
+		}()
+	}
+	// Wait for every caller to miss, then let the query finish
+	for cached.Stats().Misses < callers {
+		time.Sleep(time.Millisecond)
+	}
+	close(counting.release)
+	wg.Wait()
+
+	assert.Equal(t, int64(1), counting.reads.Load())
+	for _, name := range names {
+		assert.Equal(t, "alice", name)
+	}
+
+	// A canceled caller stops waiting
+	counting.release = make(chan struct{})
+	defer close(counting.release)
+	assert.NoError(t, cached.Update(context.Background(), 1, &TestModel{Name: "bob"}))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var model TestModel
+	assert.ErrorIs(t, cached.Get(ctx, 1, &model), context.DeadlineExceeded)
+}
+
+// failingCache fails every call
+type failingCache struct{}
+
+func (failingCache) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errors.New("unavailable")
+}
+
+func (failingCache) Set(context.Context, string, []byte, time.Duration) error {
+	return errors.New("unavailable")
+}
+
+func TestCachedStorageFailingCache(t *testing.T) {
+	counting := &countingStorage{Storage: &sqlStorage{db: setupSqliteDB(t)}}
+	cached := NewCachedStorage(counting, WithCache(failingCache{}), WithCachePrefix("app:"))
+	ctx := context.Background()
+	assert.NoError(t, cached.Create(ctx, &TestModel{ID: 1, Name: "alice"}))
+
+	// Reads fall back to the database
+	var model TestModel
+	for range 2 {
+		assert.NoError(t, cached.Get(ctx, 1, &model))
+		assert.Equal(t, "alice", model.Name)
+	}
+	assert.Equal(t, int64(2), counting.reads.Load())
+}
+
+func TestLRUCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRUCache(2)
+
+	assert.NoError(t, c.Set(ctx, "a", []byte("1"), 0))
+	assert.NoError(t, c.Set(ctx, "b", []byte("2"), 0))
+	// Reading a makes b the least recently used entry
+	value, ok, err := c.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+	assert.NoError(t, c.Set(ctx, "c", []byte("3"), 0))
+	assert.Equal(t, 2, c.Len())
+	_, ok, _ = c.Get(ctx, "b")
+	assert.False(t, ok)
+
+	// Entries expire with their ttl
+	assert.NoError(t, c.Set(ctx, "a", []byte("4"), time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+	_, ok, _ = c.Get(ctx, "a")
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.Len())
+	value, ok, _ = c.Get(ctx, "c")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("3"), value)
+}
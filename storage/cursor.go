@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrInvalidCursor is returned for cursors that are malformed, tampered with,
+// signed by another key or created for another sort order, it is an ErrInvalidFilter as well
+var ErrInvalidCursor error = &storageError{kind: ErrInvalidFilter, err: errors.New("invalid cursor")}
+
+// _processCursorKey signs the cursors of storages without a configured cursor secret
+var _processCursorKey = func() []byte {
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("failed to generate cursor key: %v", err))
+	}
+	return key
+}()
+
+// CursorPage describes the position of a page of cursor pagination
+type CursorPage struct {
+	// Next is the cursor of the following page, empty on the last page
+	Next string
+	// Prev is the cursor of the preceding page, empty on the first page
+	Prev string
+	// Total is the number of matching records, -1 when Query.SkipCount is set
+	Total int64
+}
+
+// cursor is the payload of a cursor token
+type cursor struct {
+	// Sort is the sort order the cursor was created for, e.g. ["-created_at", "id"]
+	Sort []string `json:"s"`
+	// Values are the sort key values of the row the cursor points at
+	Values []json.RawMessage `json:"v"`
+	// Prev is set for cursors pointing at the preceding page
+	Prev bool `json:"p,omitempty"`
+}
+
+// ListCursor implements Storage.ListCursor
+func (s *sqlStorage) ListCursor(ctx context.Context, query *Query, result any) (*CursorPage, error) {
+	if query.Size <= 0 {
+		return nil, invalidFilter("cursor pagination needs a page size")
+	}
+	db, err := where(s.reader(ctx), query, result)
+	if err != nil {
+		return nil, err
+	}
+	sch, err := parseSchema(db, result)
+	if err != nil {
+		return nil, err
+	}
+	if sch.PrioritizedPrimaryField == nil {
+		return nil, fmt.Errorf("cursor pagination needs a primary key on %s", sch.Name)
+	}
+	keys, err := sortKeys(sch, query.Sort)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if k.nulls != NullsDefault {
+			return nil, invalidFilter("cursor pagination does not support nulls order on %s", k.field.DBName)
+		}
+		// A NULL value of the cursor row would match no row with = or <, and end the pages early
+		if nullable(k.field) {
+			return nil, invalidFilter("cursor pagination does not support the nullable sort column %s", k.field.DBName)
+		}
+	}
+
+	page := &CursorPage{Total: -1}
+	if !query.SkipCount {
+		if err := db.Count(&page.Total).Error; err != nil {
+			return nil, translateError(err)
+		}
+	}
+
+	// Continue after or before the row of the cursor
+	var cur *cursor
+	if query.Cursor != "" {
+		if cur, err = s.decodeCursor(query.Cursor, keys); err != nil {
+			return nil, err
+		}
+		values, err := cursorValues(cur, keys)
+		if err != nil {
+			return nil, err
+		}
+		expr, err := compileExpr(db, result, keysetExpr(keys, values, cur.Prev))
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(expr)
+	}
+	backward := cur != nil && cur.Prev
+
+	// A preceding page is read in reverse order and reversed afterwards
+	db = db.Order(orderBy(db.Dialector.Name(), keys, backward))
+	columns := make([]string, 0, len(keys))
+	for _, k := range keys {
+		columns = append(columns, k.field.DBName)
+	}
+	// Read one more row to know whether there is another page
+	db = db.Limit(query.Size + 1)
+	if db, err = selectFields(db, query, result, columns...); err != nil {
+		return nil, err
+	}
+	if len(query.Preload) > 0 {
+		db = db.Preload(query.Preload)
+	}
+	if query.AllPreload {
+		db = db.Preload(clause.Associations)
+	}
+	if err := db.Find(result).Error; err != nil {
+		return nil, translateError(err)
+	}
+
+	rows := reflect.Indirect(reflect.ValueOf(result))
+	more := rows.Len() > query.Size
+	if more {
+		rows.Set(rows.Slice(0, query.Size))
+	}
+	if backward {
+		reverse(rows)
+	}
+	if rows.Len() == 0 {
+		return page, nil
+	}
+
+	first, last := rows.Index(0), rows.Index(rows.Len()-1)
+	hasPrev, hasNext := cur != nil, more
+	if backward {
+		hasPrev, hasNext = more, true
+	}
+	if hasPrev {
+		if page.Prev, err = s.encodeCursor(ctx, keys, first, true); err != nil {
+			return nil, err
+		}
+	}
+	if hasNext {
+		if page.Next, err = s.encodeCursor(ctx, keys, last, false); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// keysetExpr returns the condition of the rows after values in the order of keys,
+// or before them if backward is set, e.g. a > ? OR (a = ? AND b < ?)
+func keysetExpr(keys []sortKey, values []any, backward bool) Expr {
+	or := make([]Expr, 0, len(keys))
+	for i, k := range keys {
+		and := make([]Expr, 0, i+1)
+		for j := 0; j < i; j++ {
+			and = append(and, Eq(keys[j].field.DBName, values[j]))
+		}
+		if k.desc != backward {
+			and = append(and, Lt(k.field.DBName, values[i]))
+		} else {
+			and = append(and, Gt(k.field.DBName, values[i]))
+		}
+		or = append(or, And(and...))
+	}
+	return Or(or...)
+}
+
+// nullable reports whether the column of field can be NULL, a pointer or a sql.Null type with a Valid field
+// that is not tagged not null
+func nullable(field *schema.Field) bool {
+	if field.PrimaryKey || field.NotNull {
+		return false
+	}
+	switch t := field.FieldType; t.Kind() {
+	case reflect.Ptr:
+		return true
+	case reflect.Struct:
+		valid, ok := t.FieldByName("Valid")
+		return ok && valid.Type.Kind() == reflect.Bool
+	}
+	return false
+}
+
+// cursorValues decodes the sort key values of cur into the types of the fields
+func cursorValues(cur *cursor, keys []sortKey) ([]any, error) {
+	values := make([]any, len(keys))
+	for i, k := range keys {
+		v := reflect.New(k.field.FieldType)
+		if err := json.Unmarshal(cur.Values[i], v.Interface()); err != nil {
+			return nil, fmt.Errorf("%w: bad value of %s", ErrInvalidCursor, k.field.DBName)
+		}
+		values[i] = v.Elem().Interface()
+	}
+	return values, nil
+}
+
+// encodeCursor returns the signed cursor of row
+func (s *sqlStorage) encodeCursor(ctx context.Context, keys []sortKey, row reflect.Value, prev bool) (string, error) {
+	row = reflect.Indirect(row)
+	cur := cursor{Prev: prev}
+	for _, k := range keys {
+		value, _ := k.field.ValueOf(ctx, row)
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode cursor value of %s: %v", k.field.DBName, err)
+		}
+		cur.Sort = append(cur.Sort, k.String())
+		cur.Values = append(cur.Values, raw)
+	}
+	payload, err := json.Marshal(cur)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %v", err)
+	}
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(s.sign(payload)), nil
+}
+
+// decodeCursor verifies the signature of token and that it was created for keys
+func (s *sqlStorage) decodeCursor(token string, keys []sortKey) (*cursor, error) {
+	enc := base64.RawURLEncoding
+	p, m, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidCursor)
+	}
+	payload, err := enc.DecodeString(p)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidCursor)
+	}
+	mac, err := enc.DecodeString(m)
+	if err != nil || !hmac.Equal(mac, s.sign(payload)) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidCursor)
+	}
+
+	var cur cursor
+	if err := json.Unmarshal(payload, &cur); err != nil {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidCursor)
+	}
+	spec := make([]string, 0, len(keys))
+	for _, k := range keys {
+		spec = append(spec, k.String())
+	}
+	if !slices.Equal(cur.Sort, spec) || len(cur.Values) != len(keys) {
+		return nil, fmt.Errorf("%w: created for another sort order", ErrInvalidCursor)
+	}
+	return &cur, nil
+}
+
+// sign returns the HMAC of a cursor payload
+func (s *sqlStorage) sign(payload []byte) []byte {
+	key := s.cursorKey
+	if len(key) == 0 {
+		key = _processCursorKey
+	}
+	h := hmac.New(sha256.New, key)
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// reverse reverses the order of a slice
+func reverse(rows reflect.Value) {
+	swap := reflect.Swapper(rows.Interface())
+	for i, j := 0, rows.Len()-1; i < j; i, j = i+1, j-1 {
+		swap(i, j)
+	}
+}
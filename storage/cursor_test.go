@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// setupCursorStore creates people whose ages repeat, so the primary key breaks ties
+func setupCursorStore(t *testing.T) *sqlStorage {
+	t.Helper()
+	db := setupSqliteDB(t)
+	assert.NoError(t, db.AutoMigrate(&Person{}))
+	store := &sqlStorage{db: db, cursorKey: []byte("secret")}
+	for i, age := range []int{30, 20, 30, 40, 20, 30, 10} {
+		assert.NoError(t, store.Create(context.Background(), &Person{Name: fmt.Sprintf("p%d", i+1), Age: age}))
+	}
+	return store
+}
+
+func personNames(people []Person) []string {
+	names := make([]string, 0, len(people))
+	for _, p := range people {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func TestListCursor(t *testing.T) {
+	store := setupCursorStore(t)
+	ctx := context.Background()
+	query := &Query{Size: 3, Sort: []Sort{Desc("age")}}
+
+	// Walk forward through all pages
+	var pages [][]string
+	var page *CursorPage
+	for {
+		var people []Person
+		var err error
+		page, err = store.ListCursor(ctx, query, &people)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), page.Total)
+		pages = append(pages, personNames(people))
+		if page.Next == "" {
+			break
+		}
+		query.Cursor = page.Next
+	}
+	assert.Equal(t, [][]string{{"p4", "p6", "p3"}, {"p1", "p5", "p2"}, {"p7"}}, pages)
+
+	// Walk back from the last page
+	var back [][]string
+	for page.Prev != "" {
+		query.Cursor = page.Prev
+		var people []Person
+		var err error
+		page, err = store.ListCursor(ctx, query, &people)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, page.Next)
+		back = append(back, personNames(people))
+	}
+	assert.Equal(t, [][]string{{"p1", "p5", "p2"}, {"p4", "p6", "p3"}}, back)
+}
+
+func TestListCursorFirstPage(t *testing.T) {
+	store := setupCursorStore(t)
+	ctx := context.Background()
+
+	var people []Person
+	page, err := store.ListCursor(ctx, &Query{Size: 10, SkipCount: true, Where: Gte("age", 30)}, &people)
+	assert.NoError(t, err)
+	assert.Equal(t, &CursorPage{Total: -1}, page)
+	assert.Equal(t, []string{"p1", "p3", "p4", "p6"}, personNames(people))
+
+	_, err = store.ListCursor(ctx, &Query{}, &people)
+	assert.EqualError(t, err, "cursor pagination needs a page size")
+}
+
+func TestListCursorFields(t *testing.T) {
+	store := setupCursorStore(t)
+	ctx := context.Background()
+	query := &Query{Size: 2, Sort: []Sort{Asc("age")}, Fields: []string{"name"}}
+
+	var people []Person
+	page, err := store.ListCursor(ctx, query, &people)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"p7", "p2"}, personNames(people))
+
+	// The sort keys are selected for the cursor even if not requested
+	query.Cursor = page.Next
+	people = nil
+	_, err = store.ListCursor(ctx, query, &people)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"p5", "p1"}, personNames(people))
+}
+
+func TestListCursorInvalid(t *testing.T) {
+	store := setupCursorStore(t)
+	ctx := context.Background()
+	query := &Query{Size: 2, Sort: []Sort{Desc("age")}}
+
+	var people []Person
+	page, err := store.ListCursor(ctx, query, &people)
+	assert.NoError(t, err)
+
+	payload, mac, _ := strings.Cut(page.Next, ".")
+	other := &sqlStorage{db: store.db, cursorKey: []byte("other")}
+	tests := []struct {
+		name    string
+		store   *sqlStorage
+		query   *Query
+		wantErr string
+	}{
+		{"malformed", store, &Query{Size: 2, Cursor: "abc"}, "invalid cursor: malformed"},
+		{"tampered", store, &Query{Size: 2, Sort: query.Sort, Cursor: payload + "x." + mac}, "invalid cursor: bad signature"},
+		{"other key", other, &Query{Size: 2, Sort: query.Sort, Cursor: page.Next}, "invalid cursor: bad signature"},
+		{"other sort", store, &Query{Size: 2, Sort: []Sort{Asc("age")}, Cursor: page.Next}, "invalid cursor: created for another sort order"},
+		{"unknown sort column", store, &Query{Size: 2, Sort: []Sort{Asc("password")}}, "invalid sort: unknown column password"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.store.ListCursor(ctx, tt.query, &people)
+			assert.EqualError(t, err, tt.wantErr)
+			if strings.HasPrefix(tt.wantErr, "invalid cursor") {
+				assert.True(t, errors.Is(err, ErrInvalidCursor))
+			}
+		})
+	}
+}
+
+func TestListCursorNulls(t *testing.T) {
+	store := setupCursorStore(t)
+
+	var people []Person
+	_, err := store.ListCursor(context.Background(), &Query{Size: 2, Sort: []Sort{Asc("email").NullsLast()}}, &people)
+	assert.EqualError(t, err, "cursor pagination does not support nulls order on email")
+}
+
+func TestListCursorNullable(t *testing.T) {
+	store := setupCursorStore(t)
+	ctx := context.Background()
+	email := "a@example.com"
+	assert.NoError(t, store.Create(ctx, &Person{Name: "p8", Age: 50, Email: &email}))
+
+	// Most rows have a NULL email, a cursor at one of them would end the pages early
+	var people []Person
+	_, err := store.ListCursor(ctx, &Query{Size: 2, Sort: []Sort{Desc("email")}}, &people)
+	assert.EqualError(t, err, "cursor pagination does not support the nullable sort column email")
+	assert.True(t, errors.Is(err, ErrInvalidFilter))
+
+	type account struct {
+		ID        uint64 `gorm:"primaryKey"`
+		DeletedAt gorm.DeletedAt
+		Nickname  *string `gorm:"not null"`
+	}
+	assert.NoError(t, store.db.AutoMigrate(&account{}))
+	var accounts []account
+	_, err = store.ListCursor(ctx, &Query{Size: 2, Sort: []Sort{Asc("deleted_at")}, IncludeDeleted: true}, &accounts)
+	assert.True(t, errors.Is(err, ErrInvalidFilter))
+	_, err = store.ListCursor(ctx, &Query{Size: 2, Sort: []Sort{Asc("nickname")}}, &accounts)
+	assert.NoError(t, err)
+}
+
+func TestListCursorTransaction(t *testing.T) {
+	store := setupCursorStore(t)
+	ctx := context.Background()
+	query := &Query{Size: 4}
+
+	var people []Person
+	page, err := store.ListCursor(ctx, query, &people)
+	assert.NoError(t, err)
+
+	// Cursors of the storage are accepted within its transactions
+	err = store.Transaction(ctx, func(tx Storage) error {
+		people = nil
+		query.Cursor = page.Next
+		_, err := tx.ListCursor(ctx, query, &people)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"p5", "p6", "p7"}, personNames(people))
+}
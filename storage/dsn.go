@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fize/go-ext/config"
+	"github.com/go-sql-driver/mysql"
+)
+
+// DSN returns the data source name of cfg for its driver,
+// the raw DSN of cfg takes precedence over the connection fields
+func DSN(cfg *config.SQLConfig) (string, error) {
+	if cfg.DSN != "" {
+		return cfg.DSN.Value(), nil
+	}
+	switch cfg.Type {
+	case config.MySQL:
+		return mysqlDSN(cfg)
+	case config.Postgres:
+		return postgresDSN(cfg), nil
+	case config.Sqlite3, "":
+		return sqliteDSN(cfg), nil
+	default:
+		return "", fmt.Errorf("unsupported database type %s", cfg.Type)
+	}
+}
+
+// mysqlDSN builds the data source name for the mysql driver
+func mysqlDSN(cfg *config.SQLConfig) (string, error) {
+	c := mysql.NewConfig()
+	c.User = cfg.User
+	c.Passwd = cfg.Password.Value()
+	c.Net = "tcp"
+	c.Addr = cfg.Host
+	c.DBName = cfg.DB
+	c.ParseTime = true
+	c.Collation = cfg.Collation
+	c.TLSConfig = cfg.TLS
+	c.Timeout = cfg.Timeout
+	c.ReadTimeout = cfg.ReadTimeout
+	c.WriteTimeout = cfg.WriteTimeout
+
+	loc := cfg.Loc
+	if loc == "" {
+		loc = "Local"
+	}
+	location, err := time.LoadLocation(loc)
+	if err != nil {
+		return "", fmt.Errorf("invalid time zone %s: %v", loc, err)
+	}
+	c.Loc = location
+
+	c.Params = make(map[string]string, len(cfg.Params)+1)
+	if cfg.Charset != "" {
+		c.Params["charset"] = cfg.Charset
+	}
+	for k, v := range cfg.Params {
+		c.Params[k] = v
+	}
+	return c.FormatDSN(), nil
+}
+
+// postgresDSN builds the data source name for the postgres driver in URL form
+func postgresDSN(cfg *config.SQLConfig) string {
+	u := url.URL{Scheme: "postgres", Host: cfg.Host, Path: "/" + cfg.DB}
+	if cfg.Password != "" {
+		u.User = url.UserPassword(cfg.User, cfg.Password.Value())
+	} else if cfg.User != "" {
+		u.User = url.User(cfg.User)
+	}
+
+	q := url.Values{}
+	if cfg.SSLMode != "" {
+		q.Set("sslmode", cfg.SSLMode)
+	}
+	if cfg.SearchPath != "" {
+		q.Set("search_path", cfg.SearchPath)
+	}
+	if cfg.Timeout > 0 {
+		// connect_timeout is in whole seconds
+		q.Set("connect_timeout", strconv.FormatInt(int64(math.Ceil(cfg.Timeout.Seconds())), 10))
+	}
+	// Local is resolved by the client, the server uses its own time zone
+	if cfg.Loc != "" && cfg.Loc != "Local" {
+		q.Set("TimeZone", cfg.Loc)
+	}
+	for k, v := range cfg.Params {
+		q.Set(k, v)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// sqliteDSN builds the data source name for the sqlite driver,
+// options are passed as query parameters of a file: URI
+func sqliteDSN(cfg *config.SQLConfig) string {
+	params := make(map[string]string, len(cfg.Params)+4)
+	if cfg.JournalMode != "" {
+		params["_journal_mode"] = strings.ToUpper(cfg.JournalMode)
+	}
+	if cfg.BusyTimeout > 0 {
+		params["_busy_timeout"] = strconv.FormatInt(cfg.BusyTimeout.Milliseconds(), 10)
+	}
+	if cfg.ForeignKeys {
+		params["_foreign_keys"] = "1"
+	}
+	if cfg.SharedCache {
+		params["cache"] = "shared"
+	}
+	for k, v := range cfg.Params {
+		params[k] = v
+	}
+	if len(params) == 0 {
+		return cfg.DB
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	query := make([]string, 0, len(keys))
+	for _, k := range keys {
+		query = append(query, url.QueryEscape(k)+"="+url.QueryEscape(params[k]))
+	}
+	return "file:" + strings.TrimPrefix(cfg.DB, "file:") + "?" + strings.Join(query, "&")
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+)
+
+// Errors of the storage, the errors of the database drivers are classified with them,
+// e.g. errors.Is(err, ErrDuplicate) for a duplicate key of MySQL, SQLite or PostgreSQL.
+var (
+	// ErrNotFound is returned when no record matches, it is gorm.ErrRecordNotFound so existing checks keep working
+	ErrNotFound = gorm.ErrRecordNotFound
+	// ErrConflict is returned when a record was modified by someone else since it was read,
+	// i.e. its version column no longer has the expected value, or for a deadlock or a serialization failure
+	ErrConflict = errors.New("conflict: the record was modified concurrently")
+	// ErrDuplicate is returned when a record violates a unique key or the primary key
+	ErrDuplicate = errors.New("duplicate key")
+	// ErrInvalidFilter is returned for filters, sort orders, fields and cursors that do not match the model
+	ErrInvalidFilter = errors.New("invalid filter")
+	// ErrTimeout is returned when a statement or a lock wait timed out
+	ErrTimeout = errors.New("timeout")
+)
+
+// storageError is an error classified with one of the errors of the storage, it keeps the message of the error
+type storageError struct {
+	kind error
+	err  error
+}
+
+// Error implements error
+func (e *storageError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the class and the error, so errors.Is matches both
+func (e *storageError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// invalidFilter returns an error classified with ErrInvalidFilter
+func invalidFilter(format string, a ...any) error {
+	return &storageError{kind: ErrInvalidFilter, err: fmt.Errorf(format, a...)}
+}
+
+// translateError classifies the errors of GORM and of the database drivers with the errors of the storage
+func translateError(err error) error {
+	var se *storageError
+	if err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, ErrConflict) || errors.As(err, &se) {
+		return err
+	}
+	if kind := errorKind(err); kind != nil {
+		return &storageError{kind: kind, err: err}
+	}
+	return err
+}
+
+// errorKind returns the class of a database error, nil if it is unknown
+func errorKind(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrDuplicate
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		// duplicate entry, duplicate entry of a unique index
+		case 1062, 1586:
+			return ErrDuplicate
+		// lock wait timeout, maximum statement execution time exceeded
+		case 1205, 3024:
+			return ErrTimeout
+		// deadlock
+		case 1213:
+			return ErrConflict
+		}
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		// unique_violation
+		case "23505":
+			return ErrDuplicate
+		// query_canceled by the statement timeout, lock_not_available
+		case "57014", "55P03":
+			return ErrTimeout
+		// serialization_failure, deadlock_detected
+		case "40001", "40P01":
+			return ErrConflict
+		}
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch {
+		case sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique, sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey:
+			return ErrDuplicate
+		// the busy timeout expired
+		case sqliteErr.Code == sqlite3.ErrBusy, sqliteErr.Code == sqlite3.ErrLocked:
+			return ErrTimeout
+		}
+	}
+	return nil
+}
+
+// ErrNoTenant is returned by tenant-aware storages when the context carries no tenant, see ContextWithTenant
+var ErrNoTenant = errors.New("no tenant in context")
+
+// TenantError is returned when a call of a tenant accesses the records of another tenant
+type TenantError struct {
+	// Tenant is the tenant of the context
+	Tenant string
+	// Owner is the other tenant, empty if it is unknown
+	Owner string
+	// Table is the accessed table
+	Table string
+}
+
+// Error implements error
+func (e *TenantError) Error() string {
+	if e.Owner == "" {
+		return fmt.Sprintf("tenant %s cannot access %s of another tenant", e.Tenant, e.Table)
+	}
+	return fmt.Sprintf("tenant %s cannot access %s of tenant %s", e.Tenant, e.Table, e.Owner)
+}
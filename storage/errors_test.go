@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "nil", err: nil, want: nil},
+		{name: "not found", err: gorm.ErrRecordNotFound, want: ErrNotFound},
+		{name: "deadline", err: fmt.Errorf("query: %w", context.DeadlineExceeded), want: ErrTimeout},
+		{name: "gorm duplicate", err: gorm.ErrDuplicatedKey, want: ErrDuplicate},
+		{name: "mysql duplicate", err: &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a' for key 'name'"}, want: ErrDuplicate},
+		{name: "mysql lock wait", err: &mysql.MySQLError{Number: 1205}, want: ErrTimeout},
+		{name: "mysql deadlock", err: &mysql.MySQLError{Number: 1213}, want: ErrConflict},
+		{name: "postgres duplicate", err: &pgconn.PgError{Code: "23505"}, want: ErrDuplicate},
+		{name: "postgres statement timeout", err: &pgconn.PgError{Code: "57014"}, want: ErrTimeout},
+		{name: "postgres serialization failure", err: &pgconn.PgError{Code: "40001"}, want: ErrConflict},
+		{name: "sqlite unique", err: sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}, want: ErrDuplicate},
+		{name: "sqlite primary key", err: sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintPrimaryKey}, want: ErrDuplicate},
+		{name: "sqlite busy", err: sqlite3.Error{Code: sqlite3.ErrBusy}, want: ErrTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := translateError(tt.err)
+			if tt.want == nil {
+				assert.NoError(t, got)
+				return
+			}
+			assert.ErrorIs(t, got, tt.want)
+			// The driver error and its message are kept
+			assert.ErrorIs(t, got, tt.err)
+			assert.Equal(t, tt.err.Error(), got.Error())
+		})
+	}
+
+	// Unknown errors are returned as they are
+	err := &mysql.MySQLError{Number: 1146}
+	assert.Same(t, err, translateError(err))
+}
+
+func TestStorageErrors(t *testing.T) {
+	store := &sqlStorage{db: setupSqliteDB(t)}
+	ctx := context.Background()
+
+	assert.NoError(t, store.Create(ctx, &TestModel{ID: 1, Name: "a"}))
+	assert.ErrorIs(t, store.Create(ctx, &TestModel{ID: 1, Name: "b"}), ErrDuplicate)
+	err := store.Transaction(ctx, func(tx Storage) error {
+		return tx.Create(ctx, &TestModel{ID: 1, Name: "c"})
+	})
+	assert.ErrorIs(t, err, ErrDuplicate)
+	err = store.CreateBatch(ctx, []TestModel{{ID: 2}, {ID: 1}}, 1)
+	assert.ErrorIs(t, err, ErrDuplicate)
+
+	var model TestModel
+	assert.ErrorIs(t, store.Get(ctx, 9, &model), ErrNotFound)
+
+	var models []TestModel
+	_, err = store.List(ctx, &Query{Filter: map[string]any{"missing": 1}}, &models, nil)
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+	_, err = store.List(ctx, &Query{Sort: []Sort{Asc("missing")}}, &models, nil)
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+	_, err = store.ListCursor(ctx, &Query{Size: 1, Cursor: "bogus"}, &models)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+	assert.ErrorIs(t, ValidateFilter(map[string]any{"a;b": 1}), ErrInvalidFilter)
+	_, err = store.ListCursor(ctx, &Query{}, &models)
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+	assert.ErrorIs(t, store.Patch(ctx, 1, &TestModel{}, map[string]any{"missing": 1}), ErrInvalidFilter)
+	assert.ErrorIs(t, store.PatchFields(ctx, 1, &TestModel{}), ErrInvalidFilter)
+	_, err = store.UpdateWhere(ctx, &Query{}, &TestModel{}, map[string]any{"name": "x"})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+	assert.ErrorIs(t, store.DeleteBy(ctx, nil, &TestModel{}), ErrInvalidFilter)
+	assert.ErrorIs(t, store.Upsert(ctx, []TestModel{{ID: 1}}, []string{"missing"}, nil), ErrInvalidFilter)
+
+	expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	defer cancel()
+	assert.ErrorIs(t, store.Get(expired, 1, &model), ErrTimeout)
+}
+
+func TestStorageErrorsMySQL(t *testing.T) {
+	db, mock, err := setupMockDB()
+	assert.NoError(t, err)
+	store := &sqlStorage{db: db}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `test_models`")).
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"})
+	mock.ExpectRollback()
+	err = store.Create(context.Background(), &TestModel{ID: 1, Name: "a"})
+	assert.ErrorIs(t, err, ErrDuplicate)
+	assert.False(t, errors.Is(err, ErrTimeout))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `test_models`")).
+		WillReturnError(&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded"})
+	mock.ExpectRollback()
+	_, err = store.UpdateBy(context.Background(), map[string]any{"name": "a"}, &TestModel{Name: "b"})
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
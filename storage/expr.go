@@ -0,0 +1,294 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Op is the operator of a filter condition
+type Op string
+
+// supported operators
+const (
+	OpEq      Op = "eq"
+	OpNe      Op = "ne"
+	OpGt      Op = "gt"
+	OpGte     Op = "gte"
+	OpLt      Op = "lt"
+	OpLte     Op = "lte"
+	OpIn      Op = "in"
+	OpNin     Op = "nin"
+	OpLike    Op = "like"
+	OpILike   Op = "ilike"
+	OpBetween Op = "between"
+	OpIsNull  Op = "isnull"
+)
+
+// Expr is a filter expression, a Condition or a Group of expressions
+type Expr interface {
+	// compile compiles the expression into a parameterized GORM clause
+	compile(c *compiler) (clause.Expression, error)
+}
+
+// Condition compares a column with a value, e.g. Condition{Field: "age", Op: OpGte, Value: 18}.
+// Field is a column or field name of the model.
+// The value of in and nin is a slice, of between a slice of two bounds and of isnull a bool.
+type Condition struct {
+	Field string
+	Op    Op
+	Value any
+}
+
+// Group combines expressions with AND, or with OR if Or is set
+type Group struct {
+	Or    bool
+	Exprs []Expr
+}
+
+// Eq matches rows whose field equals value
+func Eq(field string, value any) Condition {
+	return Condition{Field: field, Op: OpEq, Value: value}
+}
+
+// Ne matches rows whose field does not equal value
+func Ne(field string, value any) Condition {
+	return Condition{Field: field, Op: OpNe, Value: value}
+}
+
+// Gt matches rows whose field is greater than value
+func Gt(field string, value any) Condition {
+	return Condition{Field: field, Op: OpGt, Value: value}
+}
+
+// Gte matches rows whose field is greater than or equal to value
+func Gte(field string, value any) Condition {
+	return Condition{Field: field, Op: OpGte, Value: value}
+}
+
+// Lt matches rows whose field is less than value
+func Lt(field string, value any) Condition {
+	return Condition{Field: field, Op: OpLt, Value: value}
+}
+
+// Lte matches rows whose field is less than or equal to value
+func Lte(field string, value any) Condition {
+	return Condition{Field: field, Op: OpLte, Value: value}
+}
+
+// In matches rows whose field is one of values
+func In(field string, values ...any) Condition {
+	return Condition{Field: field, Op: OpIn, Value: values}
+}
+
+// Nin matches rows whose field is none of values
+func Nin(field string, values ...any) Condition {
+	return Condition{Field: field, Op: OpNin, Value: values}
+}
+
+// Like matches rows whose field matches pattern, e.g. %name%
+func Like(field, pattern string) Condition {
+	return Condition{Field: field, Op: OpLike, Value: pattern}
+}
+
+// ILike matches rows whose field matches pattern ignoring case
+func ILike(field, pattern string) Condition {
+	return Condition{Field: field, Op: OpILike, Value: pattern}
+}
+
+// Between matches rows whose field is between low and high, both included
+func Between(field string, low, high any) Condition {
+	return Condition{Field: field, Op: OpBetween, Value: []any{low, high}}
+}
+
+// IsNull matches rows whose field is NULL, or is not NULL if null is false
+func IsNull(field string, null bool) Condition {
+	return Condition{Field: field, Op: OpIsNull, Value: null}
+}
+
+// And matches rows that match all expressions
+func And(exprs ...Expr) Group {
+	return Group{Exprs: exprs}
+}
+
+// Or matches rows that match any of the expressions
+func Or(exprs ...Expr) Group {
+	return Group{Or: true, Exprs: exprs}
+}
+
+// compiler compiles expressions for a model and a dialect
+type compiler struct {
+	schema  *schema.Schema
+	dialect string
+}
+
+// compileExpr compiles expr for the model of db, fields are validated against the model's columns.
+// It returns nil for an empty expression.
+func compileExpr(db *gorm.DB, model any, expr Expr) (clause.Expression, error) {
+	sch, err := parseSchema(db, model)
+	if err != nil {
+		return nil, err
+	}
+	return expr.compile(&compiler{schema: sch, dialect: db.Dialector.Name()})
+}
+
+// parseSchema returns the schema of model
+func parseSchema(db *gorm.DB, model any) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, fmt.Errorf("failed to parse model: %v", err)
+	}
+	return stmt.Schema, nil
+}
+
+// lookupColumn returns the column of a column or field name of sch
+func lookupColumn(sch *schema.Schema, field string) (string, error) {
+	if f := sch.LookUpField(field); f != nil && f.DBName != "" {
+		return f.DBName, nil
+	}
+	return "", fmt.Errorf("unknown column %s", field)
+}
+
+// filterWhere adds the equality conditions of filter to db, the keys of filter are column or field names of model
+// and are written as their columns. Slice values match any of their elements like a map condition of GORM.
+func filterWhere(db *gorm.DB, model any, filter map[string]any) (*gorm.DB, error) {
+	if len(filter) == 0 {
+		return db, nil
+	}
+	sch, err := parseSchema(db, model)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(filter))
+	for key := range filter {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	exprs := make([]clause.Expression, 0, len(keys))
+	for _, key := range keys {
+		name, err := lookupColumn(sch, key)
+		if err != nil {
+			return nil, invalidFilter("invalid filter: %v", err)
+		}
+		column := clause.Column{Name: name}
+		value := filter[key]
+		rv := reflect.Indirect(reflect.ValueOf(value))
+		if _, ok := value.(driver.Valuer); !ok && (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && rv.Type().Elem().Kind() != reflect.Uint8 {
+			values := make([]any, rv.Len())
+			for i := range values {
+				values[i] = rv.Index(i).Interface()
+			}
+			exprs = append(exprs, clause.IN{Column: column, Values: values})
+			continue
+		}
+		exprs = append(exprs, clause.Eq{Column: column, Value: value})
+	}
+	return db.Where(clause.And(exprs...)), nil
+}
+
+// compile implements Expr
+func (c Condition) compile(cc *compiler) (clause.Expression, error) {
+	name, err := lookupColumn(cc.schema, c.Field)
+	if err != nil {
+		return nil, invalidFilter("invalid filter: %v", err)
+	}
+	column := clause.Column{Table: clause.CurrentTable, Name: name}
+
+	switch c.Op {
+	case OpEq, "":
+		return clause.Eq{Column: column, Value: c.Value}, nil
+	case OpNe:
+		return clause.Neq{Column: column, Value: c.Value}, nil
+	case OpGt:
+		return clause.Gt{Column: column, Value: c.Value}, nil
+	case OpGte:
+		return clause.Gte{Column: column, Value: c.Value}, nil
+	case OpLt:
+		return clause.Lt{Column: column, Value: c.Value}, nil
+	case OpLte:
+		return clause.Lte{Column: column, Value: c.Value}, nil
+	case OpIn, OpNin:
+		values, err := c.values(-1)
+		if err != nil {
+			return nil, err
+		}
+		if c.Op == OpNin {
+			return clause.Not(clause.IN{Column: column, Values: values}), nil
+		}
+		return clause.IN{Column: column, Values: values}, nil
+	case OpLike:
+		return clause.Like{Column: column, Value: c.Value}, nil
+	case OpILike:
+		if cc.dialect == "postgres" {
+			return clause.Expr{SQL: "? ILIKE ?", Vars: []any{column, c.Value}}, nil
+		}
+		return clause.Expr{SQL: "LOWER(?) LIKE LOWER(?)", Vars: []any{column, c.Value}}, nil
+	case OpBetween:
+		bounds, err := c.values(2)
+		if err != nil {
+			return nil, err
+		}
+		return clause.Expr{SQL: "? BETWEEN ? AND ?", Vars: []any{column, bounds[0], bounds[1]}}, nil
+	case OpIsNull:
+		null, ok := c.Value.(bool)
+		if !ok {
+			return nil, invalidFilter("invalid filter: %s of %s needs a bool, got %T", c.Op, c.Field, c.Value)
+		}
+		if null {
+			return clause.Expr{SQL: "? IS NULL", Vars: []any{column}}, nil
+		}
+		return clause.Expr{SQL: "? IS NOT NULL", Vars: []any{column}}, nil
+	default:
+		return nil, invalidFilter("invalid filter: unknown operator %s", c.Op)
+	}
+}
+
+// values returns the value of the condition as a list, n is the required length or -1
+func (c Condition) values(n int) ([]any, error) {
+	v := reflect.ValueOf(c.Value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, invalidFilter("invalid filter: %s of %s needs a list, got %T", c.Op, c.Field, c.Value)
+	}
+	if n >= 0 && v.Len() != n {
+		return nil, invalidFilter("invalid filter: %s of %s needs %d values, got %d", c.Op, c.Field, n, v.Len())
+	}
+	values := make([]any, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	return values, nil
+}
+
+// compile implements Expr
+func (g Group) compile(cc *compiler) (clause.Expression, error) {
+	exprs := make([]clause.Expression, 0, len(g.Exprs))
+	for _, e := range g.Exprs {
+		if e == nil {
+			continue
+		}
+		expr, err := e.compile(cc)
+		if err != nil {
+			return nil, err
+		}
+		if expr != nil {
+			exprs = append(exprs, expr)
+		}
+	}
+	// GORM joins a single OR condition with the previous condition by OR, so groups of one are unwrapped
+	switch {
+	case len(exprs) == 0:
+		return nil, nil
+	case len(exprs) == 1:
+		return exprs[0], nil
+	case g.Or:
+		return clause.Or(exprs...), nil
+	default:
+		return clause.And(exprs...), nil
+	}
+}
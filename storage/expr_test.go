@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// Person is a model with columns of several types
+type Person struct {
+	ID    uint64 `gorm:"primaryKey"`
+	Name  string
+	Age   int
+	Email *string
+}
+
+// dryRunSQL returns the statement and the variables of a query on people with expr
+func dryRunSQL(t *testing.T, db *gorm.DB, expr Expr) (string, []any, error) {
+	t.Helper()
+	compiled, err := compileExpr(db, &Person{}, expr)
+	if err != nil {
+		return "", nil, err
+	}
+	stmt := db.Session(&gorm.Session{DryRun: true}).Model(&Person{}).Where(compiled).Find(&[]Person{}).Statement
+	return stmt.SQL.String(), stmt.Vars, nil
+}
+
+func TestCompileExpr(t *testing.T) {
+	mysqlDB, _, err := setupMockDB()
+	assert.NoError(t, err)
+	postgresDB, _, err := setupPostgresMockDB()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		db       *gorm.DB
+		expr     Expr
+		wantSQL  string
+		wantVars []any
+	}{
+		{
+			name:     "eq",
+			db:       mysqlDB,
+			expr:     Eq("name", "a"),
+			wantSQL:  "SELECT * FROM `people` WHERE `people`.`name` = ?",
+			wantVars: []any{"a"},
+		},
+		{
+			name:     "field name",
+			db:       mysqlDB,
+			expr:     Gte("Age", 18),
+			wantSQL:  "SELECT * FROM `people` WHERE `people`.`age` >= ?",
+			wantVars: []any{18},
+		},
+		{
+			name:     "comparisons",
+			db:       mysqlDB,
+			expr:     And(Ne("name", "a"), Gt("age", 1), Lt("age", 9), Lte("id", 5)),
+			wantSQL:  "SELECT * FROM `people` WHERE `people`.`name` <> ? AND `people`.`age` > ? AND `people`.`age` < ? AND `people`.`id` <= ?",
+			wantVars: []any{"a", 1, 9, 5},
+		},
+		{
+			name:     "in and nin",
+			db:       mysqlDB,
+			expr:     And(In("id", 1, 2), Nin("name", "a", "b")),
+			wantSQL:  "SELECT * FROM `people` WHERE `people`.`id` IN (?,?) AND `people`.`name` NOT IN (?,?)",
+			wantVars: []any{1, 2, "a", "b"},
+		},
+		{
+			name:     "in with a typed slice",
+			db:       mysqlDB,
+			expr:     Condition{Field: "id", Op: OpIn, Value: []uint64{3, 4}},
+			wantSQL:  "SELECT * FROM `people` WHERE `people`.`id` IN (?,?)",
+			wantVars: []any{uint64(3), uint64(4)},
+		},
+		{
+			name:     "like and between",
+			db:       mysqlDB,
+			expr:     And(Like("name", "a%"), Between("age", 18, 30)),
+			wantSQL:  "SELECT * FROM `people` WHERE `people`.`name` LIKE ? AND (`people`.`age` BETWEEN ? AND ?)",
+			wantVars: []any{"a%", 18, 30},
+		},
+		{
+			name:     "ilike",
+			db:       mysqlDB,
+			expr:     ILike("name", "A%"),
+			wantSQL:  "SELECT * FROM `people` WHERE LOWER(`people`.`name`) LIKE LOWER(?)",
+			wantVars: []any{"A%"},
+		},
+		{
+			name:     "ilike postgres",
+			db:       postgresDB,
+			expr:     ILike("name", "A%"),
+			wantSQL:  `SELECT * FROM "people" WHERE "people"."name" ILIKE $1`,
+			wantVars: []any{"A%"},
+		},
+		{
+			name:    "isnull",
+			db:      mysqlDB,
+			expr:    And(IsNull("email", true), IsNull("name", false)),
+			wantSQL: "SELECT * FROM `people` WHERE `people`.`email` IS NULL AND `people`.`name` IS NOT NULL",
+		},
+		{
+			name:     "nested groups",
+			db:       postgresDB,
+			expr:     Or(Eq("name", "a"), And(Gte("age", 18), Lt("age", 30))),
+			wantSQL:  `SELECT * FROM "people" WHERE ("people"."name" = $1 OR ("people"."age" >= $2 AND "people"."age" < $3))`,
+			wantVars: []any{"a", 18, 30},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, vars, err := dryRunSQL(t, tt.db, tt.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantSQL, sql)
+			assert.Equal(t, tt.wantVars, vars)
+		})
+	}
+}
+
+func TestCompileExprErrors(t *testing.T) {
+	db, _, err := setupMockDB()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		expr    Expr
+		wantErr string
+	}{
+		{name: "unknown column", expr: Eq("password", "x"), wantErr: "invalid filter: unknown column password"},
+		{name: "injection", expr: Eq("name; DROP TABLE people", "x"), wantErr: "invalid filter: unknown column name; DROP TABLE people"},
+		{name: "nested unknown column", expr: Or(Eq("name", "a"), And(Eq("nope", 1))), wantErr: "invalid filter: unknown column nope"},
+		{name: "unknown operator", expr: Condition{Field: "name", Op: "regex", Value: "a"}, wantErr: "invalid filter: unknown operator regex"},
+		{name: "in without list", expr: Condition{Field: "id", Op: OpIn, Value: 1}, wantErr: "invalid filter: in of id needs a list, got int"},
+		{name: "between with one bound", expr: Condition{Field: "age", Op: OpBetween, Value: []int{1}}, wantErr: "invalid filter: between of age needs 2 values, got 1"},
+		{name: "isnull without bool", expr: Condition{Field: "email", Op: OpIsNull, Value: "yes"}, wantErr: "invalid filter: isnull of email needs a bool, got string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := dryRunSQL(t, db, tt.expr)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestListWhereSqlite(t *testing.T) {
+	db := setupSqliteDB(t)
+	assert.NoError(t, db.AutoMigrate(&Person{}))
+	store := &sqlStorage{db: db}
+	ctx := context.Background()
+
+	email := "bob@example.com"
+	for _, p := range []*Person{
+		{Name: "Alice", Age: 17},
+		{Name: "Bob", Age: 25, Email: &email},
+		{Name: "Carol", Age: 40},
+	} {
+		assert.NoError(t, store.Create(ctx, p))
+	}
+
+	tests := []struct {
+		name  string
+		query *Query
+		want  []string
+	}{
+		{name: "ilike", query: &Query{Where: ILike("name", "a%")}, want: []string{"Alice"}},
+		{name: "or", query: &Query{Where: Or(Lt("age", 18), Gt("age", 30))}, want: []string{"Alice", "Carol"}},
+		{name: "isnull", query: &Query{Where: IsNull("email", false)}, want: []string{"Bob"}},
+		{name: "between", query: &Query{Where: Between("age", 18, 40)}, want: []string{"Bob", "Carol"}},
+		{name: "nin", query: &Query{Where: Nin("name", "Alice", "Bob")}, want: []string{"Carol"}},
+		{name: "filter and where", query: &Query{Filter: map[string]any{"age": 25}, Where: Like("name", "B%")}, want: []string{"Bob"}},
+		{name: "filter in", query: &Query{Filter: map[string]any{"age": []int{17, 40}}}, want: []string{"Alice", "Carol"}},
+		{name: "filter and single or", query: &Query{Filter: map[string]any{"age": 25}, Where: Or(Eq("name", "Alice"))}, want: nil},
+		{name: "empty group", query: &Query{Where: And(Or())}, want: []string{"Alice", "Bob", "Carol"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Sort = []Sort{Asc("name")}
+			var people []Person
+			total, err := store.List(ctx, tt.query, &people, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(len(tt.want)), total)
+			var got []string
+			for _, p := range people {
+				got = append(got, p.Name)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	var people []Person
+	_, err := store.List(ctx, &Query{Filter: map[string]any{"secret": 1}}, &people, nil)
+	assert.EqualError(t, err, "invalid filter: unknown column secret")
+}
+
+func TestFilterFieldNames(t *testing.T) {
+	type member struct {
+		ID       uint64 `gorm:"primaryKey"`
+		UserName string
+	}
+	db := setupSqliteDB(t)
+	assert.NoError(t, db.AutoMigrate(&member{}))
+	store := &sqlStorage{db: db}
+	ctx := context.Background()
+	assert.NoError(t, store.Create(ctx, &member{UserName: "alice"}))
+	assert.NoError(t, store.Create(ctx, &member{UserName: "bob"}))
+
+	// Field names are written as their columns, e.g. UserName as user_name
+	var got member
+	assert.NoError(t, store.GetBy(ctx, map[string]any{"UserName": "alice"}, &got))
+	assert.Equal(t, "alice", got.UserName)
+
+	var members []member
+	total, err := store.List(ctx, &Query{Filter: map[string]any{"UserName": "bob"}}, &members, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+
+	rows, err := store.UpdateBy(ctx, map[string]any{"UserName": "bob"}, &member{UserName: "carol"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rows)
+
+	assert.NoError(t, store.DeleteBy(ctx, map[string]any{"UserName": "carol"}, &member{}))
+	n, err := store.Count(ctx, &Query{}, &member{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
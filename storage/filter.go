@@ -1,15 +1,15 @@
 package storage
 
 import (
-	"fmt"
 	"strings"
 )
 
-// ValidateFilter validates the filter parameters to prevent SQL injection
+// ValidateFilter validates the filter parameters to prevent SQL injection.
+// Storage checks filters against the columns of the model, which is stricter.
 func ValidateFilter(filter map[string]any) error {
 	for key := range filter {
 		if !isValidColumnName(key) {
-			return fmt.Errorf("invalid column name: %s", key)
+			return invalidFilter("invalid column name: %s", key)
 		}
 	}
 	return nil
@@ -8,38 +8,95 @@ import (
 type Query struct {
 	// support for filter condition, e.g: {"name": "test"}
 	Filter map[string]any
+	// support for filter expressions, combined with Filter by AND,
+	// e.g: Or(Like("name", "a%"), And(Gte("age", 18), IsNull("deleted_at", true)))
+	Where Expr
 	// support for pagination
 	Page int
 	// support for pagination size
 	Size int
-	// support sort condition, e.g: {"created_at": "desc"}
-	Sort map[string]string
+	// support for cursor pagination, the Next or Prev cursor of the previous page, empty for the first page
+	Cursor string
+	// skip counting the matching records of cursor pagination, e.g. on large tables
+	SkipCount bool
+	// support sort conditions in order, e.g: []Sort{Desc("created_at"), Asc("name").NullsLast()},
+	// the primary key is added as the last condition to make the order stable,
+	// a page of List without Sort is ordered by the primary key
+	Sort []Sort
+	// support for selecting columns, e.g: ["id", "name"], all columns if empty
+	Fields []string
 	// support for preloading
 	Preload string
+	// support for preloading several associations, e.g: ["RelatedModels"]
+	Include []string
 	// support for preload all associations
 	AllPreload bool
 	// support for association query
 	AssociationKey string
+	// include soft-deleted records
+	IncludeDeleted bool
 }
 
-// Storage defines basic database operations
+// Storage defines basic database operations.
+// With read replicas configured, the reads Get, GetBy, List, ListDeleted, Count and ListCursor go to a replica
+// unless they run in a transaction or with a context from ContextWithPrimary, writes go to the primary.
 type Storage interface {
 	// returns the database client
 	Client() any
+	// Ping checks that the database is reachable, e.g. for a readiness probe
+	Ping(ctx context.Context) error
+	// Close closes the database, e.g. on graceful shutdown
+	Close() error
+	// Transaction runs fn in a transaction, it commits when fn returns nil and rolls back otherwise.
+	// Nested calls create savepoints, use ContextWithTx to let calls with a context join the transaction.
+	Transaction(ctx context.Context, fn func(tx Storage) error, opts ...TxOption) error
 	// Create creates a new record
 	Create(ctx context.Context, model any) error
+	// CreateBatch creates the records of models, a slice, with one statement per batchSize records,
+	// all records are created at once if batchSize is not positive. Failed batches are reported with a *BatchError.
+	CreateBatch(ctx context.Context, models any, batchSize int, opts ...BatchOption) error
+	// Upsert creates the records of models, a slice, or updates them if they conflict on conflictColumns,
+	// the primary key if empty. Only updateColumns are updated, or all columns if empty.
+	// Failed batches are reported with a *BatchError.
+	Upsert(ctx context.Context, models any, conflictColumns, updateColumns []string, opts ...BatchOption) error
 	// Get retrieves a single record by ID
 	Get(ctx context.Context, id uint64, result any) error
 	// GetBy retrieves a single record by custom conditions
 	GetBy(ctx context.Context, filter map[string]any, result any) error
-	// Update updates a record by ID
+	// Update updates the non-zero fields of data on the record with ID, ErrNotFound is returned if it does not exist.
+	// If the model has a version column, an integer field tagged gorm:"version" or named Version,
+	// it is increased and a non-zero version of data must match the stored one, otherwise ErrConflict is returned.
 	Update(ctx context.Context, id uint64, data any) error
-	// UpdateBy updates records that match the filter
-	UpdateBy(ctx context.Context, filter map[string]any, data any) error
-	// Delete deletes a record by ID
+	// UpdateBy updates the non-zero fields of data on the records that match the filter and returns their number
+	UpdateBy(ctx context.Context, filter map[string]any, data any) (int64, error)
+	// UpdateWhere sets the columns of values, e.g. {"status": "archived"}, on the records of model that match
+	// the Filter and Where of query, in batches of primary keys, and returns the number of updated records.
+	// The version column of matching records is increased.
+	UpdateWhere(ctx context.Context, query *Query, model any, values map[string]any, opts ...BatchOption) (int64, error)
+	// Patch updates only the given columns of the record with ID, zero values included,
+	// the keys of changes are column or field names of model, e.g. {"name": "a", "age": 0}.
+	// A version in changes is checked like in Update.
+	Patch(ctx context.Context, id uint64, model any, changes map[string]any) error
+	// PatchFields updates only the given fields of model on the record with ID, zero values included,
+	// e.g. a field mask of a PATCH request. The version of model is checked like in Update.
+	PatchFields(ctx context.Context, id uint64, model any, fields ...string) error
+	// Delete deletes a record by ID, records of models with a gorm.DeletedAt field are soft-deleted
 	Delete(ctx context.Context, id uint64, model any) error
-	// DeleteBy deletes records that match the filter
+	// DeleteBy deletes records that match the filter, records of models with a gorm.DeletedAt field are soft-deleted
 	DeleteBy(ctx context.Context, filter map[string]any, model any) error
+	// Restore restores a soft-deleted record by ID
+	Restore(ctx context.Context, id uint64, model any) error
+	// Purge deletes a record by ID permanently, whether it is soft-deleted or not
+	Purge(ctx context.Context, id uint64, model any) error
 	// List retrieves multiple records with pagination, support association query
 	List(ctx context.Context, query *Query, mainModel, assModel any) (total int64, err error)
+	// ListDeleted retrieves the soft-deleted records with pagination, e.g. for a trash can
+	ListDeleted(ctx context.Context, query *Query, result any) (total int64, err error)
+	// Count returns the number of records of model that match the Filter and Where of query
+	Count(ctx context.Context, query *Query, model any) (int64, error)
+	// ListCursor retrieves a page of records after or before query.Cursor instead of an offset,
+	// result is a pointer to a slice. Records are ordered by query.Sort and the primary key,
+	// the returned cursors are signed and only valid for the same sort order.
+	// Nullable sort columns, pointers or sql.Null types not tagged not null, are rejected.
+	ListCursor(ctx context.Context, query *Query, result any) (*CursorPage, error)
 }
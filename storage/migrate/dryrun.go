@@ -0,0 +1,35 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+// statementWriter is the GORM logger of a dry run, it writes every statement to w
+type statementWriter struct {
+	w io.Writer
+}
+
+// LogMode implements logger.Interface
+func (s *statementWriter) LogMode(logger.LogLevel) logger.Interface {
+	return s
+}
+
+// Info implements logger.Interface
+func (s *statementWriter) Info(context.Context, string, ...any) {}
+
+// Warn implements logger.Interface
+func (s *statementWriter) Warn(context.Context, string, ...any) {}
+
+// Error implements logger.Interface
+func (s *statementWriter) Error(context.Context, string, ...any) {}
+
+// Trace implements logger.Interface
+func (s *statementWriter) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	fmt.Fprintf(s.w, "%s;\n", sql)
+}
@@ -0,0 +1,161 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+)
+
+// interval between attempts to take a lock held by another process
+var _lockPoll = 100 * time.Millisecond
+
+// locker is the migration lock of a database
+type locker interface {
+	// prepare creates what the lock needs before it is taken
+	prepare(db *gorm.DB) error
+	// lock takes the lock on conn, waiting up to timeout
+	lock(ctx context.Context, conn *gorm.DB, timeout time.Duration) error
+	// unlock releases the lock
+	unlock(conn *gorm.DB) error
+}
+
+// newLocker returns the locker of a dialect, named after the migrations table.
+// mysql and postgres use session locks released with the connection, so a crashed process keeps no lock,
+// other databases use a lock table.
+func newLocker(dialect, table string) locker {
+	switch dialect {
+	case "mysql":
+		return &mysqlLocker{name: table}
+	case "postgres":
+		h := fnv.New64a()
+		h.Write([]byte(table))
+		return &postgresLocker{key: int64(h.Sum64() & math.MaxInt64)}
+	default:
+		return &tableLocker{table: table + "_lock"}
+	}
+}
+
+// mysqlLocker locks with GET_LOCK
+type mysqlLocker struct {
+	name string
+}
+
+func (l *mysqlLocker) prepare(*gorm.DB) error {
+	return nil
+}
+
+func (l *mysqlLocker) lock(_ context.Context, conn *gorm.DB, timeout time.Duration) error {
+	var ok *int
+	if err := conn.Raw("SELECT GET_LOCK(?, ?)", l.name, int(math.Ceil(timeout.Seconds()))).Scan(&ok).Error; err != nil {
+		return fmt.Errorf("failed to take the migration lock: %v", err)
+	}
+	if ok == nil || *ok != 1 {
+		return ErrLocked
+	}
+	return nil
+}
+
+func (l *mysqlLocker) unlock(conn *gorm.DB) error {
+	return conn.Exec("SELECT RELEASE_LOCK(?)", l.name).Error
+}
+
+// postgresLocker locks with an advisory lock
+type postgresLocker struct {
+	key int64
+}
+
+func (l *postgresLocker) prepare(*gorm.DB) error {
+	return nil
+}
+
+func (l *postgresLocker) lock(ctx context.Context, conn *gorm.DB, timeout time.Duration) error {
+	return poll(ctx, timeout, func() (bool, error) {
+		var ok bool
+		if err := conn.Raw("SELECT pg_try_advisory_lock(?)", l.key).Scan(&ok).Error; err != nil {
+			return false, fmt.Errorf("failed to take the migration lock: %v", err)
+		}
+		return ok, nil
+	})
+}
+
+func (l *postgresLocker) unlock(conn *gorm.DB) error {
+	return conn.Exec("SELECT pg_advisory_unlock(?)", l.key).Error
+}
+
+// tableLocker locks by inserting the only row of a lock table
+type tableLocker struct {
+	table string
+}
+
+// lockRow is the row of the lock table
+type lockRow struct {
+	ID       int `gorm:"primaryKey;autoIncrement:false"`
+	LockedAt time.Time
+}
+
+func (l *tableLocker) prepare(db *gorm.DB) error {
+	// Another process may create the table at the same time, which is fine as long as it exists
+	if err := db.Table(l.table).AutoMigrate(&lockRow{}); err != nil && !db.Migrator().HasTable(l.table) {
+		return fmt.Errorf("failed to create the migration lock table: %v", err)
+	}
+	return nil
+}
+
+func (l *tableLocker) lock(ctx context.Context, conn *gorm.DB, timeout time.Duration) error {
+	return poll(ctx, timeout, func() (bool, error) {
+		// The insert fails on the primary key while another process holds the lock
+		err := conn.Table(l.table).Create(&lockRow{ID: 1, LockedAt: time.Now()}).Error
+		if err == nil {
+			return true, nil
+		}
+		if isDuplicate(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to take the migration lock: %v", err)
+	})
+}
+
+// isDuplicate reports whether err is a violation of the primary key or of a unique key
+func isDuplicate(err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		(sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey || sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique)
+}
+
+func (l *tableLocker) unlock(conn *gorm.DB) error {
+	if !conn.Migrator().HasTable(l.table) {
+		return nil
+	}
+	return conn.Table(l.table).Where("id = ?", 1).Delete(&lockRow{}).Error
+}
+
+// poll calls try until it takes the lock, fails, or timeout expires
+func poll(ctx context.Context, timeout time.Duration, try func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := try()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrLocked
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ErrLocked, ctx.Err())
+		case <-time.After(_lockPoll):
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// migrate package applies versioned schema migrations written as SQL files or Go functions.
+//
+// SQL migrations are files named VERSION_NAME.up.sql and VERSION_NAME.down.sql,
+// e.g. 0001_create_users.up.sql, usually embedded with embed.FS and loaded with LoadFS.
+// Applied versions are recorded in a migrations table, and a lock keeps two replicas
+// from migrating at the same time.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/fize/go-ext/log"
+	"github.com/fize/go-ext/storage"
+	"gorm.io/gorm"
+)
+
+const (
+	// default name of the migrations table
+	_defaultTable = "schema_migrations"
+	// default wait for the lock of another process
+	_defaultLockTimeout = time.Minute
+)
+
+// Migration is a versioned schema change
+type Migration struct {
+	// Version orders the migrations, e.g. 1, 2, 3 or a timestamp such as 20240101120000
+	Version int64
+	// Name describes the migration, e.g. create_users
+	Name string
+	// Up applies the migration within a transaction
+	Up func(tx *gorm.DB) error
+	// Down reverts the migration within a transaction, nil if it cannot be reverted
+	Down func(tx *gorm.DB) error
+}
+
+// Status is the state of a migration
+type Status struct {
+	Version int64
+	Name    string
+	// Applied is set if the migration was applied
+	Applied bool
+	// AppliedAt is the time the migration was applied
+	AppliedAt time.Time
+	// Missing is set for an applied version without a migration, e.g. after rolling back the service
+	Missing bool
+}
+
+// record is a row of the migrations table
+type record struct {
+	Version   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255"`
+	AppliedAt time.Time
+}
+
+// Migrator applies and reverts migrations on a database
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+	// table is the name of the migrations table
+	table string
+	// lockTimeout is the wait for the lock of another process
+	lockTimeout time.Duration
+	// dryRun receives the statements instead of the database if it is set
+	dryRun io.Writer
+}
+
+// Option is used to configure the Migrator
+type Option func(*Migrator)
+
+// WithTable sets the name of the migrations table, default schema_migrations
+func WithTable(name string) Option {
+	return func(m *Migrator) {
+		m.table = name
+	}
+}
+
+// WithLockTimeout sets the wait for the lock of another process, default 1m
+func WithLockTimeout(d time.Duration) Option {
+	return func(m *Migrator) {
+		m.lockTimeout = d
+	}
+}
+
+// WithDryRun writes the statements of the migrations to w instead of running them
+func WithDryRun(w io.Writer) Option {
+	return func(m *Migrator) {
+		m.dryRun = w
+	}
+}
+
+// New creates a new Migrator of migrations on the database of s
+func New(s storage.Storage, migrations []Migration, opts ...Option) (*Migrator, error) {
+	db, ok := s.Client().(*gorm.DB)
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage client %T", s.Client())
+	}
+
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, mig := range sorted {
+		if mig.Version <= 0 {
+			return nil, fmt.Errorf("migration %s has an invalid version %d", mig.Name, mig.Version)
+		}
+		if mig.Up == nil {
+			return nil, fmt.Errorf("migration %d %s has no up function", mig.Version, mig.Name)
+		}
+		if i > 0 && sorted[i-1].Version == mig.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", mig.Version)
+		}
+	}
+
+	m := &Migrator{
+		db:          db,
+		migrations:  sorted,
+		table:       _defaultTable,
+		lockTimeout: _defaultLockTimeout,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m, nil
+}
+
+// Up applies all pending migrations
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.UpTo(ctx, 0)
+}
+
+// UpTo applies the pending migrations up to version, all of them if version is 0
+func (m *Migrator) UpTo(ctx context.Context, version int64) error {
+	return m.locked(ctx, func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if version > 0 && mig.Version > version {
+				break
+			}
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.run(db, mig, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the last steps applied migrations
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("invalid steps %d", steps)
+	}
+	return m.locked(ctx, func(db *gorm.DB) error {
+		applied, err := m.applied(db)
+		if err != nil {
+			return err
+		}
+		versions := make([]int64, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+		byVersion := make(map[int64]Migration, len(m.migrations))
+		for _, mig := range m.migrations {
+			byVersion[mig.Version] = mig
+		}
+		for _, v := range versions[:min(steps, len(versions))] {
+			mig, ok := byVersion[v]
+			if !ok {
+				return fmt.Errorf("migration %d %s is applied but unknown", v, applied[v].Name)
+			}
+			if mig.Down == nil {
+				return fmt.Errorf("migration %d %s cannot be reverted, it has no down function", v, mig.Name)
+			}
+			if err := m.run(db, mig, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Status returns the state of the migrations and of the applied versions without a migration, ordered by version
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(m.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		st := Status{Version: mig.Version, Name: mig.Name}
+		if r, ok := applied[mig.Version]; ok {
+			st.Applied, st.AppliedAt = true, r.AppliedAt
+			delete(applied, mig.Version)
+		}
+		statuses = append(statuses, st)
+	}
+	for _, r := range applied {
+		statuses = append(statuses, Status{Version: r.Version, Name: r.Name, Applied: true, AppliedAt: r.AppliedAt, Missing: true})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// applied returns the records of the applied migrations by version
+func (m *Migrator) applied(db *gorm.DB) (map[int64]record, error) {
+	result := make(map[int64]record)
+	if !db.Migrator().HasTable(m.table) {
+		return result, nil
+	}
+	var records []record
+	if err := db.Table(m.table).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to read the migrations table: %v", err)
+	}
+	for _, r := range records {
+		result[r.Version] = r
+	}
+	return result, nil
+}
+
+// run applies or reverts mig in a transaction together with its record
+func (m *Migrator) run(db *gorm.DB, mig Migration, up bool) error {
+	direction, fn := "up", mig.Up
+	if !up {
+		direction, fn = "down", mig.Down
+	}
+
+	if m.dryRun != nil {
+		fmt.Fprintf(m.dryRun, "-- %s %d %s\n", direction, mig.Version, mig.Name)
+		return fn(db.Session(&gorm.Session{DryRun: true, Logger: &statementWriter{w: m.dryRun}}))
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if up {
+			return tx.Table(m.table).Create(&record{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}).Error
+		}
+		return tx.Table(m.table).Where("version = ?", mig.Version).Delete(&record{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d %s %s failed: %w", mig.Version, mig.Name, direction, err)
+	}
+	log.Infof("migration %d %s %s applied", mig.Version, mig.Name, direction)
+	return nil
+}
+
+// locked runs fn on one connection holding the migration lock, a dry run takes no lock and changes nothing
+func (m *Migrator) locked(ctx context.Context, fn func(db *gorm.DB) error) error {
+	db := m.db.WithContext(ctx)
+	if m.dryRun != nil {
+		return fn(db)
+	}
+	l := newLocker(db.Dialector.Name(), m.table)
+	if err := l.prepare(db); err != nil {
+		return err
+	}
+
+	return db.Connection(func(conn *gorm.DB) error {
+		// Start every statement from a new session, the connection instance would collect their clauses
+		conn = conn.Session(&gorm.Session{})
+		if err := l.lock(ctx, conn, m.lockTimeout); err != nil {
+			return err
+		}
+		defer func() {
+			if err := l.unlock(conn.WithContext(context.WithoutCancel(ctx))); err != nil {
+				log.Warnf("failed to release the migration lock: %v", err)
+			}
+		}()
+		// Create the migrations table under the lock, so processes starting together do not race on it
+		if err := conn.Table(m.table).AutoMigrate(&record{}); err != nil {
+			return fmt.Errorf("failed to create the migrations table: %v", err)
+		}
+		return fn(conn)
+	})
+}
+
+// Unlock releases a lock left behind by a crashed process, it only applies to the lock table of sqlite
+func (m *Migrator) Unlock(ctx context.Context) error {
+	db := m.db.WithContext(ctx)
+	return newLocker(db.Dialector.Name(), m.table).unlock(db)
+}
+
+// ErrLocked is returned when another process holds the migration lock longer than the lock timeout
+var ErrLocked = errors.New("migrations are locked by another process")
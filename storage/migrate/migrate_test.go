@@ -0,0 +1,287 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/fize/go-ext/config"
+	"github.com/fize/go-ext/storage"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+var testFS = fstest.MapFS{
+	"migrations/0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);\nCREATE INDEX idx_users_name ON users (name);")},
+	"migrations/0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	"migrations/0002_add_email.up.sql":      {Data: []byte("-- emails are optional\nALTER TABLE users ADD COLUMN email TEXT;")},
+	"migrations/0002_add_email.down.sql":    {Data: []byte("ALTER TABLE users DROP COLUMN email;")},
+	"migrations/README.md":                  {Data: []byte("ignored")},
+}
+
+// openStore opens a sqlite database in a temporary directory
+func openStore(t *testing.T) storage.Storage {
+	t.Helper()
+	cfg, err := config.NewSQLConfig(config.WithDB(filepath.Join(t.TempDir(), "migrate.db")))
+	assert.NoError(t, err)
+	store, err := storage.Open(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// testMigrations returns the SQL migrations of testFS and a Go migration
+func testMigrations(t *testing.T) []Migration {
+	t.Helper()
+	migrations, err := LoadFS(testFS, "migrations")
+	assert.NoError(t, err)
+	return append(migrations, Migration{
+		Version: 3,
+		Name:    "seed_admin",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("INSERT INTO users (name) VALUES (?)", "admin").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("DELETE FROM users WHERE name = ?", "admin").Error
+		},
+	})
+}
+
+func applied(t *testing.T, m *Migrator) []int64 {
+	t.Helper()
+	statuses, err := m.Status(context.Background())
+	assert.NoError(t, err)
+	var versions []int64
+	for _, st := range statuses {
+		if st.Applied {
+			versions = append(versions, st.Version)
+		}
+	}
+	return versions
+}
+
+func TestMigrator(t *testing.T) {
+	store := openStore(t)
+	db := store.Client().(*gorm.DB)
+	ctx := context.Background()
+
+	m, err := New(store, testMigrations(t))
+	assert.NoError(t, err)
+	assert.Empty(t, applied(t, m))
+
+	assert.NoError(t, m.UpTo(ctx, 2))
+	assert.Equal(t, []int64{1, 2}, applied(t, m))
+	assert.True(t, db.Migrator().HasColumn("users", "email"))
+
+	// Applied migrations are skipped
+	assert.NoError(t, m.Up(ctx))
+	assert.Equal(t, []int64{1, 2, 3}, applied(t, m))
+	var count int64
+	assert.NoError(t, db.Table("users").Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	assert.NoError(t, m.Down(ctx, 2))
+	assert.Equal(t, []int64{1}, applied(t, m))
+	assert.False(t, db.Migrator().HasColumn("users", "email"))
+
+	assert.NoError(t, m.Down(ctx, 5))
+	assert.Empty(t, applied(t, m))
+	assert.False(t, db.Migrator().HasTable("users"))
+
+	assert.EqualError(t, m.Down(ctx, 0), "invalid steps 0")
+	assert.EqualError(t, m.Down(ctx, -1), "invalid steps -1")
+}
+
+func TestMigratorFailure(t *testing.T) {
+	store := openStore(t)
+	ctx := context.Background()
+
+	migrations := append(testMigrations(t), Migration{
+		Version: 4,
+		Name:    "broken",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Exec("INSERT INTO users (name) VALUES ('partial')").Error; err != nil {
+				return err
+			}
+			return tx.Exec("INSERT INTO missing_table VALUES (1)").Error
+		},
+	})
+	m, err := New(store, migrations)
+	assert.NoError(t, err)
+
+	err = m.Up(ctx)
+	assert.ErrorContains(t, err, "migration 4 broken up failed")
+	// The earlier migrations stay applied, the failed one is rolled back
+	assert.Equal(t, []int64{1, 2, 3}, applied(t, m))
+	var count int64
+	assert.NoError(t, store.Client().(*gorm.DB).Table("users").Where("name = ?", "partial").Count(&count).Error)
+	assert.Zero(t, count)
+
+	// A migration without down cannot be reverted
+	assert.NoError(t, store.Client().(*gorm.DB).Table(_defaultTable).Create(&record{Version: 4, Name: "broken"}).Error)
+	assert.EqualError(t, m.Down(ctx, 1), "migration 4 broken cannot be reverted, it has no down function")
+}
+
+func TestMigratorStatusMissing(t *testing.T) {
+	store := openStore(t)
+	ctx := context.Background()
+
+	m, err := New(store, testMigrations(t))
+	assert.NoError(t, err)
+	assert.NoError(t, m.Up(ctx))
+
+	// An older release only knows the first migration
+	older, err := New(store, testMigrations(t)[:1])
+	assert.NoError(t, err)
+	statuses, err := older.Status(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, statuses, 3) {
+		assert.False(t, statuses[0].Missing)
+		assert.True(t, statuses[2].Missing)
+		assert.Equal(t, "seed_admin", statuses[2].Name)
+	}
+	assert.EqualError(t, older.Down(ctx, 1), "migration 3 seed_admin is applied but unknown")
+}
+
+func TestMigratorDryRun(t *testing.T) {
+	store := openStore(t)
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	m, err := New(store, testMigrations(t), WithDryRun(&out))
+	assert.NoError(t, err)
+	assert.NoError(t, m.Up(ctx))
+
+	want := `-- up 1 create_users
+CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);
+CREATE INDEX idx_users_name ON users (name);
+-- up 2 add_email
+-- emails are optional
+ALTER TABLE users ADD COLUMN email TEXT;
+-- up 3 seed_admin
+INSERT INTO users (name) VALUES ("admin");
+`
+	assert.Equal(t, want, out.String())
+
+	// Nothing was changed
+	db := store.Client().(*gorm.DB)
+	assert.False(t, db.Migrator().HasTable("users"))
+	assert.False(t, db.Migrator().HasTable(_defaultTable))
+}
+
+func TestMigratorLock(t *testing.T) {
+	store := openStore(t)
+	ctx := context.Background()
+	_lockPoll = 10 * time.Millisecond
+
+	m, err := New(store, testMigrations(t), WithLockTimeout(50*time.Millisecond), WithTable("versions"))
+	assert.NoError(t, err)
+
+	// Another process holds the lock
+	l := newLocker("sqlite", "versions")
+	db := store.Client().(*gorm.DB)
+	assert.NoError(t, l.prepare(db))
+	assert.NoError(t, l.lock(ctx, db, 0))
+
+	err = m.Up(ctx)
+	assert.True(t, errors.Is(err, ErrLocked))
+	assert.Empty(t, applied(t, m))
+
+	// A lock left behind by a crashed process is released by hand
+	assert.NoError(t, m.Unlock(ctx))
+	assert.NoError(t, m.Up(ctx))
+	assert.Equal(t, []int64{1, 2, 3}, applied(t, m))
+	assert.True(t, db.Migrator().HasTable("versions"))
+
+	// The lock is released after migrating
+	assert.NoError(t, l.lock(ctx, db, 0))
+	assert.NoError(t, l.unlock(db))
+
+	// A database error is returned at once instead of waiting for the lock
+	assert.NoError(t, db.Migrator().DropTable("versions_lock"))
+	err = l.lock(ctx, db, time.Minute)
+	assert.ErrorContains(t, err, "failed to take the migration lock")
+	assert.False(t, errors.Is(err, ErrLocked))
+}
+
+func TestNew(t *testing.T) {
+	store := openStore(t)
+	up := func(*gorm.DB) error { return nil }
+
+	tests := []struct {
+		name       string
+		migrations []Migration
+		wantErr    string
+	}{
+		{name: "invalid version", migrations: []Migration{{Name: "a", Up: up}}, wantErr: "migration a has an invalid version 0"},
+		{name: "no up", migrations: []Migration{{Version: 1, Name: "a"}}, wantErr: "migration 1 a has no up function"},
+		{name: "duplicate", migrations: []Migration{{Version: 2, Name: "a", Up: up}, {Version: 2, Name: "b", Up: up}}, wantErr: "duplicate migration version 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(store, tt.migrations)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLoadFSErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		wantErr string
+	}{
+		{
+			name:    "missing up",
+			fsys:    fstest.MapFS{"m/1_a.down.sql": {Data: []byte("SELECT 1")}},
+			wantErr: "migration 1 a has no up file",
+		},
+		{
+			name: "two names",
+			fsys: fstest.MapFS{
+				"m/1_a.up.sql": {Data: []byte("SELECT 1")},
+				"m/1_b.up.sql": {Data: []byte("SELECT 1")},
+			},
+			wantErr: "migration version 1 is used by a and b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFS(tt.fsys, "m")
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+	_, err := LoadFS(fstest.MapFS{}, "missing")
+	assert.True(t, err != nil && strings.HasPrefix(err.Error(), "failed to read migrations"))
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{name: "simple", script: "SELECT 1; SELECT 2;", want: []string{"SELECT 1", "SELECT 2"}},
+		{name: "no trailing semicolon", script: "SELECT 1;\nSELECT 2\n", want: []string{"SELECT 1", "SELECT 2"}},
+		{name: "quoted semicolons", script: `INSERT INTO t VALUES ('a;b', "c;d", ` + "`e;f`" + `);`, want: []string{`INSERT INTO t VALUES ('a;b', "c;d", ` + "`e;f`" + `)`}},
+		{name: "comments", script: "-- first; still a comment\nSELECT 1; /* block; */ SELECT 2;\n-- trailing comment", want: []string{"-- first; still a comment\nSELECT 1", "/* block; */ SELECT 2"}},
+		{
+			name:   "dollar quotes",
+			script: "CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql; SELECT $1;",
+			want:   []string{"CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql", "SELECT $1"},
+		},
+		{name: "empty", script: " ;\n-- nothing\n", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, splitStatements(tt.script))
+		})
+	}
+}
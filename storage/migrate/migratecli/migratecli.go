@@ -0,0 +1,223 @@
+// migratecli package implements the goext-migrate command, which applies the migrations of a database.
+//
+// Usage:
+//
+//	goext-migrate up [-to VERSION] [FLAGS]
+//	goext-migrate down [-steps N] [FLAGS]
+//	goext-migrate status [FLAGS]
+//	goext-migrate unlock [FLAGS]
+//
+// The database is read from the configuration files given with -config and the environment,
+// SQL migrations are read from the -dir directory. Services with Go migrations or embedded
+// SQL files build their own command with Register and Run.
+package migratecli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fize/go-ext/config"
+	"github.com/fize/go-ext/storage"
+	"github.com/fize/go-ext/storage/migrate"
+)
+
+const usage = `usage:
+  goext-migrate up [-to VERSION] [FLAGS]    apply pending migrations, up to VERSION if it is set
+  goext-migrate down [-steps N] [FLAGS]     revert the last N applied migrations, default 1
+  goext-migrate status [FLAGS]              print the state of the migrations
+  goext-migrate unlock [FLAGS]              release a lock left behind by a crashed process
+
+flags:
+  -config FILE          configuration file, can be repeated to layer files
+  -env-prefix PREFIX    environment variable prefix, default ext
+  -database NAME        configured database, default default
+  -dir DIR              directory of the SQL migrations, default migrations
+  -table NAME           migrations table, default schema_migrations
+  -lock-timeout D       wait for the lock of another process, default 1m
+  -dry-run              print the statements instead of running them
+`
+
+var (
+	registeredMu sync.RWMutex
+	// registered are the migrations added to those of the directory
+	registered []migrate.Migration
+)
+
+// Register registers migrations, e.g. Go migrations or those loaded from an embed.FS with migrate.LoadFS
+func Register(ms ...migrate.Migration) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	registered = append(registered, ms...)
+}
+
+func registeredMigrations() []migrate.Migration {
+	registeredMu.RLock()
+	defer registeredMu.RUnlock()
+	return append([]migrate.Migration(nil), registered...)
+}
+
+// files collects repeated -config flags
+type files []string
+
+func (f *files) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *files) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// options are the flags shared by all commands
+type options struct {
+	configs     files
+	envPrefix   string
+	database    string
+	dir         string
+	table       string
+	lockTimeout time.Duration
+	dryRun      bool
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.Var(&o.configs, "config", "configuration file, can be repeated to layer files")
+	fs.StringVar(&o.envPrefix, "env-prefix", "ext", "environment variable prefix, empty to ignore the environment")
+	fs.StringVar(&o.database, "database", config.DefaultDatabase, "configured database")
+	fs.StringVar(&o.dir, "dir", "migrations", "directory of the SQL migrations")
+	fs.StringVar(&o.table, "table", "schema_migrations", "migrations table")
+	fs.DurationVar(&o.lockTimeout, "lock-timeout", time.Minute, "wait for the lock of another process")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "print the statements instead of running them")
+}
+
+// Run runs the command with args, without the program name, and returns the exit code
+func Run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	var (
+		opts  options
+		to    int64
+		steps int
+	)
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	opts.register(fs)
+	switch args[0] {
+	case "up":
+		fs.Int64Var(&to, "to", 0, "apply the migrations up to this version")
+	case "down":
+		fs.IntVar(&steps, "steps", 1, "number of migrations to revert")
+	case "status", "unlock":
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %s\n%s", args[0], usage)
+		return 2
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	err := run(args[0], &opts, to, steps, stdout)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func run(command string, opts *options, to int64, steps int, stdout io.Writer) error {
+	ctx := context.Background()
+	m, closeStore, err := open(ctx, opts, stdout)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	switch command {
+	case "up":
+		return m.UpTo(ctx, to)
+	case "down":
+		return m.Down(ctx, steps)
+	case "unlock":
+		return m.Unlock(ctx)
+	default:
+		return printStatus(ctx, m, stdout)
+	}
+}
+
+// open opens the configured database and creates the migrator of its migrations
+func open(ctx context.Context, opts *options, stdout io.Writer) (*migrate.Migrator, func(), error) {
+	migrations := registeredMigrations()
+	dirMigrations, err := migrate.LoadFS(os.DirFS(opts.dir), ".")
+	switch {
+	case err == nil:
+		migrations = append(migrations, dirMigrations...)
+	case errors.Is(err, fs.ErrNotExist) && len(migrations) > 0:
+		// Only the registered migrations are used
+	default:
+		return nil, nil, err
+	}
+
+	cfg, err := config.NewLoader(
+		config.WithFiles(opts.configs...),
+		config.WithEnvPrefix(opts.envPrefix),
+	).Load()
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.SQL == nil {
+		return nil, nil, errors.New("no sql configuration")
+	}
+	dbCfg, ok := cfg.SQL.Database(opts.database)
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown database %s", opts.database)
+	}
+
+	store, err := storage.Open(ctx, dbCfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	migrateOpts := []migrate.Option{migrate.WithTable(opts.table), migrate.WithLockTimeout(opts.lockTimeout)}
+	if opts.dryRun {
+		migrateOpts = append(migrateOpts, migrate.WithDryRun(stdout))
+	}
+	m, err := migrate.New(store, migrations, migrateOpts...)
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	return m, func() { store.Close() }, nil
+}
+
+func printStatus(ctx context.Context, m *migrate.Migrator, stdout io.Writer) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, st := range statuses {
+		state, appliedAt := "pending", ""
+		if st.Applied {
+			state, appliedAt = "applied", st.AppliedAt.Format(time.RFC3339)
+		}
+		if st.Missing {
+			state = "missing"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", st.Version, st.Name, state, appliedAt)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,102 @@
+package migratecli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fize/go-ext/storage/migrate"
+	"gorm.io/gorm"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	migrations := filepath.Join(dir, "migrations")
+	if err := os.Mkdir(migrations, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(migrations, "1_create_users.up.sql"), "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT);")
+	writeFile(t, filepath.Join(migrations, "1_create_users.down.sql"), "DROP TABLE users;")
+	writeFile(t, filepath.Join(migrations, "2_add_email.up.sql"), "ALTER TABLE users ADD COLUMN email TEXT;")
+	writeFile(t, filepath.Join(migrations, "2_add_email.down.sql"), "ALTER TABLE users DROP COLUMN email;")
+	cfg := filepath.Join(dir, "config.yaml")
+	writeFile(t, cfg, "sql:\n  type: sqlite3\n  db: "+filepath.Join(dir, "app.db")+"\n")
+
+	common := []string{"-config", cfg, "-env-prefix", "", "-dir", migrations}
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout []string
+		wantStderr []string
+	}{
+		{name: "no command", wantCode: 2, wantStderr: []string{"usage:"}},
+		{name: "unknown command", args: []string{"redo"}, wantCode: 2, wantStderr: []string{"unknown command redo"}},
+		{name: "unknown flag", args: []string{"status", "-steps", "1"}, wantCode: 2, wantStderr: []string{"flag provided but not defined: -steps"}},
+		{name: "status pending", args: append([]string{"status"}, common...), wantStdout: []string{"1        create_users  pending", "2        add_email     pending"}},
+		{name: "dry run", args: append([]string{"up", "-dry-run"}, common...), wantStdout: []string{"-- up 1 create_users\nCREATE TABLE users", "-- up 2 add_email"}},
+		{name: "up to", args: append([]string{"up", "-to", "1"}, common...)},
+		{name: "status applied", args: append([]string{"status"}, common...), wantStdout: []string{"create_users  applied", "add_email     pending"}},
+		{name: "up", args: append([]string{"up"}, common...)},
+		{name: "down", args: append([]string{"down", "-steps", "2"}, common...)},
+		{name: "status reverted", args: append([]string{"status"}, common...), wantStdout: []string{"create_users  pending", "add_email     pending"}},
+		{name: "invalid steps", args: append([]string{"down", "-steps", "0"}, common...), wantCode: 1, wantStderr: []string{"invalid steps 0"}},
+		{name: "unknown database", args: append([]string{"status", "-database", "reports"}, common...), wantCode: 1, wantStderr: []string{"unknown database reports"}},
+		{name: "missing dir", args: []string{"status", "-config", cfg, "-dir", filepath.Join(dir, "missing")}, wantCode: 1, wantStderr: []string{"failed to read migrations"}},
+		{name: "unlock", args: append([]string{"unlock"}, common...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := Run(tt.args, &stdout, &stderr)
+			if code != tt.wantCode {
+				t.Fatalf("code = %d, want %d, stderr: %s", code, tt.wantCode, stderr.String())
+			}
+			for _, want := range tt.wantStdout {
+				if !strings.Contains(stdout.String(), want) {
+					t.Errorf("stdout %q does not contain %q", stdout.String(), want)
+				}
+			}
+			for _, want := range tt.wantStderr {
+				if !strings.Contains(stderr.String(), want) {
+					t.Errorf("stderr %q does not contain %q", stderr.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunRegistered(t *testing.T) {
+	dir := t.TempDir()
+	cfg := filepath.Join(dir, "config.yaml")
+	writeFile(t, cfg, "sql:\n  type: sqlite3\n  db: "+filepath.Join(dir, "app.db")+"\n")
+
+	Register(migrate.Migration{
+		Version: 1,
+		Name:    "create_jobs",
+		Up:      func(tx *gorm.DB) error { return tx.Exec("CREATE TABLE jobs (id INTEGER PRIMARY KEY)").Error },
+	})
+	t.Cleanup(func() { registered = nil })
+
+	// The directory is optional when migrations are registered
+	var stdout, stderr bytes.Buffer
+	args := []string{"-config", cfg, "-env-prefix", "", "-dir", filepath.Join(dir, "missing")}
+	if code := Run(append([]string{"up"}, args...), &stdout, &stderr); code != 0 {
+		t.Fatalf("code = %d, stderr: %s", code, stderr.String())
+	}
+	if code := Run(append([]string{"status"}, args...), &stdout, &stderr); code != 0 {
+		t.Fatalf("code = %d, stderr: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "create_jobs  applied") {
+		t.Errorf("stdout %q does not show create_jobs applied", stdout.String())
+	}
+}
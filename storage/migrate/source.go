@@ -0,0 +1,145 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// fileNamePattern matches the names of SQL migration files, e.g. 0001_create_users.up.sql
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// LoadFS loads the SQL migrations of dir in fsys, e.g. an embed.FS or os.DirFS.
+// Files named VERSION_NAME.up.sql hold the statements of Up, VERSION_NAME.down.sql those of Down,
+// other files are ignored. Statements are separated by semicolons.
+func LoadFS(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	var versions []int64
+	for _, entry := range entries {
+		m := fileNamePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version of %s: %v", entry.Name(), err)
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %v", entry.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+			versions = append(versions, version)
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration version %d is used by %s and %s", version, mig.Name, m[2])
+		}
+		fn := execStatements(splitStatements(string(data)))
+		if m[3] == "up" {
+			mig.Up = fn
+		} else {
+			mig.Down = fn
+		}
+	}
+
+	migrations := make([]Migration, 0, len(versions))
+	for _, v := range versions {
+		mig := byVersion[v]
+		if mig.Up == nil {
+			return nil, fmt.Errorf("migration %d %s has no up file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	return migrations, nil
+}
+
+// execStatements returns a migration function running statements in order
+func execStatements(statements []string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, stmt := range statements {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// splitStatements splits a SQL script at the semicolons outside of quotes, comments and
+// postgres dollar-quoted strings, statements holding only comments are dropped
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	code := false
+	flush := func() {
+		if stmt := strings.TrimSpace(current.String()); stmt != "" && code {
+			statements = append(statements, stmt)
+		}
+		current.Reset()
+		code = false
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		end := -1
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end = closing(script, i+1, string(c))
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			end = closing(script, i, "\n")
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end = closing(script, i+2, "*/")
+		case c == '$':
+			if tag := dollarTag(script[i:]); tag != "" {
+				end = closing(script, i+len(tag), tag)
+			}
+		case c == ';':
+			flush()
+			continue
+		}
+		if end < 0 {
+			current.WriteByte(c)
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				code = true
+			}
+			continue
+		}
+		// Comments do not make a statement, quoted strings do
+		if c != '-' && c != '/' {
+			code = true
+		}
+		current.WriteString(script[i:end])
+		i = end - 1
+	}
+	flush()
+	return statements
+}
+
+// closing returns the index after the first terminator at or after start, or the end of script
+func closing(script string, start int, terminator string) int {
+	if n := strings.Index(script[start:], terminator); n >= 0 {
+		return start + n + len(terminator)
+	}
+	return len(script)
+}
+
+// dollarTagPattern matches the opening tag of a dollar-quoted string, e.g. $$ or $body$
+var dollarTagPattern = regexp.MustCompile(`^\$[A-Za-z_]*\$`)
+
+// dollarTag returns the dollar quote tag at the start of s, empty if there is none
+func dollarTag(s string) string {
+	return dollarTagPattern.FindString(s)
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Patch implements Storage.Patch
+func (s *sqlStorage) Patch(ctx context.Context, id uint64, model any, changes map[string]any) error {
+	if len(changes) == 0 {
+		return invalidFilter("invalid patch: no changes")
+	}
+	db := s.conn(ctx)
+	sch, err := parseSchema(db, model)
+	if err != nil {
+		return err
+	}
+
+	version := versionField(sch)
+	var expected any
+	values := make(map[string]any, len(changes)+1)
+	for key, value := range changes {
+		field := sch.LookUpField(key)
+		if field == nil || field.DBName == "" {
+			return invalidFilter("invalid patch: unknown column %s", key)
+		}
+		switch {
+		case field.PrimaryKey:
+			return invalidFilter("invalid patch: cannot change the primary key %s", field.DBName)
+		case field == version:
+			expected = value
+		default:
+			values[field.DBName] = value
+		}
+	}
+	return patch(ctx, db, sch, id, model, values, expected)
+}
+
+// PatchFields implements Storage.PatchFields
+func (s *sqlStorage) PatchFields(ctx context.Context, id uint64, model any, fields ...string) error {
+	if len(fields) == 0 {
+		return invalidFilter("invalid patch: no fields")
+	}
+	db := s.conn(ctx)
+	sch, err := parseSchema(db, model)
+	if err != nil {
+		return err
+	}
+	values, err := structValues(ctx, sch, model, fields)
+	if err != nil {
+		return err
+	}
+
+	var expected any
+	if version := versionField(sch); version != nil {
+		if v, zero := version.ValueOf(ctx, reflect.ValueOf(model).Elem()); !zero {
+			expected = v
+		}
+	}
+	return patch(ctx, db, sch, id, model, values, expected)
+}
+
+// patch updates values on the record of model with id. If the model has a version column it is increased,
+// and checked against expected unless it is nil, the new version is then set on model.
+func patch(ctx context.Context, db *gorm.DB, sch *schema.Schema, id uint64, model any, values map[string]any, expected any) error {
+	pk := sch.PrioritizedPrimaryField
+	if pk == nil {
+		return fmt.Errorf("%s has no primary key", sch.Name)
+	}
+	byID := clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName}, Value: id}
+
+	version := versionField(sch)
+	tx := db.Model(model).Where(byID)
+	var next int64
+	if version != nil {
+		if expected != nil {
+			var err error
+			if next, err = nextVersion(expected); err != nil {
+				return err
+			}
+			tx = tx.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: version.DBName}, Value: next - 1})
+		}
+		values[version.DBName] = gorm.Expr("? + 1", clause.Column{Name: version.DBName})
+	}
+	result := tx.Updates(values)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if version == nil {
+		return found(db, result, model, byID)
+	}
+
+	// The version always changes, so no affected row means the record is missing or has another version
+	if result.RowsAffected == 0 {
+		if expected == nil {
+			return gorm.ErrRecordNotFound
+		}
+		var n int64
+		if err := db.Model(model).Where(byID).Count(&n).Error; err != nil {
+			return translateError(err)
+		}
+		if n > 0 {
+			return ErrConflict
+		}
+		return gorm.ErrRecordNotFound
+	}
+	if expected != nil {
+		return version.Set(ctx, reflect.ValueOf(model).Elem(), next)
+	}
+	return nil
+}
+
+// found returns ErrRecordNotFound if result updated no record because the record of model matching byID is missing.
+// MySQL reports no affected row when the values are unchanged, so the record is looked up.
+func found(db *gorm.DB, result *gorm.DB, model any, byID clause.Expression) error {
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	var n int64
+	if err := db.Model(model).Where(byID).Count(&n).Error; err != nil {
+		return translateError(err)
+	}
+	if n == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// versionField returns the version column of sch for optimistic locking,
+// an integer field tagged gorm:"version" or named Version, nil if there is none
+func versionField(sch *schema.Schema) *schema.Field {
+	for _, field := range sch.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		if _, ok := field.TagSettings["VERSION"]; !ok && field.Name != "Version" {
+			continue
+		}
+		switch field.FieldType.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return field
+		}
+	}
+	return nil
+}
+
+// nextVersion returns version increased by one, version may be any whole number, e.g. a float64 of a JSON body
+func nextVersion(version any) (int64, error) {
+	v := reflect.Indirect(reflect.ValueOf(version))
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() + 1, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()) + 1, nil
+	case reflect.Float32, reflect.Float64:
+		if f := v.Float(); f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return int64(f) + 1, nil
+		}
+	}
+	return 0, invalidFilter("invalid version %v", version)
+}
+
+// structValues returns the columns and values of the given fields of data, zero values included,
+// or of its non-zero fields if none is given. The primary key and the version column are left out.
+func structValues(ctx context.Context, sch *schema.Schema, data any, fields []string) (map[string]any, error) {
+	rv := reflect.ValueOf(data).Elem()
+	version := versionField(sch)
+	values := make(map[string]any)
+	if len(fields) == 0 {
+		for _, field := range sch.Fields {
+			if field.DBName == "" || field.PrimaryKey || field == version || !field.Updatable {
+				continue
+			}
+			if value, zero := field.ValueOf(ctx, rv); !zero {
+				values[field.DBName] = value
+			}
+		}
+		return values, nil
+	}
+
+	for _, name := range fields {
+		field := sch.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			return nil, invalidFilter("invalid patch: unknown column %s", name)
+		}
+		if field.PrimaryKey {
+			return nil, invalidFilter("invalid patch: cannot change the primary key %s", field.DBName)
+		}
+		if field == version {
+			continue
+		}
+		values[field.DBName], _ = field.ValueOf(ctx, rv)
+	}
+	return values, nil
+}
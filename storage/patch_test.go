@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// Doc is a model with a version column
+type Doc struct {
+	ID      uint64 `gorm:"primaryKey"`
+	Title   string
+	Views   int
+	Version int
+}
+
+func setupDocs(t *testing.T) (*Repository[Doc], *Doc) {
+	t.Helper()
+	db := setupSqliteDB(t)
+	assert.NoError(t, db.AutoMigrate(&Doc{}, &Person{}))
+	repo := NewRepository[Doc](&sqlStorage{db: db})
+	doc := &Doc{Title: "draft", Views: 3, Version: 1}
+	assert.NoError(t, repo.Create(context.Background(), doc))
+	return repo, doc
+}
+
+func TestPatch(t *testing.T) {
+	repo, doc := setupDocs(t)
+	ctx := context.Background()
+
+	// Zero values are written and the version is increased
+	assert.NoError(t, repo.Patch(ctx, doc.ID, map[string]any{"views": 0}))
+	got, err := repo.Get(ctx, doc.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, Doc{ID: doc.ID, Title: "draft", Views: 0, Version: 2}, *got)
+
+	// A stale version is a conflict
+	err = repo.Patch(ctx, doc.ID, map[string]any{"title": "final", "version": 1})
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	// The current version is accepted, e.g. a float64 of a JSON body
+	assert.NoError(t, repo.Patch(ctx, doc.ID, map[string]any{"Title": "final", "version": float64(2)}))
+	got, err = repo.Get(ctx, doc.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "final", got.Title)
+	assert.Equal(t, 3, got.Version)
+
+	err = repo.Patch(ctx, 100, map[string]any{"title": "x", "version": 1})
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+	err = repo.Patch(ctx, 100, map[string]any{"title": "x"})
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	// A version that is not a whole number is rejected before anything is written
+	for _, version := range []any{"3", 2.5} {
+		err = repo.Patch(ctx, doc.ID, map[string]any{"title": "x", "version": version})
+		assert.True(t, errors.Is(err, ErrInvalidFilter))
+	}
+	got, err = repo.Get(ctx, doc.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, Doc{ID: doc.ID, Title: "final", Views: 0, Version: 3}, *got)
+}
+
+func TestPatchInvalid(t *testing.T) {
+	repo, doc := setupDocs(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		changes map[string]any
+		wantErr string
+	}{
+		{name: "empty", changes: nil, wantErr: "invalid patch: no changes"},
+		{name: "unknown column", changes: map[string]any{"password": "x"}, wantErr: "invalid patch: unknown column password"},
+		{name: "primary key", changes: map[string]any{"id": 2}, wantErr: "invalid patch: cannot change the primary key id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.EqualError(t, repo.Patch(ctx, doc.ID, tt.changes), tt.wantErr)
+		})
+	}
+	assert.EqualError(t, repo.PatchFields(ctx, doc.ID, doc), "invalid patch: no fields")
+	assert.EqualError(t, repo.PatchFields(ctx, doc.ID, doc, "secret"), "invalid patch: unknown column secret")
+}
+
+func TestPatchFields(t *testing.T) {
+	repo, doc := setupDocs(t)
+	ctx := context.Background()
+
+	// Only the masked fields are written, the version of the model is checked and updated
+	edit := &Doc{Title: "", Views: 10, Version: doc.Version}
+	assert.NoError(t, repo.PatchFields(ctx, doc.ID, edit, "title"))
+	assert.Equal(t, 2, edit.Version)
+	got, err := repo.Get(ctx, doc.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, Doc{ID: doc.ID, Title: "", Views: 3, Version: 2}, *got)
+
+	stale := &Doc{Views: 10, Version: 1}
+	assert.True(t, errors.Is(repo.PatchFields(ctx, doc.ID, stale, "views"), ErrConflict))
+}
+
+func TestUpdateVersion(t *testing.T) {
+	repo, doc := setupDocs(t)
+	ctx := context.Background()
+
+	first := &Doc{Title: "first", Version: 1}
+	second := &Doc{Title: "second", Version: 1}
+	assert.NoError(t, repo.Update(ctx, doc.ID, first))
+	assert.Equal(t, 2, first.Version)
+	assert.True(t, errors.Is(repo.Update(ctx, doc.ID, second), ErrConflict))
+
+	// Without a version the update is not checked, but the version is still increased
+	assert.NoError(t, repo.Update(ctx, doc.ID, &Doc{Views: 5}))
+	got, err := repo.Get(ctx, doc.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, Doc{ID: doc.ID, Title: "first", Views: 5, Version: 3}, *got)
+}
+
+func TestUpdateByRowsAffected(t *testing.T) {
+	repo, doc := setupDocs(t)
+	ctx := context.Background()
+	assert.NoError(t, repo.Create(ctx, &Doc{Title: "draft", Version: 1}))
+	assert.NoError(t, repo.Create(ctx, &Doc{Title: "other", Version: 1}))
+
+	rows, err := repo.Storage().UpdateBy(ctx, map[string]any{"title": "draft"}, &Doc{Views: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), rows)
+	got, err := repo.Get(ctx, doc.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, got.Views)
+	assert.Equal(t, 2, got.Version)
+
+	rows, err = repo.Storage().UpdateBy(ctx, map[string]any{"title": "none"}, &Doc{Views: 7})
+	assert.NoError(t, err)
+	assert.Zero(t, rows)
+}
+
+func TestUpdateZeroValues(t *testing.T) {
+	db := setupSqliteDB(t)
+	assert.NoError(t, db.AutoMigrate(&Person{}))
+	repo := NewRepository[Person](&sqlStorage{db: db})
+	ctx := context.Background()
+
+	// Update and UpdateBy do not write zero values, Patch does
+	p := &Person{Name: "a", Age: 30}
+	assert.NoError(t, repo.Create(ctx, p))
+	assert.NoError(t, repo.Update(ctx, p.ID, &Person{Name: "b", Age: 0}))
+	_, err := repo.Storage().UpdateBy(ctx, map[string]any{"name": "b"}, &Person{Name: ""})
+	assert.NoError(t, err)
+	got, err := repo.Get(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, Person{ID: p.ID, Name: "b", Age: 30}, *got)
+
+	assert.NoError(t, repo.Patch(ctx, p.ID, map[string]any{"age": 0}))
+	got, err = repo.Get(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, got.Age)
+}
+
+func TestPatchUnversioned(t *testing.T) {
+	db := setupSqliteDB(t)
+	assert.NoError(t, db.AutoMigrate(&Person{}))
+	repo := NewRepository[Person](&sqlStorage{db: db})
+	ctx := context.Background()
+
+	p := &Person{Name: "a", Age: 30}
+	assert.NoError(t, repo.Create(ctx, p))
+	assert.NoError(t, repo.Patch(ctx, p.ID, map[string]any{"age": 0, "email": nil}))
+	got, err := repo.Get(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, Person{ID: p.ID, Name: "a"}, *got)
+
+	err = repo.Patch(ctx, 100, map[string]any{"age": 1})
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+	err = repo.Storage().PatchFields(ctx, 100, &Person{Age: 1}, "Age")
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func TestUpdatePrimaryKeyColumn(t *testing.T) {
+	type account struct {
+		UserID uint64 `gorm:"primaryKey;column:user_id"`
+		Name   string
+	}
+	db := setupSqliteDB(t)
+	assert.NoError(t, db.AutoMigrate(&account{}))
+	store := &sqlStorage{db: db}
+	ctx := context.Background()
+
+	assert.NoError(t, store.Create(ctx, &account{UserID: 7, Name: "a"}))
+	assert.NoError(t, store.Update(ctx, 7, &account{Name: "b"}))
+	var got account
+	assert.NoError(t, store.Get(ctx, 7, &got))
+	assert.Equal(t, "b", got.Name)
+	assert.True(t, errors.Is(store.Update(ctx, 8, &account{Name: "b"}), gorm.ErrRecordNotFound))
+}
+
+func TestVersionField(t *testing.T) {
+	db := setupSqliteDB(t)
+	type tagged struct {
+		ID  uint64
+		Rev uint32 `gorm:"version"`
+	}
+	type named struct {
+		ID      uint64
+		Version string
+	}
+
+	for _, tt := range []struct {
+		model any
+		want  string
+	}{
+		{model: &Doc{}, want: "version"},
+		{model: &tagged{}, want: "rev"},
+		{model: &named{}},
+		{model: &Person{}},
+	} {
+		sch, err := parseSchema(db, tt.model)
+		assert.NoError(t, err)
+		field := versionField(sch)
+		if tt.want == "" {
+			assert.Nil(t, field)
+		} else if assert.NotNil(t, field) {
+			assert.Equal(t, tt.want, field.DBName)
+		}
+	}
+}
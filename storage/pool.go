@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/fize/go-ext/config"
+	"go.opentelemetry.io/otel/attribute"
+	api "go.opentelemetry.io/otel/metric"
+	"gorm.io/gorm"
+)
+
+// applyPool applies the connection pool settings of cfg to db, zero values keep the driver defaults
+func applyPool(db *sql.DB, cfg *config.SQLConfig) {
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	}
+	if cfg.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	}
+}
+
+// RegisterPoolMetrics exports the connection pool statistics of s with meter, e.g. middleware.Meter():
+// connections in use, idle connections, the number of waits for a connection and the total wait time in ms.
+// Storages opened after the metrics middleware is set up are registered automatically.
+func RegisterPoolMetrics(s Storage, meter api.Meter) (api.Registration, error) {
+	db, ok := s.Client().(*gorm.DB)
+	if !ok {
+		return nil, errors.New("storage is not backed by a SQL database")
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	inUse, err := meter.Int64ObservableGauge("db_client_connections_in_use",
+		api.WithDescription("number of connections in use"))
+	if err != nil {
+		return nil, err
+	}
+	idle, err := meter.Int64ObservableGauge("db_client_connections_idle",
+		api.WithDescription("number of idle connections"))
+	if err != nil {
+		return nil, err
+	}
+	waitCount, err := meter.Int64ObservableCounter("db_client_connections_wait_count",
+		api.WithDescription("total number of connections waited for"))
+	if err != nil {
+		return nil, err
+	}
+	waitDuration, err := meter.Float64ObservableCounter("db_client_connections_wait_duration",
+		api.WithDescription("total time blocked waiting for a new connection. ms"))
+	if err != nil {
+		return nil, err
+	}
+
+	name := db.Migrator().CurrentDatabase()
+	if ss, ok := s.(*sqlStorage); ok && ss.name != "" {
+		name = ss.name
+	}
+	attrs := api.WithAttributes(
+		attribute.String("db.system", db.Dialector.Name()),
+		attribute.String("db.name", name),
+	)
+	return meter.RegisterCallback(func(_ context.Context, o api.Observer) error {
+		stats := sqlDB.Stats()
+		o.ObserveInt64(inUse, int64(stats.InUse), attrs)
+		o.ObserveInt64(idle, int64(stats.Idle), attrs)
+		o.ObserveInt64(waitCount, stats.WaitCount, attrs)
+		o.ObserveFloat64(waitDuration, float64(stats.WaitDuration.Microseconds())/1000, attrs)
+		return nil
+	}, inUse, idle, waitCount, waitDuration)
+}
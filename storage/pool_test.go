@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fize/go-ext/config"
+	"github.com/fize/go-ext/log"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"gorm.io/gorm"
+)
+
+func TestApplyPool(t *testing.T) {
+	cfg, err := config.NewSQLConfig(
+		config.WithDB(filepath.Join(t.TempDir(), "pool.db")),
+		config.WithMaxIdleConns(2),
+		config.WithMaxOpenConns(4),
+		config.WithConnMaxLifetime(time.Hour),
+		config.WithConnMaxIdleTime(time.Minute),
+		config.WithDebug(true),
+	)
+	assert.NoError(t, err)
+
+	s, err := Open(context.Background(), cfg)
+	assert.NoError(t, err)
+	db := s.Client().(*gorm.DB)
+	sqlDB, err := db.DB()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, sqlDB.Stats().MaxOpenConnections)
+	assert.IsType(t, &log.ZapGormLogger{}, db.Config.Logger)
+}
+
+func TestRegisterPoolMetrics(t *testing.T) {
+	cfg, err := config.NewSQLConfig(config.WithDB(filepath.Join(t.TempDir(), "metrics.db")))
+	assert.NoError(t, err)
+	s, err := Open(context.Background(), cfg)
+	assert.NoError(t, err)
+	defer s.Close()
+
+	// hold a connection so that one is in use
+	sqlDB, err := s.Client().(*gorm.DB).DB()
+	assert.NoError(t, err)
+	conn, err := sqlDB.Conn(context.Background())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+	reg, err := RegisterPoolMetrics(s, provider.Meter("test"))
+	assert.NoError(t, err)
+	defer reg.Unregister()
+
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &rm))
+
+	values := make(map[string]any)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[int64]:
+				values[m.Name] = data.DataPoints[0].Value
+				system, _ := data.DataPoints[0].Attributes.Value(attribute.Key("db.system"))
+				assert.Equal(t, "sqlite", system.AsString())
+			case metricdata.Sum[int64]:
+				values[m.Name] = data.DataPoints[0].Value
+			case metricdata.Sum[float64]:
+				values[m.Name] = data.DataPoints[0].Value
+			}
+		}
+	}
+	assert.Equal(t, map[string]any{
+		"db_client_connections_in_use":        int64(1),
+		"db_client_connections_idle":          int64(sqlDB.Stats().Idle),
+		"db_client_connections_wait_count":    int64(0),
+		"db_client_connections_wait_duration": float64(0),
+	}, values)
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/fize/go-ext/config"
+	"golang.org/x/sync/singleflight"
+)
+
+// Registry opens the databases of a SQLConfig by name,
+// every database is opened once on first use and shared afterwards
+type Registry struct {
+	cfg *config.SQLConfig
+	// group opens a database once for concurrent calls
+	group singleflight.Group
+
+	mu       sync.Mutex
+	storages map[string]Storage
+}
+
+// NewRegistry creates a new Registry for the databases of cfg,
+// the sql section itself is the database named config.DefaultDatabase
+func NewRegistry(cfg *config.SQLConfig) *Registry {
+	return &Registry{
+		cfg:      cfg,
+		storages: make(map[string]Storage),
+	}
+}
+
+// Get returns the storage of the named database. Databases are opened outside the lock,
+// so a slow or unreachable database does not block the others, and a failed open is tried again by the next call.
+// ctx only bounds the wait of the caller, the database is opened on behalf of every waiting caller.
+func (r *Registry) Get(ctx context.Context, name string) (Storage, error) {
+	if s, ok := r.storage(name); ok {
+		return s, nil
+	}
+	cfg, ok := r.cfg.Database(name)
+	if !ok {
+		return nil, fmt.Errorf("database %s is not configured", name)
+	}
+
+	ch := r.group.DoChan(name, func() (any, error) {
+		if s, ok := r.storage(name); ok {
+			return s, nil
+		}
+		s, err := Open(context.WithoutCancel(ctx), cfg)
+		if err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.storages[name] = s
+		return s, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, fmt.Errorf("failed to open database %s: %w", name, res.Err)
+		}
+		return res.Val.(Storage), nil
+	}
+}
+
+// storage returns the opened storage of the named database
+func (r *Registry) storage(name string) (Storage, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.storages[name]
+	return s, ok
+}
+
+// Default returns the storage of the database configured directly under the sql key
+func (r *Registry) Default(ctx context.Context) (Storage, error) {
+	return r.Get(ctx, config.DefaultDatabase)
+}
+
+// Names returns the names of all configured databases, starting with config.DefaultDatabase
+func (r *Registry) Names() []string {
+	return r.cfg.DatabaseNames()
+}
+
+// Close closes every opened database
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	storages := r.storages
+	r.storages = make(map[string]Storage)
+	r.mu.Unlock()
+
+	var errs []error
+	for name, s := range storages {
+		if err := s.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close database %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fize/go-ext/config"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := config.NewSQLConfig(
+		config.WithDB(filepath.Join(dir, "primary.db")),
+		config.WithDatabase("cache", &config.SQLConfig{Type: config.Sqlite3, DB: filepath.Join(dir, "cache.db")}),
+	)
+	assert.NoError(t, err)
+
+	registry := NewRegistry(cfg)
+	assert.Equal(t, []string{config.DefaultDatabase, "cache"}, registry.Names())
+
+	primary, err := registry.Default(context.Background())
+	assert.NoError(t, err)
+	cache, err := registry.Get(context.Background(), "cache")
+	assert.NoError(t, err)
+	assert.NotSame(t, primary.Client().(*gorm.DB), cache.Client().(*gorm.DB))
+
+	// databases are opened once
+	again, err := registry.Get(context.Background(), "cache")
+	assert.NoError(t, err)
+	assert.Same(t, cache.Client().(*gorm.DB), again.Client().(*gorm.DB))
+
+	assert.NoError(t, cache.Client().(*gorm.DB).AutoMigrate(&TestModel{}))
+	assert.NoError(t, cache.Create(context.Background(), &TestModel{Name: "cached"}))
+	var model TestModel
+	assert.NoError(t, cache.GetBy(context.Background(), map[string]any{"name": "cached"}, &model))
+
+	_, err = registry.Get(context.Background(), "missing")
+	assert.EqualError(t, err, "database missing is not configured")
+
+	assert.NoError(t, registry.Close())
+	assert.Error(t, cache.Ping(context.Background()))
+}
+
+func TestRegistryOpenOutsideLock(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := config.NewSQLConfig(
+		config.WithDB(filepath.Join(dir, "primary.db")),
+		// nothing listens on port 1, the retries keep the open busy
+		config.WithDatabase("down", &config.SQLConfig{
+			Type:           config.MySQL,
+			Host:           "127.0.0.1:1",
+			DB:             "app",
+			ConnectRetries: 3,
+			ConnectBackoff: 200 * time.Millisecond,
+		}),
+	)
+	assert.NoError(t, err)
+	registry := NewRegistry(cfg)
+	defer registry.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	_, err = registry.Get(ctx, "down")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// The open of the unreachable database does not block the others
+	_, err = registry.Default(context.Background())
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(begin), 500*time.Millisecond)
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"math/rand/v2"
+	"sync/atomic"
+
+	"github.com/fize/go-ext/config"
+	"gorm.io/gorm"
+)
+
+// usePrimaryKey is the context key forcing reads to the primary
+type usePrimaryKey struct{}
+
+// ContextWithPrimary returns a context whose reads go to the primary instead of a replica,
+// e.g. to read a record right after writing it, before the write reaches the replicas
+func ContextWithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, usePrimaryKey{}, true)
+}
+
+// usePrimary reports whether the reads of ctx go to the primary
+func usePrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(usePrimaryKey{}).(bool)
+	return primary
+}
+
+// replica is a read replica of a database
+type replica struct {
+	// host is the configured replica, it names the replica in errors
+	host  string
+	db    *gorm.DB
+	sqlDB *sql.DB
+}
+
+// replicaPolicy picks the replica of a read
+type replicaPolicy interface {
+	pick(replicas []*replica) *replica
+}
+
+// newReplicaPolicy returns the policy of a config.SQLConfig.ReplicaPolicy, random by default
+func newReplicaPolicy(name string) replicaPolicy {
+	switch name {
+	case config.ReplicaRoundRobin:
+		return &roundRobinPolicy{}
+	case config.ReplicaLeastConnections:
+		return &leastConnPolicy{}
+	default:
+		return randomPolicy{}
+	}
+}
+
+// randomPolicy picks a random replica
+type randomPolicy struct{}
+
+func (randomPolicy) pick(replicas []*replica) *replica {
+	return replicas[rand.IntN(len(replicas))]
+}
+
+// roundRobinPolicy picks the replicas in turn
+type roundRobinPolicy struct {
+	next atomic.Uint64
+}
+
+func (p *roundRobinPolicy) pick(replicas []*replica) *replica {
+	return replicas[(p.next.Add(1)-1)%uint64(len(replicas))]
+}
+
+// leastConnPolicy picks the replica with the fewest connections in use,
+// ties are broken in turn so idle replicas share the load
+type leastConnPolicy struct {
+	next atomic.Uint64
+}
+
+func (p *leastConnPolicy) pick(replicas []*replica) *replica {
+	start := int((p.next.Add(1) - 1) % uint64(len(replicas)))
+	var picked *replica
+	least := -1
+	for i := range replicas {
+		r := replicas[(start+i)%len(replicas)]
+		if inUse := r.sqlDB.Stats().InUse; least < 0 || inUse < least {
+			picked, least = r, inUse
+		}
+	}
+	return picked
+}
+
+// reader returns the connection of a read with ctx: a replica, unless s has none, the read is part of
+// a transaction or ctx forces the primary with ContextWithPrimary
+func (s *sqlStorage) reader(ctx context.Context) *gorm.DB {
+	if len(s.replicas) == 0 || s.root != nil || usePrimary(ctx) {
+		return s.conn(ctx)
+	}
+	if tx, ok := s.txOf(ctx); ok {
+		return tx.db.WithContext(ctx)
+	}
+	return s.policy.pick(s.replicas).db.WithContext(ctx)
+}
+
+// replicaConfig returns the configuration of a replica of cfg
+func replicaConfig(cfg *config.SQLConfig, host string) *config.SQLConfig {
+	c := *cfg
+	c.Replicas, c.Databases = nil, nil
+	if c.Type == config.Sqlite3 || c.Type == "" {
+		c.DB = host
+	} else {
+		c.Host = host
+	}
+	return &c
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/fize/go-ext/config"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupReplicas opens a sqlite primary with two sqlite files as stand-in replicas,
+// every database holds one record named after it
+func setupReplicas(t *testing.T, policy string) *sqlStorage {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{}
+	for _, name := range []string{"primary", "replica-1", "replica-2"} {
+		files[name] = filepath.Join(dir, name+".db")
+		db, err := gorm.Open(sqlite.Open(files[name]), &gorm.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AutoMigrate(&TestModel{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(&TestModel{ID: 1, Name: name}).Error; err != nil {
+			t.Fatal(err)
+		}
+		closeDB(db)
+	}
+
+	cfg, err := config.NewSQLConfig(
+		config.WithDB(files["primary"]),
+		config.WithReplicas(files["replica-1"], files["replica-2"]),
+		config.WithReplicaPolicy(policy),
+	)
+	assert.NoError(t, err)
+	s, err := Open(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s.(*sqlStorage)
+}
+
+// readFrom returns the name of the database serving a read with ctx
+func readFrom(t *testing.T, s Storage, ctx context.Context) string {
+	t.Helper()
+	var model TestModel
+	assert.NoError(t, s.Get(ctx, 1, &model))
+	return model.Name
+}
+
+func TestReplicaRouting(t *testing.T) {
+	s := setupReplicas(t, config.ReplicaRoundRobin)
+	ctx := context.Background()
+	assert.NoError(t, s.Ping(ctx))
+
+	// Reads take the replicas in turn
+	assert.Equal(t, "replica-1", readFrom(t, s, ctx))
+	assert.Equal(t, "replica-2", readFrom(t, s, ctx))
+	assert.Equal(t, "replica-1", readFrom(t, s, ctx))
+
+	var models []TestModel
+	total, err := s.List(ctx, &Query{}, &models, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, "replica-2", models[0].Name)
+
+	// Writes go to the primary, a forced primary read sees them at once
+	assert.NoError(t, s.Create(ctx, &TestModel{ID: 2, Name: "written"}))
+	primary := ContextWithPrimary(ctx)
+	count, err := s.Count(primary, &Query{}, &TestModel{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, "primary", readFrom(t, s, primary))
+	var model TestModel
+	assert.Error(t, s.GetBy(ctx, map[string]any{"name": "written"}, &model))
+
+	// Reads in a transaction go to the primary
+	err = s.Transaction(ctx, func(tx Storage) error {
+		assert.Equal(t, "primary", readFrom(t, tx, ctx))
+		assert.Equal(t, "primary", readFrom(t, s, ContextWithTx(ctx, tx)))
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestReplicaPolicies(t *testing.T) {
+	t.Run("random", func(t *testing.T) {
+		s := setupReplicas(t, config.ReplicaRandom)
+		seen := map[string]bool{}
+		for range 50 {
+			seen[readFrom(t, s, context.Background())] = true
+		}
+		assert.Equal(t, map[string]bool{"replica-1": true, "replica-2": true}, seen)
+	})
+
+	t.Run("least connections", func(t *testing.T) {
+		s := setupReplicas(t, config.ReplicaLeastConnections)
+		ctx := context.Background()
+
+		// Idle replicas share the load
+		assert.Equal(t, "replica-1", readFrom(t, s, ctx))
+		assert.Equal(t, "replica-2", readFrom(t, s, ctx))
+
+		// A busy replica is skipped
+		conn, err := s.replicas[0].sqlDB.Conn(ctx)
+		assert.NoError(t, err)
+		defer conn.Close()
+		for range 3 {
+			assert.Equal(t, "replica-2", readFrom(t, s, ctx))
+		}
+	})
+}
+
+func TestOpenReplicaErrors(t *testing.T) {
+	cfg, err := config.NewSQLConfig(config.WithDSN("file::memory:"), config.WithReplicas("replica.db"))
+	assert.NoError(t, err)
+	_, err = Open(context.Background(), cfg)
+	assert.EqualError(t, err, "replicas cannot be used with a data source name")
+
+	cfg, err = config.NewSQLConfig(
+		config.WithDB(filepath.Join(t.TempDir(), "primary.db")),
+		config.WithReplicas(filepath.Join(t.TempDir(), "missing", "replica.db")),
+	)
+	assert.NoError(t, err)
+	_, err = Open(context.Background(), cfg)
+	assert.ErrorContains(t, err, "failed to open replica")
+}
+
+func TestReplicaConfig(t *testing.T) {
+	cfg := &config.SQLConfig{Type: config.MySQL, Host: "primary:3306", DB: "app", Replicas: []string{"replica:3306"}}
+	r := replicaConfig(cfg, "replica:3306")
+	assert.Equal(t, "replica:3306", r.Host)
+	assert.Equal(t, "app", r.DB)
+	assert.Empty(t, r.Replicas)
+	assert.Equal(t, "primary:3306", cfg.Host)
+
+	r = replicaConfig(&config.SQLConfig{Type: config.Sqlite3, DB: "app.db"}, "replica.db")
+	assert.Equal(t, "replica.db", r.DB)
+}
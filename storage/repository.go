@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Page is a page of records of a Repository
+type Page[T any] struct {
+	// Items are the records of the page
+	Items []T
+	// Total is the number of matching records, -1 if the count was skipped for cursor pagination
+	Total int64
+	// Page is the page number of offset pagination
+	Page int
+	// Size is the page size
+	Size int
+	// Next is the cursor of the following page of cursor pagination, empty on the last page
+	Next string
+	// Prev is the cursor of the preceding page of cursor pagination, empty on the first page
+	Prev string
+}
+
+// Repository is a typed Storage of the records of the model T, e.g. Repository[User].
+// The records are passed as *T, so passing a value instead of a pointer fails to compile.
+type Repository[T any] struct {
+	s Storage
+}
+
+// NewRepository creates a new Repository of T on s, T is a model struct and not a pointer
+func NewRepository[T any](s Storage) *Repository[T] {
+	return &Repository[T]{s: s}
+}
+
+// Storage returns the underlying storage
+func (r *Repository[T]) Storage() Storage {
+	return r.s
+}
+
+// WithTx returns the repository of T on the storage of a transaction, e.g. the tx of Storage.Transaction
+func (r *Repository[T]) WithTx(tx Storage) *Repository[T] {
+	return &Repository[T]{s: tx}
+}
+
+// Create creates a new record, the generated primary key is set on model
+func (r *Repository[T]) Create(ctx context.Context, model *T) error {
+	return r.s.Create(ctx, model)
+}
+
+// Get retrieves a record by ID
+func (r *Repository[T]) Get(ctx context.Context, id uint64) (*T, error) {
+	result := new(T)
+	if err := r.s.Get(ctx, id, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetBy retrieves the first record that matches the filter
+func (r *Repository[T]) GetBy(ctx context.Context, filter map[string]any) (*T, error) {
+	result := new(T)
+	if err := r.s.GetBy(ctx, filter, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// List retrieves a page of records with offset pagination
+func (r *Repository[T]) List(ctx context.Context, query Query) (Page[T], error) {
+	var items []T
+	total, err := r.s.List(ctx, &query, &items, nil)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	return Page[T]{Items: items, Total: total, Page: query.Page, Size: query.Size}, nil
+}
+
+// ListCursor retrieves a page of records with cursor pagination, see Storage.ListCursor
+func (r *Repository[T]) ListCursor(ctx context.Context, query Query) (Page[T], error) {
+	var items []T
+	cp, err := r.s.ListCursor(ctx, &query, &items)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	return Page[T]{Items: items, Total: cp.Total, Size: query.Size, Next: cp.Next, Prev: cp.Prev}, nil
+}
+
+// Update updates the non-zero fields of model on the record with ID, see Storage.Update for versioned models
+func (r *Repository[T]) Update(ctx context.Context, id uint64, model *T) error {
+	return r.s.Update(ctx, id, model)
+}
+
+// Patch updates only the given columns of the record with ID, see Storage.Patch
+func (r *Repository[T]) Patch(ctx context.Context, id uint64, changes map[string]any) error {
+	return r.s.Patch(ctx, id, new(T), changes)
+}
+
+// PatchFields updates only the given fields of model on the record with ID, see Storage.PatchFields
+func (r *Repository[T]) PatchFields(ctx context.Context, id uint64, model *T, fields ...string) error {
+	return r.s.PatchFields(ctx, id, model, fields...)
+}
+
+// Delete deletes a record by ID, it is soft-deleted if T has a gorm.DeletedAt field
+func (r *Repository[T]) Delete(ctx context.Context, id uint64) error {
+	return r.s.Delete(ctx, id, new(T))
+}
+
+// Restore restores a soft-deleted record by ID
+func (r *Repository[T]) Restore(ctx context.Context, id uint64) error {
+	return r.s.Restore(ctx, id, new(T))
+}
+
+// Purge deletes a record by ID permanently
+func (r *Repository[T]) Purge(ctx context.Context, id uint64) error {
+	return r.s.Purge(ctx, id, new(T))
+}
+
+// ListDeleted retrieves a page of soft-deleted records
+func (r *Repository[T]) ListDeleted(ctx context.Context, query Query) (Page[T], error) {
+	var items []T
+	total, err := r.s.ListDeleted(ctx, &query, &items)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	return Page[T]{Items: items, Total: total, Page: query.Page, Size: query.Size}, nil
+}
+
+// Upsert creates the record of model if its primary key is zero or does not exist yet, and updates it otherwise.
+// The update is an Update, so the version of model is checked and a soft-deleted record is not restored.
+func (r *Repository[T]) Upsert(ctx context.Context, model *T) error {
+	id, err := primaryKey(ctx, model)
+	if err != nil {
+		return err
+	}
+	if id == 0 {
+		return r.Create(ctx, model)
+	}
+	return r.s.Transaction(ctx, func(tx Storage) error {
+		err := tx.Get(ctx, id, new(T))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tx.Create(ctx, model)
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Update(ctx, id, model)
+	})
+}
+
+// CreateBatch creates models with one statement per batchSize records, see Storage.CreateBatch
+func (r *Repository[T]) CreateBatch(ctx context.Context, models []T, batchSize int, opts ...BatchOption) error {
+	return r.s.CreateBatch(ctx, models, batchSize, opts...)
+}
+
+// UpdateWhere sets the columns of values on the records that match query, see Storage.UpdateWhere
+func (r *Repository[T]) UpdateWhere(ctx context.Context, query Query, values map[string]any, opts ...BatchOption) (int64, error) {
+	return r.s.UpdateWhere(ctx, &query, new(T), values, opts...)
+}
+
+// Exists reports whether a record matches the Filter and Where of query
+func (r *Repository[T]) Exists(ctx context.Context, query Query) (bool, error) {
+	n, err := r.Count(ctx, query)
+	return n > 0, err
+}
+
+// Count returns the number of records that match the Filter and Where of query
+func (r *Repository[T]) Count(ctx context.Context, query Query) (int64, error) {
+	return r.s.Count(ctx, &query, new(T))
+}
+
+// schemas caches the parsed schemas of the repository models
+var schemas sync.Map
+
+// primaryKey returns the integer primary key of model, 0 if it is not set
+func primaryKey(ctx context.Context, model any) (uint64, error) {
+	sch, err := schema.Parse(model, &schemas, schema.NamingStrategy{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse model: %v", err)
+	}
+	pk := sch.PrioritizedPrimaryField
+	if pk == nil {
+		return 0, fmt.Errorf("%s has no primary key", sch.Name)
+	}
+	value, zero := pk.ValueOf(ctx, reflect.ValueOf(model).Elem())
+	if zero {
+		return 0, nil
+	}
+	v := reflect.Indirect(reflect.ValueOf(value))
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	}
+	return 0, fmt.Errorf("primary key %s of %s is not an integer", pk.Name, sch.Name)
+}
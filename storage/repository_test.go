@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/fize/go-ext/config"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// setupRepository opens an in-memory sqlite database with the people table
+func setupRepository(t *testing.T) *Repository[Person] {
+	t.Helper()
+	// Every connection opens its own in-memory database, so only one is used
+	cfg, err := config.NewSQLConfig(config.WithDB(":memory:"), config.WithMaxOpenConns(1))
+	assert.NoError(t, err)
+	store, err := Open(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := store.Client().(*gorm.DB).AutoMigrate(&Person{}); err != nil {
+		t.Fatal(err)
+	}
+	return NewRepository[Person](store)
+}
+
+func TestRepository(t *testing.T) {
+	repo := setupRepository(t)
+	ctx := context.Background()
+
+	p := &Person{Name: "Alice", Age: 30}
+	assert.NoError(t, repo.Create(ctx, p))
+	assert.NotZero(t, p.ID)
+
+	got, err := repo.Get(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice", got.Name)
+
+	got, err = repo.GetBy(ctx, map[string]any{"name": "Alice"})
+	assert.NoError(t, err)
+	assert.Equal(t, p.ID, got.ID)
+
+	assert.NoError(t, repo.Update(ctx, p.ID, &Person{Age: 31}))
+	got, err = repo.Get(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 31, got.Age)
+	assert.Equal(t, "Alice", got.Name)
+
+	assert.NoError(t, repo.Delete(ctx, p.ID))
+	got, err = repo.Get(ctx, p.ID)
+	assert.Nil(t, got)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+}
+
+func TestRepositoryList(t *testing.T) {
+	repo := setupRepository(t)
+	ctx := context.Background()
+
+	for _, p := range []*Person{{Name: "a", Age: 10}, {Name: "b", Age: 20}, {Name: "c", Age: 30}, {Name: "d", Age: 40}} {
+		assert.NoError(t, repo.Create(ctx, p))
+	}
+
+	page, err := repo.List(ctx, Query{Page: 2, Size: 2, Sort: []Sort{Desc("age")}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), page.Total)
+	assert.Equal(t, 2, page.Page)
+	assert.Equal(t, 2, page.Size)
+	assert.Equal(t, []string{"b", "a"}, personNames(page.Items))
+
+	page, err = repo.ListCursor(ctx, Query{Size: 3, Where: Gt("age", 10), SkipCount: true})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), page.Total)
+	assert.Equal(t, []string{"b", "c", "d"}, personNames(page.Items))
+	assert.Empty(t, page.Next)
+	assert.Empty(t, page.Prev)
+
+	n, err := repo.Count(ctx, Query{Where: Gte("age", 20)})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	ok, err := repo.Exists(ctx, Query{Filter: map[string]any{"name": "c"}})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = repo.Exists(ctx, Query{Filter: map[string]any{"name": "z"}})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = repo.Count(ctx, Query{Filter: map[string]any{"password": "x"}})
+	assert.EqualError(t, err, "invalid filter: unknown column password")
+}
+
+func TestRepositoryUpsert(t *testing.T) {
+	repo := setupRepository(t)
+	ctx := context.Background()
+
+	// Without a primary key the record is created
+	p := &Person{Name: "a", Age: 10}
+	assert.NoError(t, repo.Upsert(ctx, p))
+	assert.NotZero(t, p.ID)
+
+	// An existing record is updated
+	assert.NoError(t, repo.Upsert(ctx, &Person{ID: p.ID, Age: 11}))
+	got, err := repo.Get(ctx, p.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 11, got.Age)
+
+	// A missing record is created with its primary key
+	assert.NoError(t, repo.Upsert(ctx, &Person{ID: 100, Name: "b"}))
+	got, err = repo.Get(ctx, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", got.Name)
+
+	n, err := repo.Count(ctx, Query{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+}
+
+func TestRepositoryWithTx(t *testing.T) {
+	repo := setupRepository(t)
+	ctx := context.Background()
+	errAbort := errors.New("abort")
+
+	err := repo.Storage().Transaction(ctx, func(tx Storage) error {
+		if err := repo.WithTx(tx).Create(ctx, &Person{Name: "a"}); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	assert.Equal(t, errAbort, err)
+
+	ok, err := repo.Exists(ctx, Query{})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestRepositoryUpsertVersion(t *testing.T) {
+	repo, doc := setupDocs(t)
+	ctx := context.Background()
+
+	// The version of an existing record is checked and increased
+	assert.NoError(t, repo.Upsert(ctx, &Doc{ID: doc.ID, Title: "final", Version: 1}))
+	got, err := repo.Get(ctx, doc.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, Doc{ID: doc.ID, Title: "final", Views: 3, Version: 2}, *got)
+
+	err = repo.Upsert(ctx, &Doc{ID: doc.ID, Title: "stale", Version: 1})
+	assert.True(t, errors.Is(err, ErrConflict))
+}
+
+func TestPrimaryKey(t *testing.T) {
+	ctx := context.Background()
+	type keyless struct {
+		Name string
+	}
+	type stringKey struct {
+		Code string `gorm:"primaryKey"`
+	}
+
+	id, err := primaryKey(ctx, &Person{ID: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(7), id)
+
+	id, err = primaryKey(ctx, &Person{})
+	assert.NoError(t, err)
+	assert.Zero(t, id)
+
+	_, err = primaryKey(ctx, &keyless{Name: "a"})
+	assert.EqualError(t, err, "keyless has no primary key")
+
+	_, err = primaryKey(ctx, &stringKey{Code: "a"})
+	assert.EqualError(t, err, "primary key Code of stringKey is not an integer")
+}
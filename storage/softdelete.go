@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// Restore implements Storage.Restore
+func (s *sqlStorage) Restore(ctx context.Context, id uint64, model any) error {
+	db := s.conn(ctx)
+	sch, err := parseSchema(db, model)
+	if err != nil {
+		return err
+	}
+	deletedAt, err := deletedAtField(sch)
+	if err != nil {
+		return err
+	}
+	if sch.PrioritizedPrimaryField == nil {
+		return fmt.Errorf("%s has no primary key", sch.Name)
+	}
+
+	result := db.Unscoped().Model(model).
+		Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: sch.PrioritizedPrimaryField.DBName}, Value: id}).
+		Where(clause.Neq{Column: clause.Column{Table: clause.CurrentTable, Name: deletedAt.DBName}, Value: nil}).
+		Update(deletedAt.DBName, nil)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Purge implements Storage.Purge
+func (s *sqlStorage) Purge(ctx context.Context, id uint64, model any) error {
+	return translateError(s.conn(ctx).Unscoped().Delete(model, id).Error)
+}
+
+// ListDeleted implements Storage.ListDeleted
+func (s *sqlStorage) ListDeleted(ctx context.Context, query *Query, result any) (int64, error) {
+	sch, err := parseSchema(s.reader(ctx), result)
+	if err != nil {
+		return 0, err
+	}
+	deletedAt, err := deletedAtField(sch)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := *query
+	deleted.IncludeDeleted = true
+	deleted.Where = IsNull(deletedAt.DBName, false)
+	if query.Where != nil {
+		deleted.Where = And(deleted.Where, query.Where)
+	}
+	return s.List(ctx, &deleted, result, nil)
+}
+
+// deletedAtField returns the gorm.DeletedAt field of sch
+func deletedAtField(sch *schema.Schema) (*schema.Field, error) {
+	for _, field := range sch.Fields {
+		if field.FieldType == deletedAtType && field.DBName != "" {
+			return field, nil
+		}
+	}
+	return nil, fmt.Errorf("%s does not support soft delete, it has no gorm.DeletedAt field", sch.Name)
+}
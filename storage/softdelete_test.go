@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// Note is a model with soft delete
+type Note struct {
+	ID        uint64 `gorm:"primaryKey"`
+	Title     string
+	DeletedAt gorm.DeletedAt
+}
+
+func setupNotes(t *testing.T) (*Repository[Note], []*Note) {
+	t.Helper()
+	db := setupSqliteDB(t)
+	assert.NoError(t, db.AutoMigrate(&Note{}))
+	repo := NewRepository[Note](&sqlStorage{db: db})
+	notes := []*Note{{Title: "a"}, {Title: "b"}, {Title: "c"}}
+	for _, n := range notes {
+		assert.NoError(t, repo.Create(context.Background(), n))
+	}
+	return repo, notes
+}
+
+func noteTitles(notes []Note) []string {
+	titles := make([]string, 0, len(notes))
+	for _, n := range notes {
+		titles = append(titles, n.Title)
+	}
+	return titles
+}
+
+func TestSoftDelete(t *testing.T) {
+	repo, notes := setupNotes(t)
+	ctx := context.Background()
+
+	assert.NoError(t, repo.Delete(ctx, notes[0].ID))
+	assert.NoError(t, repo.Storage().DeleteBy(ctx, map[string]any{"title": "b"}, &Note{}))
+
+	// Deleted records are hidden
+	_, err := repo.Get(ctx, notes[0].ID)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+	page, err := repo.List(ctx, Query{Sort: []Sort{Asc("title")}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c"}, noteTitles(page.Items))
+
+	// unless they are included
+	page, err = repo.List(ctx, Query{Sort: []Sort{Asc("title")}, IncludeDeleted: true})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), page.Total)
+	n, err := repo.Count(ctx, Query{IncludeDeleted: true})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+
+	// The trash can lists the deleted records only
+	page, err = repo.ListDeleted(ctx, Query{Sort: []Sort{Asc("title")}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), page.Total)
+	assert.Equal(t, []string{"a", "b"}, noteTitles(page.Items))
+	page, err = repo.ListDeleted(ctx, Query{Where: Eq("title", "b")})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, noteTitles(page.Items))
+}
+
+func TestRestore(t *testing.T) {
+	repo, notes := setupNotes(t)
+	ctx := context.Background()
+
+	assert.NoError(t, repo.Delete(ctx, notes[0].ID))
+	assert.NoError(t, repo.Restore(ctx, notes[0].ID))
+	got, err := repo.Get(ctx, notes[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", got.Title)
+
+	// Only deleted records can be restored
+	assert.True(t, errors.Is(repo.Restore(ctx, notes[0].ID), gorm.ErrRecordNotFound))
+	assert.True(t, errors.Is(repo.Restore(ctx, 100), gorm.ErrRecordNotFound))
+}
+
+func TestPurge(t *testing.T) {
+	repo, notes := setupNotes(t)
+	ctx := context.Background()
+
+	// Deleted and live records are removed permanently
+	assert.NoError(t, repo.Delete(ctx, notes[0].ID))
+	assert.NoError(t, repo.Purge(ctx, notes[0].ID))
+	assert.NoError(t, repo.Purge(ctx, notes[1].ID))
+
+	n, err := repo.Count(ctx, Query{IncludeDeleted: true})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.True(t, errors.Is(repo.Restore(ctx, notes[0].ID), gorm.ErrRecordNotFound))
+}
+
+func TestSoftDeleteUnsupported(t *testing.T) {
+	store := &sqlStorage{db: setupSqliteDB(t)}
+	ctx := context.Background()
+
+	err := store.Restore(ctx, 1, &TestModel{})
+	assert.EqualError(t, err, "TestModel does not support soft delete, it has no gorm.DeletedAt field")
+	var results []TestModel
+	_, err = store.ListDeleted(ctx, &Query{}, &results)
+	assert.EqualError(t, err, "TestModel does not support soft delete, it has no gorm.DeletedAt field")
+
+	// Models without soft delete are deleted permanently
+	model := &TestModel{Name: "a"}
+	assert.NoError(t, store.Create(ctx, model))
+	assert.NoError(t, store.Delete(ctx, model.ID, &TestModel{}))
+	n, err := store.Count(ctx, &Query{IncludeDeleted: true}, &TestModel{})
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+}
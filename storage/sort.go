@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/fize/go-ext/config"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Nulls defines where NULL values are sorted
+type Nulls string
+
+const (
+	// NullsDefault keeps the default of the database, first for asc on mysql and sqlite, last on postgres
+	NullsDefault Nulls = ""
+	// NullsFirst sorts NULL values before all other values
+	NullsFirst Nulls = "first"
+	// NullsLast sorts NULL values after all other values
+	NullsLast Nulls = "last"
+)
+
+// Sort is a sort condition of Query.Sort, e.g. []Sort{Desc("created_at"), Asc("name").NullsLast()}
+type Sort struct {
+	// Field is a column or field name of the model
+	Field string
+	// Desc sorts in descending order
+	Desc bool
+	// Nulls defines where NULL values are sorted
+	Nulls Nulls
+}
+
+// Asc sorts by field in ascending order
+func Asc(field string) Sort {
+	return Sort{Field: field}
+}
+
+// Desc sorts by field in descending order
+func Desc(field string) Sort {
+	return Sort{Field: field, Desc: true}
+}
+
+// NullsFirst returns s sorting NULL values first
+func (s Sort) NullsFirst() Sort {
+	s.Nulls = NullsFirst
+	return s
+}
+
+// NullsLast returns s sorting NULL values last
+func (s Sort) NullsLast() Sort {
+	s.Nulls = NullsLast
+	return s
+}
+
+// sortKey is a sort condition resolved against the model schema
+type sortKey struct {
+	field *schema.Field
+	desc  bool
+	nulls Nulls
+}
+
+// String returns the key as in a sort parameter, e.g. -created_at
+func (k sortKey) String() string {
+	if k.desc {
+		return "-" + k.field.DBName
+	}
+	return k.field.DBName
+}
+
+// sortKeys resolves sorts against sch, only columns of the model are accepted.
+// The primary key is appended in the direction of the last key to make the order stable,
+// so that an index such as (created_at, id) can be used.
+func sortKeys(sch *schema.Schema, sorts []Sort) ([]sortKey, error) {
+	keys := make([]sortKey, 0, len(sorts)+1)
+	for _, s := range sorts {
+		field := sch.LookUpField(s.Field)
+		if field == nil || field.DBName == "" {
+			return nil, invalidFilter("invalid sort: unknown column %s", s.Field)
+		}
+		switch s.Nulls {
+		case NullsDefault, NullsFirst, NullsLast:
+		default:
+			return nil, invalidFilter("invalid sort: unknown nulls order %s", s.Nulls)
+		}
+		keys = append(keys, sortKey{field: field, desc: s.Desc, nulls: s.Nulls})
+	}
+
+	pk := sch.PrioritizedPrimaryField
+	if pk == nil || pk.DBName == "" {
+		return keys, nil
+	}
+	for _, k := range keys {
+		if k.field == pk {
+			return keys, nil
+		}
+	}
+	desc := len(keys) > 0 && keys[len(keys)-1].desc
+	return append(keys, sortKey{field: pk, desc: desc}), nil
+}
+
+// orderBy returns the ORDER BY clause of keys, the order is reversed if reverse is set.
+// mysql has no NULLS FIRST and NULLS LAST, NULL values are sorted with column IS NULL instead.
+func orderBy(dialect string, keys []sortKey, reverse bool) clause.OrderBy {
+	terms := make([]string, 0, len(keys))
+	vars := make([]any, 0, len(keys))
+	for _, k := range keys {
+		column := clause.Column{Table: clause.CurrentTable, Name: k.field.DBName}
+		desc := k.desc != reverse
+		nulls := k.nulls
+		if reverse {
+			switch nulls {
+			case NullsFirst:
+				nulls = NullsLast
+			case NullsLast:
+				nulls = NullsFirst
+			}
+		}
+
+		if nulls != NullsDefault && dialect == config.MySQL {
+			if nulls == NullsFirst {
+				terms = append(terms, "? IS NULL DESC")
+			} else {
+				terms = append(terms, "? IS NULL")
+			}
+			vars = append(vars, column)
+			nulls = NullsDefault
+		}
+
+		term := "?"
+		if desc {
+			term += " DESC"
+		}
+		switch nulls {
+		case NullsFirst:
+			term += " NULLS FIRST"
+		case NullsLast:
+			term += " NULLS LAST"
+		}
+		terms = append(terms, term)
+		vars = append(vars, column)
+	}
+	return clause.OrderBy{Expression: clause.Expr{SQL: strings.Join(terms, ", "), Vars: vars}}
+}
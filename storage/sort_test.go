@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListSortSqlite(t *testing.T) {
+	db := setupSqliteDB(t)
+	assert.NoError(t, db.AutoMigrate(&Person{}))
+	store := &sqlStorage{db: db}
+	ctx := context.Background()
+
+	a, b := "a@example.com", "b@example.com"
+	for _, p := range []*Person{
+		{Name: "p1", Age: 20},
+		{Name: "p2", Age: 30, Email: &b},
+		{Name: "p3", Age: 30},
+		{Name: "p4", Age: 20, Email: &a},
+		{Name: "p5", Age: 30, Email: &a},
+	} {
+		assert.NoError(t, store.Create(ctx, p))
+	}
+
+	tests := []struct {
+		name string
+		sort []Sort
+		want []string
+	}{
+		{name: "columns in order", sort: []Sort{Desc("age"), Asc("name")}, want: []string{"p2", "p3", "p5", "p1", "p4"}},
+		{name: "primary key breaks ties", sort: []Sort{Asc("age")}, want: []string{"p1", "p4", "p2", "p3", "p5"}},
+		{name: "descending tiebreaker", sort: []Sort{Desc("Age")}, want: []string{"p5", "p3", "p2", "p4", "p1"}},
+		{name: "nulls last", sort: []Sort{Asc("email").NullsLast()}, want: []string{"p4", "p5", "p2", "p1", "p3"}},
+		{name: "nulls first", sort: []Sort{Desc("email").NullsFirst()}, want: []string{"p3", "p1", "p2", "p5", "p4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var people []Person
+			_, err := store.List(ctx, &Query{Sort: tt.sort}, &people, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, personNames(people))
+		})
+	}
+}
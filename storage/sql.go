@@ -4,100 +4,312 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"slices"
+	"time"
 
 	"github.com/fize/go-ext/config"
+	"github.com/fize/go-ext/ginserver/middleware"
 	"github.com/fize/go-ext/log"
+	api "go.opentelemetry.io/otel/metric"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
 )
 
+// longest wait between connect retries
+const _maxBackoff = 30 * time.Second
+
 // sqlStorage represents the Storage implementation with GORM
 type sqlStorage struct {
 	db *gorm.DB
+	// name is the configured database name, reported with the pool metrics
+	name string
+	// metrics is the registration of the pool metrics
+	metrics api.Registration
+	// root is the storage a transaction was started from, nil unless db is a transaction
+	root *sqlStorage
+	// cursorKey signs the pagination cursors, a per-process key is used if it is empty
+	cursorKey []byte
+	// replicas serve the reads outside transactions, picked by policy
+	replicas []*replica
+	policy   replicaPolicy
 }
 
-// NewSQLStorage creates a new Storage instance
+// NewSQLStorage creates a new Storage instance and exits the process if the database cannot be opened.
+//
+// Deprecated: use Open, which returns the error and retries failed connections.
 func NewSQLStorage(cfg *config.SQLConfig) Storage {
-	var db *gorm.DB
-	var err error
-	if cfg.Type == config.MySQL {
-		dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-			cfg.User, cfg.Password, cfg.Host, cfg.DB)
-		db, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	s, err := Open(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	return s
+}
+
+// Open opens the database of cfg and its read replicas and applies their pool settings.
+// A failed connection is retried cfg.ConnectRetries times with a backoff starting at cfg.ConnectBackoff,
+// ctx stops the retries, e.g. on shutdown.
+func Open(ctx context.Context, cfg *config.SQLConfig) (Storage, error) {
+	if len(cfg.Replicas) > 0 && cfg.DSN != "" {
+		return nil, errors.New("replicas cannot be used with a data source name")
+	}
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sqlStorage{
+		db:        db,
+		name:      cfg.DB,
+		cursorKey: []byte(cfg.CursorSecret.Value()),
+		policy:    newReplicaPolicy(cfg.ReplicaPolicy),
+	}
+	for _, host := range cfg.Replicas {
+		rdb, err := openDB(ctx, replicaConfig(cfg, host))
 		if err != nil {
-			log.Fatalf("failed to connect database with driver 'mysql': %v", err)
+			s.Close()
+			return nil, fmt.Errorf("failed to open replica %s: %w", host, err)
 		}
-	} else {
-		db, err = gorm.Open(sqlite.Open(cfg.DB), &gorm.Config{})
+		sqlDB, _ := rdb.DB()
+		s.replicas = append(s.replicas, &replica{host: host, db: rdb, sqlDB: sqlDB})
+	}
+	// Export the pool statistics once the metrics middleware is set up
+	if meter := middleware.Meter(); meter != nil {
+		if s.metrics, err = RegisterPoolMetrics(s, meter); err != nil {
+			log.Warnf("failed to register database pool metrics: %v", err)
+		}
+	}
+	return s, nil
+}
+
+// openDB opens the database of cfg with retries and applies its pool settings
+func openDB(ctx context.Context, cfg *config.SQLConfig) (*gorm.DB, error) {
+	dsn, err := DSN(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build data source name: %v", err)
+	}
+
+	var db *gorm.DB
+	err = retry(ctx, cfg.ConnectRetries, cfg.ConnectBackoff, func() error {
+		var err error
+		db, err = gorm.Open(dialector(cfg.Type, dsn), gormConfig(cfg))
 		if err != nil {
-			log.Fatalf("failed to connect database with driver 'sqlite': %v", err)
+			closeDB(db)
+			return fmt.Errorf("failed to connect database with driver '%s': %v", cfg.Type, err)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the database handle: %v", err)
+	}
+	applyPool(sqlDB, cfg)
+	return db, nil
+}
+
+// retry calls fn until it succeeds or has been retried retries times,
+// the wait between attempts starts at backoff and doubles up to _maxBackoff
+func retry(ctx context.Context, retries int, backoff time.Duration, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= retries {
+			return err
+		}
+		log.Warnf("%v, retrying in %s (%d/%d)", err, backoff, attempt+1, retries)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%v: %w", err, ctx.Err())
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, _maxBackoff)
+	}
+}
+
+// closeDB closes the connections of a partially opened database
+func closeDB(db *gorm.DB) {
+	if db == nil {
+		return
 	}
-	return &sqlStorage{
-		db: db,
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
 	}
 }
 
+// dialector returns the GORM dialector of the database type
+func dialector(typ, dsn string) gorm.Dialector {
+	switch typ {
+	case config.MySQL:
+		return mysql.Open(dsn)
+	case config.Postgres:
+		return postgres.Open(dsn)
+	default:
+		return sqlite.Open(dsn)
+	}
+}
+
+// gormConfig returns the GORM configuration of cfg
+func gormConfig(cfg *config.SQLConfig) *gorm.Config {
+	level := logger.Warn
+	if cfg.Debug {
+		level = logger.Info
+	}
+	gc := &gorm.Config{
+		Logger: log.GormLogger(level),
+	}
+	if cfg.Type == config.Postgres && cfg.Schema != "" {
+		gc.NamingStrategy = schema.NamingStrategy{TablePrefix: cfg.Schema + "."}
+	}
+	return gc
+}
+
 // Client implements Storage.Client
 func (s *sqlStorage) Client() any {
 	return s.db
 }
 
+// Ping implements Storage.Ping, the replicas are pinged as well
+func (s *sqlStorage) Ping(ctx context.Context) error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return err
+	}
+	for _, r := range s.replicas {
+		if err := r.sqlDB.PingContext(ctx); err != nil {
+			return fmt.Errorf("replica %s: %w", r.host, err)
+		}
+	}
+	return nil
+}
+
+// Close implements Storage.Close
+func (s *sqlStorage) Close() error {
+	if s.root != nil {
+		return errCloseTx
+	}
+	if s.metrics != nil {
+		if err := s.metrics.Unregister(); err != nil {
+			log.Warnf("failed to unregister database pool metrics: %v", err)
+		}
+		s.metrics = nil
+	}
+	for _, r := range s.replicas {
+		if err := r.sqlDB.Close(); err != nil {
+			log.Warnf("failed to close replica %s: %v", r.host, err)
+		}
+	}
+	s.replicas = nil
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
 // Create implements Storage.Create
 func (s *sqlStorage) Create(ctx context.Context, model any) error {
-	return s.db.WithContext(ctx).Create(model).Error
+	return translateError(s.conn(ctx).Create(model).Error)
 }
 
 // Get implements Storage.Get
 func (s *sqlStorage) Get(ctx context.Context, id uint64, result any) error {
-	return s.db.WithContext(ctx).Model(result).First(result, id).Error
+	return translateError(s.reader(ctx).Model(result).First(result, id).Error)
 }
 
 // GetBy implements Storage.GetBy
 func (s *sqlStorage) GetBy(ctx context.Context, filter map[string]any, result any) error {
-	if err := ValidateFilter(filter); err != nil {
+	db, err := filterWhere(s.reader(ctx).Model(result), result, filter)
+	if err != nil {
 		return err
 	}
-	return s.db.WithContext(ctx).Model(result).Where(filter).First(result).Error
+	return translateError(db.First(result).Error)
 }
 
 // Update implements Storage.Update
 func (s *sqlStorage) Update(ctx context.Context, id uint64, data any) error {
-	return s.db.WithContext(ctx).Model(data).Where("id = ?", id).Save(data).Error
+	db := s.conn(ctx)
+	sch, err := parseSchema(db, data)
+	if err != nil {
+		return err
+	}
+	version := versionField(sch)
+	if version == nil {
+		pk := sch.PrioritizedPrimaryField
+		if pk == nil {
+			return fmt.Errorf("%s has no primary key", sch.Name)
+		}
+		byID := clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName}, Value: id}
+		result := db.Model(data).Where(byID).Updates(data)
+		if result.Error != nil {
+			return translateError(result.Error)
+		}
+		return found(db, result, data, byID)
+	}
+	values, err := structValues(ctx, sch, data, nil)
+	if err != nil {
+		return err
+	}
+	expected, zero := version.ValueOf(ctx, reflect.ValueOf(data).Elem())
+	if zero {
+		expected = nil
+	}
+	return patch(ctx, db, sch, id, data, values, expected)
 }
 
-// UpdateBy implements Storage.UpdateBy
-func (s *sqlStorage) UpdateBy(ctx context.Context, filter map[string]any, data any) error {
-	if err := ValidateFilter(filter); err != nil {
-		return err
+// UpdateBy implements Storage.UpdateBy, the version column of matching records is increased but not checked
+func (s *sqlStorage) UpdateBy(ctx context.Context, filter map[string]any, data any) (int64, error) {
+	db := s.conn(ctx)
+	sch, err := parseSchema(db, data)
+	if err != nil {
+		return 0, err
 	}
-	result := s.db.WithContext(ctx).Model(data).Where(filter).Save(data)
-	if result.Error != nil {
-		return result.Error
+	tx, err := filterWhere(db.Model(data), data, filter)
+	if err != nil {
+		return 0, err
 	}
-	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
+
+	var result *gorm.DB
+	if version := versionField(sch); version != nil {
+		values, err := structValues(ctx, sch, data, nil)
+		if err != nil {
+			return 0, err
+		}
+		values[version.DBName] = gorm.Expr("? + 1", clause.Column{Name: version.DBName})
+		result = tx.Updates(values)
+	} else {
+		result = tx.Updates(data)
 	}
-	return nil
+	return result.RowsAffected, translateError(result.Error)
 }
 
-// Delete implements Storage.Delete
+// Delete implements Storage.Delete, models with a gorm.DeletedAt field are soft-deleted.
 // If the record does not exist, it returns nil without error.
 func (s *sqlStorage) Delete(ctx context.Context, id uint64, model any) error {
-	return s.db.WithContext(ctx).Unscoped().Model(model).Delete("id = ?", id).Error
+	return translateError(s.conn(ctx).Delete(model, id).Error)
 }
 
-// DeleteBy implements Storage.DeleteBy
+// DeleteBy implements Storage.DeleteBy, models with a gorm.DeletedAt field are soft-deleted
 func (s *sqlStorage) DeleteBy(ctx context.Context, filter map[string]any, model any) error {
 	if len(filter) == 0 {
-		return errors.New("filter cannot be empty")
+		return invalidFilter("filter cannot be empty")
 	}
-	if err := ValidateFilter(filter); err != nil {
+	db, err := filterWhere(s.conn(ctx), model, filter)
+	if err != nil {
 		return err
 	}
-	return s.db.WithContext(ctx).Unscoped().Model(model).Where(filter).Delete(filter).Error
+	return translateError(db.Delete(model).Error)
 }
 
 // List implements Storage.List, support association query and preloading.
@@ -105,44 +317,130 @@ func (s *sqlStorage) DeleteBy(ctx context.Context, filter map[string]any, model
 // If the preload key is not empty, it will perform preloading.
 // If both keys are not empty, it will return use association query.
 func (s *sqlStorage) List(ctx context.Context, query *Query, mainModel, assModel any) (int64, error) {
-	db := s.db.WithContext(ctx).Model(mainModel)
-	// Count total records
+	db, err := where(s.reader(ctx), query, mainModel)
+	if err != nil {
+		return 0, err
+	}
 
-	if len(query.Filter) > 0 {
-		if err := ValidateFilter(query.Filter); err != nil {
+	// Resolve the sort conditions first, an association query sorts the associated records.
+	// A page is ordered by the primary key at least, otherwise its rows could differ between queries.
+	paged := query.Page > 0 && query.Size > 0
+	var order clause.Expression
+	if len(query.Sort) > 0 || paged {
+		sortModel := mainModel
+		if len(query.AssociationKey) > 0 {
+			sortModel = assModel
+		}
+		sch, err := parseSchema(db, sortModel)
+		if err != nil {
+			return 0, err
+		}
+		keys, err := sortKeys(sch, query.Sort)
+		if err != nil {
 			return 0, err
 		}
-		db = db.Where(query.Filter)
+		order = orderBy(db.Dialector.Name(), keys, false)
 	}
 
+	// Count total records
 	var total int64
 	if err := db.Count(&total).Error; err != nil {
-		return 0, err
+		return 0, translateError(err)
 	}
 
-	// Apply sorting
-	if len(query.Sort) > 0 {
-		for field, order := range query.Sort {
-			db = db.Order(field + " " + order)
-		}
+	// Apply sorting, columns are quoted by the dialect
+	if order != nil {
+		db = db.Order(order)
 	}
 
 	// Apply pagination
-	if query.Page > 0 && query.Size > 0 {
+	if paged {
 		offset := (query.Page - 1) * query.Size
 		db = db.Offset(offset).Limit(query.Size)
 	}
 
+	if db, err = selectFields(db, query, mainModel); err != nil {
+		return 0, err
+	}
+
 	//  assciation query or not
 	if len(query.AssociationKey) > 0 {
-		return total, db.Association(query.AssociationKey).Find(assModel)
+		return total, translateError(db.Association(query.AssociationKey).Find(assModel))
 	}
 	if len(query.Preload) > 0 {
-		return total, db.Preload(query.Preload).Find(mainModel).Error
+		return total, translateError(db.Preload(query.Preload).Find(mainModel).Error)
 	}
 	if query.AllPreload {
-		return total, db.Preload(clause.Associations).Find(mainModel).Error
+		return total, translateError(db.Preload(clause.Associations).Find(mainModel).Error)
+	}
+
+	return total, translateError(db.Find(mainModel).Error)
+}
+
+// Count implements Storage.Count
+func (s *sqlStorage) Count(ctx context.Context, query *Query, model any) (int64, error) {
+	db, err := where(s.reader(ctx), query, model)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	return total, translateError(db.Count(&total).Error)
+}
+
+// where returns the statement of model on db filtered by the Filter and Where of query,
+// soft-deleted records are excluded unless query.IncludeDeleted is set
+func where(db *gorm.DB, query *Query, model any) (*gorm.DB, error) {
+	db = db.Model(model)
+	if query.IncludeDeleted {
+		db = db.Unscoped()
 	}
+	db, err := filterWhere(db, model, query.Filter)
+	if err != nil {
+		return nil, err
+	}
+	if query.Where != nil {
+		expr, err := compileExpr(db, model, query.Where)
+		if err != nil {
+			return nil, err
+		}
+		if expr != nil {
+			db = db.Where(expr)
+		}
+	}
+	return db, nil
+}
 
-	return total, db.Find(mainModel).Error
+// selectFields applies the column selection and the included associations of query,
+// required columns are selected as well, e.g. the sort keys of a cursor
+func selectFields(db *gorm.DB, query *Query, model any, required ...string) (*gorm.DB, error) {
+	if len(query.Fields) == 0 && len(query.Include) == 0 {
+		return db, nil
+	}
+	sch, err := parseSchema(db, model)
+	if err != nil {
+		return nil, err
+	}
+	if len(query.Fields) > 0 {
+		columns := make([]string, 0, len(query.Fields)+len(required))
+		for _, field := range query.Fields {
+			column, err := lookupColumn(sch, field)
+			if err != nil {
+				return nil, invalidFilter("invalid fields: %v", err)
+			}
+			columns = append(columns, column)
+		}
+		for _, column := range required {
+			if !slices.Contains(columns, column) {
+				columns = append(columns, column)
+			}
+		}
+		db = db.Select(columns)
+	}
+	for _, name := range query.Include {
+		if _, ok := sch.Relationships.Relations[name]; !ok {
+			return nil, invalidFilter("invalid include: unknown association %s", name)
+		}
+		db = db.Preload(name)
+	}
+	return db, nil
 }
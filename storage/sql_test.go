@@ -2,12 +2,18 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"path/filepath"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fize/go-ext/config"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -43,6 +49,32 @@ func setupMockDB() (*gorm.DB, sqlmock.Sqlmock, error) {
 	return db, mock, nil
 }
 
+// setupPostgresMockDB creates a new mock database connection with the postgres dialect
+func setupPostgresMockDB() (*gorm.DB, sqlmock.Sqlmock, error) {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: mockDB}), &gorm.Config{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, mock, nil
+}
+
+// setupSqliteDB creates a new sqlite database in a temporary directory with the test models
+func setupSqliteDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&TestModel{}, &RelatedTestModel{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
 // TestCreate verifies the Create method functionality
 func TestCreate(t *testing.T) {
 	db, mock, err := setupMockDB()
@@ -120,7 +152,7 @@ func TestUpdate(t *testing.T) {
 
 	// 修正 SQL 匹配模式以适应实际的 GORM 查询
 	mock.ExpectBegin()
-	mock.ExpectExec(regexp.QuoteMeta("UPDATE `test_models` SET `name`=? WHERE id = ?")).
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `test_models` SET `name`=? WHERE `test_models`.`id` = ?")).
 		WithArgs(updateData.Name, id).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
@@ -147,8 +179,9 @@ func TestUpdateBy(t *testing.T) {
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
-	err = store.UpdateBy(ctx, filter, updateData)
+	rows, err := store.UpdateBy(ctx, filter, updateData)
 	assert.NoError(t, err)
+	assert.Equal(t, int64(1), rows)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -210,7 +243,8 @@ func TestList(t *testing.T) {
 	dataRows := sqlmock.NewRows([]string{"id", "name"}).
 		AddRow(1, "test1").
 		AddRow(2, "test2")
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `test_models` LIMIT ?")).
+	// A page is ordered by the primary key without a sort
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `test_models` ORDER BY `test_models`.`id` LIMIT ?")).
 		WithArgs(10). // 只需要 LIMIT 参数
 		WillReturnRows(dataRows)
 
@@ -247,7 +281,7 @@ func TestListWithFilter(t *testing.T) {
 	// Then expect the filtered data query
 	dataRows := sqlmock.NewRows([]string{"id", "name"}).
 		AddRow(1, "test1")
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `test_models` WHERE `name` = ? ORDER BY id asc LIMIT ?")).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `test_models` WHERE `name` = ? ORDER BY `test_models`.`id` LIMIT ?")).
 		WithArgs("test1", 10).
 		WillReturnRows(dataRows)
 
@@ -255,7 +289,7 @@ func TestListWithFilter(t *testing.T) {
 		Filter: map[string]any{"name": "test1"},
 		Page:   1,
 		Size:   10,
-		Sort:   map[string]string{"id": "asc"},
+		Sort:   []Sort{Asc("id")},
 	}
 
 	var results []TestModel
@@ -309,3 +343,202 @@ func TestListWithPreload(t *testing.T) {
 	assert.Len(t, results, 2)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+// TestListPostgres verifies that sort and filter columns are quoted for postgres
+func TestListPostgres(t *testing.T) {
+	db, mock, err := setupPostgresMockDB()
+	assert.NoError(t, err)
+
+	store := &sqlStorage{db: db}
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "test_models" WHERE "name" = $1`)).
+		WithArgs("test1").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "test_models" WHERE "name" = $1 ORDER BY "test_models"."name" DESC NULLS LAST, "test_models"."id" DESC LIMIT $2`)).
+		WithArgs("test1", 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "test1"))
+
+	query := Query{
+		Filter: map[string]any{"name": "test1"},
+		Page:   1,
+		Size:   10,
+		Sort:   []Sort{Desc("name").NullsLast()},
+	}
+
+	var results []TestModel
+	total, err := store.List(ctx, &query, &results, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Len(t, results, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestListInvalidSort verifies that sort conditions are checked against the model before any query
+func TestListInvalidSort(t *testing.T) {
+	db, mock, err := setupMockDB()
+	assert.NoError(t, err)
+
+	store := &sqlStorage{db: db}
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		sort    []Sort
+		wantErr string
+	}{
+		{name: "injection", sort: []Sort{Asc("id; DROP TABLE test_models")}, wantErr: "invalid sort: unknown column id; DROP TABLE test_models"},
+		{name: "unknown column", sort: []Sort{Desc("password")}, wantErr: "invalid sort: unknown column password"},
+		{name: "unknown nulls", sort: []Sort{{Field: "name", Nulls: "middle"}}, wantErr: "invalid sort: unknown nulls order middle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var results []TestModel
+			_, err := store.List(ctx, &Query{Sort: tt.sort}, &results, nil)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestListSortMySQL verifies the emulated nulls order of mysql
+func TestListSortMySQL(t *testing.T) {
+	db, mock, err := setupMockDB()
+	assert.NoError(t, err)
+
+	store := &sqlStorage{db: db}
+	ctx := context.Background()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM `test_models`")).
+		WillReturnRows(sqlmock.NewRows([]string{"count(*)"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `test_models` ORDER BY `test_models`.`name` IS NULL DESC, `test_models`.`name`, `test_models`.`id`")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	var results []TestModel
+	_, err = store.List(ctx, &Query{Sort: []Sort{Asc("name").NullsFirst()}}, &results, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestListSqlite verifies filtering and sorting against sqlite
+func TestListSqlite(t *testing.T) {
+	store := &sqlStorage{db: setupSqliteDB(t)}
+	ctx := context.Background()
+
+	for _, name := range []string{"b", "a", "c"} {
+		assert.NoError(t, store.Create(ctx, &TestModel{Name: name}))
+	}
+
+	var results []TestModel
+	total, err := store.List(ctx, &Query{Sort: []Sort{Desc("name")}}, &results, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	if assert.Len(t, results, 3) {
+		assert.Equal(t, []string{"c", "b", "a"}, []string{results[0].Name, results[1].Name, results[2].Name})
+	}
+
+	results = nil
+	total, err = store.List(ctx, &Query{Filter: map[string]any{"name": "a"}}, &results, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+}
+
+// TestListFieldsInclude verifies column selection and whitelisted preloading
+func TestListFieldsInclude(t *testing.T) {
+	store := &sqlStorage{db: setupSqliteDB(t)}
+	ctx := context.Background()
+
+	model := &TestModel{Name: "a", RelatedModels: []RelatedTestModel{{Name: "r1"}, {Name: "r2"}}}
+	assert.NoError(t, store.Create(ctx, model))
+
+	var results []TestModel
+	_, err := store.List(ctx, &Query{Fields: []string{"id"}, Include: []string{"RelatedModels"}}, &results, nil)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, model.ID, results[0].ID)
+		assert.Empty(t, results[0].Name)
+		assert.Len(t, results[0].RelatedModels, 2)
+	}
+
+	_, err = store.List(ctx, &Query{Fields: []string{"password"}}, &results, nil)
+	assert.EqualError(t, err, "invalid fields: unknown column password")
+
+	_, err = store.List(ctx, &Query{Include: []string{"Secrets"}}, &results, nil)
+	assert.EqualError(t, err, "invalid include: unknown association Secrets")
+}
+
+// TestOpen verifies opening, pinging and closing a database
+func TestOpen(t *testing.T) {
+	cfg, err := config.NewSQLConfig(config.WithDB(filepath.Join(t.TempDir(), "open.db")))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	store, err := Open(ctx, cfg)
+	assert.NoError(t, err)
+	assert.NoError(t, store.Ping(ctx))
+	assert.NoError(t, store.Close())
+	assert.Error(t, store.Ping(ctx))
+}
+
+// TestOpenRetry verifies that a failed connection is retried and then reported
+func TestOpenRetry(t *testing.T) {
+	cfg, err := config.NewSQLConfig(
+		config.WithType(config.MySQL),
+		// nothing listens on port 1
+		config.WithHost("127.0.0.1:1"),
+		config.WithDB("app"),
+		config.WithTimeout(time.Second),
+		config.WithConnectRetries(2),
+		config.WithConnectBackoff(10*time.Millisecond),
+	)
+	assert.NoError(t, err)
+
+	begin := time.Now()
+	_, err = Open(context.Background(), cfg)
+	assert.ErrorContains(t, err, "failed to connect database with driver 'mysql'")
+	assert.ErrorContains(t, err, "connection refused")
+	// two retries wait 10ms and 20ms
+	assert.GreaterOrEqual(t, time.Since(begin), 30*time.Millisecond)
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name      string
+		retries   int
+		failures  int
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "success", retries: 3, failures: 0, wantCalls: 1},
+		{name: "success after retries", retries: 3, failures: 2, wantCalls: 3},
+		{name: "retries exhausted", retries: 2, failures: 5, wantCalls: 3, wantErr: true},
+		{name: "no retries", retries: 0, failures: 1, wantCalls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := retry(context.Background(), tt.retries, time.Millisecond, func() error {
+				calls++
+				if calls <= tt.failures {
+					return errors.New("connection refused")
+				}
+				return nil
+			})
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := retry(ctx, 5, time.Hour, func() error {
+		calls++
+		return errors.New("connection refused")
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,593 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// default tenant column of a TenantStorage
+const _defaultTenantColumn = "tenant_id"
+
+// tenantKey is the context key of the tenant
+type tenantKey struct{}
+
+// ContextWithTenant returns a context carrying the tenant, e.g. set by a middleware from the token of a request
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant carried by ctx
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// tenantConditionKey is the context key of the tenant condition of a write
+type tenantConditionKey struct{}
+
+// tenantCondition is the tenant column condition a TenantStorage puts in the statements of a write,
+// so the write only affects the records of the tenant
+type tenantCondition struct {
+	table  string
+	column string
+	value  any
+}
+
+// tenantConditionOf returns the tenant condition of ctx on table, nil if there is none
+func tenantConditionOf(ctx context.Context, table string) *tenantCondition {
+	cond, ok := ctx.Value(tenantConditionKey{}).(*tenantCondition)
+	if !ok || cond.table != table {
+		return nil
+	}
+	return cond
+}
+
+// withTenantCondition adds the tenant condition of ctx to the statements of db
+func withTenantCondition(ctx context.Context, db *gorm.DB) *gorm.DB {
+	cond, ok := ctx.Value(tenantConditionKey{}).(*tenantCondition)
+	if !ok {
+		return db
+	}
+	// A new session, so the statements built from db do not share one statement
+	return db.Scopes(cond.apply).Session(&gorm.Session{})
+}
+
+// apply adds the condition to a statement on its table, statements on other tables are left alone
+func (cond *tenantCondition) apply(db *gorm.DB) *gorm.DB {
+	model := db.Statement.Model
+	if model == nil {
+		model = db.Statement.Dest
+	}
+	if model != nil {
+		if sch, err := parseSchema(db, model); err == nil && sch.Table != cond.table {
+			return db
+		}
+	}
+	return db.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: cond.column}, Value: cond.value})
+}
+
+// guard makes onConflict of an upsert on sch leave the conflicting records of other tenants unchanged
+func (cond *tenantCondition) guard(dialect string, sch *schema.Schema, onConflict clause.OnConflict) clause.OnConflict {
+	if dialect != "mysql" {
+		// ON CONFLICT ... DO UPDATE SET ... WHERE tenant = ?
+		onConflict.Where = clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.Column{Table: sch.Table, Name: cond.column}, Value: cond.value},
+		}}
+		return onConflict
+	}
+
+	// ON DUPLICATE KEY UPDATE has no WHERE, every column keeps its value unless the record is of the tenant
+	assignments := onConflict.DoUpdates
+	if onConflict.UpdateAll {
+		assignments = nil
+		for _, field := range sch.Fields {
+			if field.DBName != "" && !field.PrimaryKey && field.Updatable && field.AutoCreateTime == 0 {
+				assignments = append(assignments, clause.Assignment{Column: clause.Column{Name: field.DBName}})
+			}
+		}
+		onConflict.UpdateAll = false
+	}
+	guarded := make([]clause.Assignment, 0, len(assignments))
+	for _, a := range assignments {
+		guarded = append(guarded, clause.Assignment{Column: a.Column, Value: clause.Expr{
+			SQL:  "IF(? = ?, VALUES(?), ?)",
+			Vars: []any{clause.Column{Name: cond.column}, cond.value, clause.Column{Name: a.Column.Name}, clause.Column{Name: a.Column.Name}},
+		}})
+	}
+	onConflict.DoUpdates = guarded
+	return onConflict
+}
+
+// TenantStorage is a Storage scoping every call to the tenant of its context with a tenant column.
+// The column is set on created records and added to the filter of every read, update and delete,
+// writes carry it in their statements, so they never change the records of another tenant.
+// Records of other tenants are rejected with a *TenantError and calls without a tenant with ErrNoTenant.
+// Every model must have the tenant column, shared tables are used through the wrapped storage.
+type TenantStorage struct {
+	Storage
+	column string
+}
+
+// TenantOption is used to configure the TenantStorage
+type TenantOption func(*TenantStorage)
+
+// WithTenantColumn sets the tenant column of the models, default tenant_id
+func WithTenantColumn(column string) TenantOption {
+	return func(t *TenantStorage) {
+		t.column = column
+	}
+}
+
+// NewTenantStorage creates a new TenantStorage scoping the calls of s to the tenant of their context
+func NewTenantStorage(s Storage, opts ...TenantOption) *TenantStorage {
+	t := &TenantStorage{Storage: s, column: _defaultTenantColumn}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Unwrap returns the scoped storage
+func (t *TenantStorage) Unwrap() Storage {
+	return t.Storage
+}
+
+// tenantScope is the tenant of a call on a model
+type tenantScope struct {
+	tenant string
+	sch    *schema.Schema
+	field  *schema.Field
+	// value is the tenant converted to the type of the tenant field
+	value any
+}
+
+// scope returns the tenant scope of a call with ctx on model
+func (t *TenantStorage) scope(ctx context.Context, model any) (*tenantScope, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	db, ok := t.Storage.Client().(*gorm.DB)
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage client %T", t.Storage.Client())
+	}
+	sch, err := parseSchema(db, model)
+	if err != nil {
+		return nil, err
+	}
+	field := sch.LookUpField(t.column)
+	if field == nil || field.DBName == "" {
+		return nil, fmt.Errorf("%s has no tenant column %s", sch.Name, t.column)
+	}
+
+	var value any = tenant
+	switch field.IndirectFieldType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err = strconv.ParseInt(tenant, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err = strconv.ParseUint(tenant, 10, 64)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid tenant %s for column %s", tenant, field.DBName)
+	}
+	return &tenantScope{tenant: tenant, sch: sch, field: field, value: value}, nil
+}
+
+// denied returns the error of an access to the records of owner
+func (sc *tenantScope) denied(owner string) error {
+	return &TenantError{Tenant: sc.tenant, Owner: owner, Table: sc.sch.Table}
+}
+
+// owner returns the tenant of the record rv, empty if it is not set
+func (sc *tenantScope) owner(ctx context.Context, rv reflect.Value) string {
+	value, zero := sc.field.ValueOf(ctx, rv)
+	if zero {
+		return ""
+	}
+	return fmt.Sprint(reflect.Indirect(reflect.ValueOf(value)).Interface())
+}
+
+// records calls fn with the records of models, a pointer to a struct or a slice
+func records(models any, fn func(rv reflect.Value) error) error {
+	rv := reflect.Indirect(reflect.ValueOf(models))
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return fn(rv)
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if err := fn(reflect.Indirect(rv.Index(i))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check rejects models with the tenant of another tenant
+func (sc *tenantScope) check(ctx context.Context, models any) error {
+	return records(models, func(rv reflect.Value) error {
+		if owner := sc.owner(ctx, rv); owner != "" && owner != sc.tenant {
+			return sc.denied(owner)
+		}
+		return nil
+	})
+}
+
+// assign sets the tenant on models, models of another tenant are rejected
+func (sc *tenantScope) assign(ctx context.Context, models any) error {
+	if err := sc.check(ctx, models); err != nil {
+		return err
+	}
+	return records(models, func(rv reflect.Value) error {
+		return sc.field.Set(ctx, rv, sc.value)
+	})
+}
+
+// checkValue rejects changes setting the tenant column to another tenant, keys are column or field names
+func (sc *tenantScope) checkValue(changes map[string]any) error {
+	for key, value := range changes {
+		if field := sc.sch.LookUpField(key); field == sc.field {
+			if owner := fmt.Sprint(reflect.Indirect(reflect.ValueOf(value)).Interface()); owner != sc.tenant {
+				return sc.denied(owner)
+			}
+		}
+	}
+	return nil
+}
+
+// filter returns filter with the tenant column, a filter on another tenant is rejected
+func (sc *tenantScope) filter(filter map[string]any) (map[string]any, error) {
+	if err := sc.checkValue(filter); err != nil {
+		return nil, err
+	}
+	scoped := maps.Clone(filter)
+	if scoped == nil {
+		scoped = make(map[string]any, 1)
+	}
+	for key := range scoped {
+		if sc.sch.LookUpField(key) == sc.field {
+			delete(scoped, key)
+		}
+	}
+	scoped[sc.field.DBName] = sc.value
+	return scoped, nil
+}
+
+// query returns a copy of query with the tenant column in its filter
+func (sc *tenantScope) query(query *Query) (*Query, error) {
+	filter, err := sc.filter(query.Filter)
+	if err != nil {
+		return nil, err
+	}
+	scoped := *query
+	scoped.Filter = filter
+	return &scoped, nil
+}
+
+// context returns ctx with the tenant condition, the writes of the wrapped storage with it
+// only affect the records of the tenant
+func (sc *tenantScope) context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tenantConditionKey{}, &tenantCondition{table: sc.sch.Table, column: sc.field.DBName, value: sc.value})
+}
+
+// owned rejects the record with ID if it belongs to another tenant, a missing record is left to the wrapped storage.
+// It only explains the outcome of a write with the tenant condition, which cannot affect such a record.
+func (t *TenantStorage) owned(ctx context.Context, sc *tenantScope, id uint64) error {
+	pk := sc.sch.PrioritizedPrimaryField
+	if pk == nil {
+		return fmt.Errorf("%s has no primary key", sc.sch.Name)
+	}
+	query := &Query{
+		Where:          And(Eq(pk.DBName, id), Or(Ne(sc.field.DBName, sc.value), IsNull(sc.field.DBName, true))),
+		IncludeDeleted: true,
+	}
+	n, err := t.Storage.Count(ContextWithPrimary(ctx), query, reflect.New(sc.sch.ModelType).Interface())
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return sc.denied("")
+	}
+	return nil
+}
+
+// Transaction implements Storage.Transaction, the calls of tx are scoped as well
+func (t *TenantStorage) Transaction(ctx context.Context, fn func(tx Storage) error, opts ...TxOption) error {
+	return t.Storage.Transaction(ctx, func(tx Storage) error {
+		return fn(&TenantStorage{Storage: tx, column: t.column})
+	}, opts...)
+}
+
+// Create implements Storage.Create, the tenant is set on model
+func (t *TenantStorage) Create(ctx context.Context, model any) error {
+	sc, err := t.scope(ctx, model)
+	if err != nil {
+		return err
+	}
+	if err := sc.assign(ctx, model); err != nil {
+		return err
+	}
+	return t.Storage.Create(ctx, model)
+}
+
+// CreateBatch implements Storage.CreateBatch, the tenant is set on models
+func (t *TenantStorage) CreateBatch(ctx context.Context, models any, batchSize int, opts ...BatchOption) error {
+	sc, err := t.scope(ctx, models)
+	if err != nil {
+		return err
+	}
+	if err := sc.assign(ctx, models); err != nil {
+		return err
+	}
+	return t.Storage.CreateBatch(ctx, models, batchSize, opts...)
+}
+
+// Upsert implements Storage.Upsert, the tenant is set on models.
+// Models conflicting with records of another tenant are rejected with a *TenantError before anything is written.
+// A record of another tenant written concurrently is not updated either, the statement only updates records of the tenant.
+func (t *TenantStorage) Upsert(ctx context.Context, models any, conflictColumns, updateColumns []string, opts ...BatchOption) error {
+	sc, err := t.scope(ctx, models)
+	if err != nil {
+		return err
+	}
+	if err := sc.assign(ctx, models); err != nil {
+		return err
+	}
+	if err := t.conflicts(ctx, sc, models, conflictColumns); err != nil {
+		return err
+	}
+	return t.Storage.Upsert(sc.context(ctx), models, conflictColumns, updateColumns, opts...)
+}
+
+// conflicts returns a *TenantError if models conflict on conflictColumns, the primary key by default,
+// with records of another tenant
+func (t *TenantStorage) conflicts(ctx context.Context, sc *tenantScope, models any, conflictColumns []string) error {
+	var fields []*schema.Field
+	for _, name := range conflictColumns {
+		field := sc.sch.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			return invalidFilter("invalid upsert: unknown column %s", name)
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		fields = sc.sch.PrimaryFields
+	}
+	var conflicts []Expr
+	records(models, func(rv reflect.Value) error {
+		conds := make([]Expr, 0, len(fields))
+		for _, field := range fields {
+			value, zero := field.ValueOf(ctx, rv)
+			if zero && field.PrimaryKey {
+				// a generated primary key conflicts with no record
+				return nil
+			}
+			conds = append(conds, Eq(field.DBName, value))
+		}
+		conflicts = append(conflicts, And(conds...))
+		return nil
+	})
+	if len(conflicts) == 0 {
+		return nil
+	}
+	query := &Query{
+		Where:          And(Or(conflicts...), Or(Ne(sc.field.DBName, sc.value), IsNull(sc.field.DBName, true))),
+		IncludeDeleted: true,
+	}
+	n, err := t.Storage.Count(ContextWithPrimary(ctx), query, reflect.New(sc.sch.ModelType).Interface())
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return sc.denied("")
+	}
+	return nil
+}
+
+// Get implements Storage.Get, a record of another tenant is not returned
+func (t *TenantStorage) Get(ctx context.Context, id uint64, result any) error {
+	sc, err := t.scope(ctx, result)
+	if err != nil {
+		return err
+	}
+	if err := t.Storage.Get(ctx, id, result); err != nil {
+		return err
+	}
+	rv := reflect.ValueOf(result).Elem()
+	if owner := sc.owner(ctx, rv); owner != sc.tenant {
+		rv.SetZero()
+		return sc.denied(owner)
+	}
+	return nil
+}
+
+// GetBy implements Storage.GetBy
+func (t *TenantStorage) GetBy(ctx context.Context, filter map[string]any, result any) error {
+	sc, err := t.scope(ctx, result)
+	if err != nil {
+		return err
+	}
+	if filter, err = sc.filter(filter); err != nil {
+		return err
+	}
+	return t.Storage.GetBy(ctx, filter, result)
+}
+
+// Update implements Storage.Update
+func (t *TenantStorage) Update(ctx context.Context, id uint64, data any) error {
+	sc, err := t.scope(ctx, data)
+	if err != nil {
+		return err
+	}
+	if err := sc.check(ctx, data); err != nil {
+		return err
+	}
+	return t.missing(ctx, sc, id, t.Storage.Update(sc.context(ctx), id, data))
+}
+
+// UpdateBy implements Storage.UpdateBy
+func (t *TenantStorage) UpdateBy(ctx context.Context, filter map[string]any, data any) (int64, error) {
+	sc, err := t.scope(ctx, data)
+	if err != nil {
+		return 0, err
+	}
+	if err := sc.check(ctx, data); err != nil {
+		return 0, err
+	}
+	if filter, err = sc.filter(filter); err != nil {
+		return 0, err
+	}
+	return t.Storage.UpdateBy(sc.context(ctx), filter, data)
+}
+
+// UpdateWhere implements Storage.UpdateWhere
+func (t *TenantStorage) UpdateWhere(ctx context.Context, query *Query, model any, values map[string]any, opts ...BatchOption) (int64, error) {
+	sc, err := t.scope(ctx, model)
+	if err != nil {
+		return 0, err
+	}
+	if err := sc.checkValue(values); err != nil {
+		return 0, err
+	}
+	if query, err = sc.query(query); err != nil {
+		return 0, err
+	}
+	return t.Storage.UpdateWhere(sc.context(ctx), query, model, values, opts...)
+}
+
+// Patch implements Storage.Patch
+func (t *TenantStorage) Patch(ctx context.Context, id uint64, model any, changes map[string]any) error {
+	sc, err := t.scope(ctx, model)
+	if err != nil {
+		return err
+	}
+	if err := sc.checkValue(changes); err != nil {
+		return err
+	}
+	return t.missing(ctx, sc, id, t.Storage.Patch(sc.context(ctx), id, model, changes))
+}
+
+// PatchFields implements Storage.PatchFields
+func (t *TenantStorage) PatchFields(ctx context.Context, id uint64, model any, fields ...string) error {
+	sc, err := t.scope(ctx, model)
+	if err != nil {
+		return err
+	}
+	for _, name := range fields {
+		if sc.sch.LookUpField(name) == sc.field {
+			if owner := sc.owner(ctx, reflect.ValueOf(model).Elem()); owner != sc.tenant {
+				return sc.denied(owner)
+			}
+		}
+	}
+	return t.missing(ctx, sc, id, t.Storage.PatchFields(sc.context(ctx), id, model, fields...))
+}
+
+// Delete implements Storage.Delete
+func (t *TenantStorage) Delete(ctx context.Context, id uint64, model any) error {
+	return t.byID(ctx, id, model, t.Storage.Delete)
+}
+
+// DeleteBy implements Storage.DeleteBy
+func (t *TenantStorage) DeleteBy(ctx context.Context, filter map[string]any, model any) error {
+	if len(filter) == 0 {
+		return invalidFilter("filter cannot be empty")
+	}
+	sc, err := t.scope(ctx, model)
+	if err != nil {
+		return err
+	}
+	if filter, err = sc.filter(filter); err != nil {
+		return err
+	}
+	return t.Storage.DeleteBy(sc.context(ctx), filter, model)
+}
+
+// Restore implements Storage.Restore
+func (t *TenantStorage) Restore(ctx context.Context, id uint64, model any) error {
+	return t.byID(ctx, id, model, t.Storage.Restore)
+}
+
+// Purge implements Storage.Purge
+func (t *TenantStorage) Purge(ctx context.Context, id uint64, model any) error {
+	return t.byID(ctx, id, model, t.Storage.Purge)
+}
+
+// byID calls fn with the record with ID and the tenant condition. Delete and Purge do not report missing records,
+// so a record of another tenant, which fn left untouched, is looked up afterwards.
+func (t *TenantStorage) byID(ctx context.Context, id uint64, model any, fn func(ctx context.Context, id uint64, model any) error) error {
+	sc, err := t.scope(ctx, model)
+	if err != nil {
+		return err
+	}
+	if err := fn(sc.context(ctx), id, model); err != nil {
+		return t.missing(ctx, sc, id, err)
+	}
+	return t.owned(ctx, sc, id)
+}
+
+// missing returns err of a write of the record with ID with the tenant condition,
+// a record that was not found because it belongs to another tenant is reported with a *TenantError
+func (t *TenantStorage) missing(ctx context.Context, sc *tenantScope, id uint64, err error) error {
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if denied := t.owned(ctx, sc, id); denied != nil {
+		return denied
+	}
+	return err
+}
+
+// List implements Storage.List, the tenant column filters the main model
+func (t *TenantStorage) List(ctx context.Context, query *Query, mainModel, assModel any) (int64, error) {
+	sc, err := t.scope(ctx, mainModel)
+	if err != nil {
+		return 0, err
+	}
+	if query, err = sc.query(query); err != nil {
+		return 0, err
+	}
+	return t.Storage.List(ctx, query, mainModel, assModel)
+}
+
+// ListDeleted implements Storage.ListDeleted
+func (t *TenantStorage) ListDeleted(ctx context.Context, query *Query, result any) (int64, error) {
+	sc, err := t.scope(ctx, result)
+	if err != nil {
+		return 0, err
+	}
+	if query, err = sc.query(query); err != nil {
+		return 0, err
+	}
+	return t.Storage.ListDeleted(ctx, query, result)
+}
+
+// Count implements Storage.Count
+func (t *TenantStorage) Count(ctx context.Context, query *Query, model any) (int64, error) {
+	sc, err := t.scope(ctx, model)
+	if err != nil {
+		return 0, err
+	}
+	if query, err = sc.query(query); err != nil {
+		return 0, err
+	}
+	return t.Storage.Count(ctx, query, model)
+}
+
+// ListCursor implements Storage.ListCursor
+func (t *TenantStorage) ListCursor(ctx context.Context, query *Query, result any) (*CursorPage, error) {
+	sc, err := t.scope(ctx, result)
+	if err != nil {
+		return nil, err
+	}
+	if query, err = sc.query(query); err != nil {
+		return nil, err
+	}
+	return t.Storage.ListCursor(ctx, query, result)
+}
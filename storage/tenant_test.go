@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// Invoice is a model of a tenant
+type Invoice struct {
+	ID        uint64 `gorm:"primaryKey"`
+	TenantID  string
+	Number    string
+	DeletedAt gorm.DeletedAt
+}
+
+// setupTenants returns a tenant storage with invoice 1 of tenant a and invoice 2 of tenant b
+func setupTenants(t *testing.T) (*TenantStorage, context.Context, context.Context) {
+	t.Helper()
+	db := setupSqliteDB(t)
+	if err := db.AutoMigrate(&Invoice{}); err != nil {
+		t.Fatal(err)
+	}
+	store := NewTenantStorage(&sqlStorage{db: db})
+	a := ContextWithTenant(context.Background(), "a")
+	b := ContextWithTenant(context.Background(), "b")
+	assert.NoError(t, store.Create(a, &Invoice{ID: 1, Number: "A-1"}))
+	assert.NoError(t, store.Create(b, &Invoice{ID: 2, Number: "B-1"}))
+	return store, a, b
+}
+
+func assertDenied(t *testing.T, err error, owner string) {
+	t.Helper()
+	var te *TenantError
+	if assert.True(t, errors.As(err, &te), "error %v is not a *TenantError", err) {
+		assert.Equal(t, "a", te.Tenant)
+		assert.Equal(t, owner, te.Owner)
+		assert.Equal(t, "invoices", te.Table)
+	}
+}
+
+func TestTenantStorageReads(t *testing.T) {
+	store, a, _ := setupTenants(t)
+
+	var invoice Invoice
+	assert.NoError(t, store.Get(a, 1, &invoice))
+	assert.Equal(t, "a", invoice.TenantID)
+
+	invoice = Invoice{}
+	err := store.Get(a, 2, &invoice)
+	assertDenied(t, err, "b")
+	assert.EqualError(t, err, "tenant a cannot access invoices of tenant b")
+	assert.Equal(t, Invoice{}, invoice)
+
+	assert.ErrorIs(t, store.GetBy(a, map[string]any{"number": "B-1"}, &invoice), gorm.ErrRecordNotFound)
+	assertDenied(t, store.GetBy(a, map[string]any{"tenant_id": "b"}, &invoice), "b")
+
+	var invoices []Invoice
+	total, err := store.List(a, &Query{}, &invoices, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, "A-1", invoices[0].Number)
+
+	count, err := store.Count(a, &Query{Where: Like("number", "%-1")}, &Invoice{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	page, err := store.ListCursor(a, &Query{Size: 10}, &invoices)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), page.Total)
+
+	// Calls without a tenant fail
+	assert.ErrorIs(t, store.Get(context.Background(), 1, &invoice), ErrNoTenant)
+	_, err = store.List(context.Background(), &Query{}, &invoices, nil)
+	assert.ErrorIs(t, err, ErrNoTenant)
+
+	// Models without the tenant column are rejected
+	assert.EqualError(t, store.Get(a, 1, &TestModel{}), "TestModel has no tenant column tenant_id")
+}
+
+func TestTenantStorageWrites(t *testing.T) {
+	store, a, b := setupTenants(t)
+
+	// The tenant of a model must match the context
+	assertDenied(t, store.Create(a, &Invoice{ID: 3, TenantID: "b"}), "b")
+	invoices := []Invoice{{ID: 3, Number: "A-2"}, {ID: 4, Number: "A-3"}}
+	assert.NoError(t, store.CreateBatch(a, &invoices, 10))
+	assert.Equal(t, "a", invoices[1].TenantID)
+	assertDenied(t, store.Upsert(a, []*Invoice{{ID: 2, Number: "stolen"}}, nil, nil), "")
+
+	// Records of another tenant cannot be changed
+	assertDenied(t, store.Update(a, 2, &Invoice{Number: "x"}), "")
+	assertDenied(t, store.Update(a, 1, &Invoice{TenantID: "b"}), "b")
+	assertDenied(t, store.Patch(a, 2, &Invoice{}, map[string]any{"number": "x"}), "")
+	assertDenied(t, store.Patch(a, 1, &Invoice{}, map[string]any{"TenantID": "b"}), "b")
+	assertDenied(t, store.PatchFields(a, 1, &Invoice{TenantID: "b"}, "TenantID"), "b")
+	assertDenied(t, store.Delete(a, 2, &Invoice{}), "")
+	assertDenied(t, store.Purge(a, 2, &Invoice{}), "")
+
+	// Bulk writes only match the records of the tenant
+	rows, err := store.UpdateBy(a, map[string]any{"number": "B-1"}, &Invoice{Number: "x"})
+	assert.NoError(t, err)
+	assert.Zero(t, rows)
+	rows, err = store.UpdateWhere(a, &Query{Where: Like("number", "%")}, &Invoice{}, map[string]any{"number": "A-0"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), rows)
+	assertDenied(t, store.DeleteBy(a, map[string]any{"tenant_id": "b"}, &Invoice{}), "b")
+	assert.NoError(t, store.DeleteBy(a, map[string]any{"number": "B-1"}, &Invoice{}))
+
+	var invoice Invoice
+	assert.NoError(t, store.Get(b, 2, &invoice))
+	assert.Equal(t, "B-1", invoice.Number)
+
+	// The records of the tenant itself are changed
+	assert.NoError(t, store.Patch(a, 1, &Invoice{}, map[string]any{"number": "A-9"}))
+	assert.NoError(t, store.Delete(a, 1, &Invoice{}))
+	deleted, err := store.ListDeleted(a, &Query{}, &[]Invoice{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	assert.NoError(t, store.Restore(a, 1, &Invoice{}))
+	invoice = Invoice{}
+	assert.NoError(t, store.Get(a, 1, &invoice))
+	assert.Equal(t, "A-9", invoice.Number)
+}
+
+// Acct is a model of a tenant with a unique column
+type Acct struct {
+	ID       uint64 `gorm:"primaryKey"`
+	TenantID string
+	Email    string `gorm:"uniqueIndex"`
+	Name     string
+}
+
+func TestTenantStorageUpsertConflict(t *testing.T) {
+	db := setupSqliteDB(t)
+	if err := db.AutoMigrate(&Acct{}); err != nil {
+		t.Fatal(err)
+	}
+	store := NewTenantStorage(&sqlStorage{db: db})
+	a := ContextWithTenant(context.Background(), "a")
+	b := ContextWithTenant(context.Background(), "b")
+	assert.NoError(t, store.Create(b, &Acct{ID: 2, Email: "x@y", Name: "b"}))
+
+	// A conflict on a unique column does not take over the record of another tenant
+	assertAcctDenied := func(err error) {
+		t.Helper()
+		var te *TenantError
+		assert.True(t, errors.As(err, &te), "error %v is not a *TenantError", err)
+	}
+	assertAcctDenied(store.Upsert(a, []*Acct{{Email: "x@y", Name: "a"}}, []string{"email"}, nil))
+	assertAcctDenied(store.Upsert(a, []*Acct{{Email: "x@y", Name: "a"}}, []string{"email"}, []string{"name"}))
+	assertAcctDenied(store.Upsert(a, []*Acct{{ID: 2, Email: "x@y", Name: "a"}}, nil, nil))
+	var acct Acct
+	assert.NoError(t, store.Get(b, 2, &acct))
+	assert.Equal(t, Acct{ID: 2, TenantID: "b", Email: "x@y", Name: "b"}, acct)
+
+	// Nothing is written when a later batch conflicts
+	models := []*Acct{{Email: "new@y", Name: "a"}, {Email: "x@y", Name: "a"}}
+	assertAcctDenied(store.Upsert(a, models, []string{"email"}, []string{"name"}, WithBatchSize(1)))
+	count, err := store.Count(a, &Query{}, &Acct{})
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+
+	// Conflicts with the records of the tenant itself are updated
+	assert.NoError(t, store.Upsert(b, []*Acct{{Email: "x@y", Name: "b2"}, {Email: "z@y", Name: "b3"}}, []string{"email"}, []string{"name"}))
+	acct = Acct{}
+	assert.NoError(t, store.Get(b, 2, &acct))
+	assert.Equal(t, "b2", acct.Name)
+	count, err = store.Count(b, &Query{}, &Acct{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+// TestTenantUpsertMySQL verifies the guarded upsert statement of mysql
+func TestTenantUpsertMySQL(t *testing.T) {
+	db, mock, err := setupMockDB()
+	assert.NoError(t, err)
+	store := NewTenantStorage(&sqlStorage{db: db})
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM `accts` WHERE `accts`.`email` = ? AND (`accts`.`tenant_id` <> ? OR `accts`.`tenant_id` IS NULL)")).
+		WithArgs("x@y", "a").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO `accts` (`tenant_id`,`email`,`name`) VALUES (?,?,?) "+
+		"ON DUPLICATE KEY UPDATE `name`=IF(`tenant_id` = ?, VALUES(`name`), `name`)")).
+		WithArgs("a", "x@y", "a", "a").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = store.Upsert(ContextWithTenant(context.Background(), "a"), []*Acct{{Email: "x@y", Name: "a"}}, []string{"email"}, []string{"name"})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTenantStorageTransaction(t *testing.T) {
+	store, a, _ := setupTenants(t)
+
+	err := store.Transaction(a, func(tx Storage) error {
+		if err := tx.Create(a, &Invoice{ID: 3, Number: "A-2"}); err != nil {
+			return err
+		}
+		var invoice Invoice
+		return tx.Get(a, 2, &invoice)
+	})
+	assertDenied(t, err, "b")
+	count, err := store.Count(a, &Query{}, &Invoice{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+// Order is a model with a numeric tenant column
+type Order struct {
+	ID     uint64 `gorm:"primaryKey"`
+	Org    int64
+	Amount int
+}
+
+func TestTenantStorageColumn(t *testing.T) {
+	db := setupSqliteDB(t)
+	if err := db.AutoMigrate(&Order{}); err != nil {
+		t.Fatal(err)
+	}
+	store := NewTenantStorage(&sqlStorage{db: db}, WithTenantColumn("org"))
+
+	ctx := ContextWithTenant(context.Background(), "42")
+	order := &Order{Amount: 10}
+	assert.NoError(t, store.Create(ctx, order))
+	assert.Equal(t, int64(42), order.Org)
+	var orders []Order
+	total, err := store.List(ctx, &Query{}, &orders, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+
+	err = store.Create(ContextWithTenant(context.Background(), "acme"), &Order{})
+	assert.EqualError(t, err, "invalid tenant acme for column org")
+}
@@ -0,0 +1,348 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/fize/go-ext/config"
+	"golang.org/x/sync/singleflight"
+)
+
+// TenantPlaceholder is replaced with the tenant in the dsn, db, schema, searchPath and replicas
+// of the configuration of TenantDatabase
+const TenantPlaceholder = "{tenant}"
+
+// tenantPattern matches the tenants accepted in database names and files
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// TenantDatabases is a Storage routing every call to the database of the tenant of its context,
+// e.g. a sqlite file, a MySQL database or a postgres schema per tenant.
+// Databases are opened on first use and shared afterwards, calls without a tenant fail with ErrNoTenant.
+type TenantDatabases struct {
+	open func(ctx context.Context, tenant string) (Storage, error)
+	// group opens the database of a tenant once for concurrent calls
+	group singleflight.Group
+
+	mu       sync.Mutex
+	storages map[string]Storage
+}
+
+// NewTenantDatabases creates a new TenantDatabases opening the database of a tenant with open, e.g. TenantDatabase(cfg)
+func NewTenantDatabases(open func(ctx context.Context, tenant string) (Storage, error)) *TenantDatabases {
+	return &TenantDatabases{
+		open:     open,
+		storages: make(map[string]Storage),
+	}
+}
+
+// TenantDatabase returns the function opening the database of a tenant with cfg, where the {tenant} placeholder
+// of dsn, db, schema, searchPath and replicas is replaced with the tenant, e.g. ./data/{tenant}.db for sqlite
+// or app_{tenant} for MySQL. The placeholder must be in the settings choosing the database: dsn if it is set,
+// otherwise db, or schema or searchPath for postgres, and every sqlite replica.
+// Tenants are limited to letters, digits, _ and -.
+func TenantDatabase(cfg *config.SQLConfig) func(ctx context.Context, tenant string) (Storage, error) {
+	return func(ctx context.Context, tenant string) (Storage, error) {
+		if !tenantPattern.MatchString(tenant) {
+			return nil, fmt.Errorf("invalid tenant %q", tenant)
+		}
+		if err := checkTenantPlaceholder(cfg); err != nil {
+			return nil, err
+		}
+		c := *cfg
+		c.Databases = nil
+		c.DSN = config.Secret(strings.ReplaceAll(c.DSN.Value(), TenantPlaceholder, tenant))
+		c.DB = strings.ReplaceAll(c.DB, TenantPlaceholder, tenant)
+		c.Schema = strings.ReplaceAll(c.Schema, TenantPlaceholder, tenant)
+		c.SearchPath = strings.ReplaceAll(c.SearchPath, TenantPlaceholder, tenant)
+		c.Replicas = make([]string, len(cfg.Replicas))
+		for i, replica := range cfg.Replicas {
+			c.Replicas[i] = strings.ReplaceAll(replica, TenantPlaceholder, tenant)
+		}
+		return Open(ctx, &c)
+	}
+}
+
+// checkTenantPlaceholder rejects configurations that would open the same database for every tenant
+func checkTenantPlaceholder(cfg *config.SQLConfig) error {
+	has := func(s string) bool {
+		return strings.Contains(s, TenantPlaceholder)
+	}
+	switch {
+	case cfg.DSN != "":
+		if !has(cfg.DSN.Value()) {
+			return fmt.Errorf("dsn has no %s placeholder", TenantPlaceholder)
+		}
+	case cfg.Type == config.Postgres:
+		if !has(cfg.DB) && !has(cfg.Schema) && !has(cfg.SearchPath) {
+			return fmt.Errorf("none of db, schema and searchPath has a %s placeholder", TenantPlaceholder)
+		}
+	default:
+		if !has(cfg.DB) {
+			return fmt.Errorf("db has no %s placeholder", TenantPlaceholder)
+		}
+	}
+	// The replicas of sqlite are database files, the others replace the host and use the database of the tenant
+	if cfg.Type == config.Sqlite3 || cfg.Type == "" {
+		for _, replica := range cfg.Replicas {
+			if !has(replica) {
+				return fmt.Errorf("replica %s has no %s placeholder", replica, TenantPlaceholder)
+			}
+		}
+	}
+	return nil
+}
+
+// Tenant returns the storage of the tenant of ctx, e.g. to migrate the database of a tenant.
+// Databases are opened outside the lock, so a slow or unreachable database does not block the other tenants,
+// and a failed open is tried again by the next call.
+func (d *TenantDatabases) Tenant(ctx context.Context) (Storage, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	if s, ok := d.storage(tenant); ok {
+		return s, nil
+	}
+
+	// The database is opened on behalf of every waiting caller, so it is not canceled with the first one
+	ch := d.group.DoChan(tenant, func() (any, error) {
+		if s, ok := d.storage(tenant); ok {
+			return s, nil
+		}
+		s, err := d.open(context.WithoutCancel(ctx), tenant)
+		if err != nil {
+			return nil, err
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.storages[tenant] = s
+		return s, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, fmt.Errorf("failed to open the database of tenant %s: %w", tenant, r.Err)
+		}
+		return r.Val.(Storage), nil
+	}
+}
+
+// storage returns the opened storage of tenant
+func (d *TenantDatabases) storage(tenant string) (Storage, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, ok := d.storages[tenant]
+	return s, ok
+}
+
+// Client implements Storage.Client, it returns nil, the client of a tenant is returned by the storage of Tenant
+func (d *TenantDatabases) Client() any {
+	return nil
+}
+
+// Ping implements Storage.Ping, it pings the opened databases
+func (d *TenantDatabases) Ping(ctx context.Context) error {
+	d.mu.Lock()
+	storages := maps.Clone(d.storages)
+	d.mu.Unlock()
+	for tenant, s := range storages {
+		if err := s.Ping(ctx); err != nil {
+			return fmt.Errorf("database of tenant %s: %w", tenant, err)
+		}
+	}
+	return nil
+}
+
+// Close implements Storage.Close, it closes the opened databases
+func (d *TenantDatabases) Close() error {
+	d.mu.Lock()
+	storages := d.storages
+	d.storages = make(map[string]Storage)
+	d.mu.Unlock()
+
+	var errs []error
+	for tenant, s := range storages {
+		if err := s.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close the database of tenant %s: %w", tenant, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Transaction implements Storage.Transaction
+func (d *TenantDatabases) Transaction(ctx context.Context, fn func(tx Storage) error, opts ...TxOption) error {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Transaction(ctx, fn, opts...)
+}
+
+// Create implements Storage.Create
+func (d *TenantDatabases) Create(ctx context.Context, model any) error {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Create(ctx, model)
+}
+
+// CreateBatch implements Storage.CreateBatch
+func (d *TenantDatabases) CreateBatch(ctx context.Context, models any, batchSize int, opts ...BatchOption) error {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return s.CreateBatch(ctx, models, batchSize, opts...)
+}
+
+// Upsert implements Storage.Upsert
+func (d *TenantDatabases) Upsert(ctx context.Context, models any, conflictColumns, updateColumns []string, opts ...BatchOption) error {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Upsert(ctx, models, conflictColumns, updateColumns, opts...)
+}
+
+// Get implements Storage.Get
+func (d *TenantDatabases) Get(ctx context.Context, id uint64, result any) error {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Get(ctx, id, result)
+}
+
+// GetBy implements Storage.GetBy
+func (d *TenantDatabases) GetBy(ctx context.Context, filter map[string]any, result any) error {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return s.GetBy(ctx, filter, result)
+}
+
+// Update implements Storage.Update
+func (d *TenantDatabases) Update(ctx context.Context, id uint64, data any) error {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Update(ctx, id, data)
+}
+
+// UpdateBy implements Storage.UpdateBy
+func (d *TenantDatabases) UpdateBy(ctx context.Context, filter map[string]any, data any) (int64, error) {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return s.UpdateBy(ctx, filter, data)
+}
+
+// UpdateWhere implements Storage.UpdateWhere
+func (d *TenantDatabases) UpdateWhere(ctx context.Context, query *Query, model any, values map[string]any, opts ...BatchOption) (int64, error) {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return s.UpdateWhere(ctx, query, model, values, opts...)
+}
+
+// Patch implements Storage.Patch
+func (d *TenantDatabases) Patch(ctx context.Context, id uint64, model any, changes map[string]any) error {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Patch(ctx, id, model, changes)
+}
+
+// PatchFields implements Storage.PatchFields
+func (d *TenantDatabases) PatchFields(ctx context.Context, id uint64, model any, fields ...string) error {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return s.PatchFields(ctx, id, model, fields...)
+}
+
+// Delete implements Storage.Delete
+func (d *TenantDatabases) Delete(ctx context.Context, id uint64, model any) error {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Delete(ctx, id, model)
+}
+
+// DeleteBy implements Storage.DeleteBy
+func (d *TenantDatabases) DeleteBy(ctx context.Context, filter map[string]any, model any) error {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return s.DeleteBy(ctx, filter, model)
+}
+
+// Restore implements Storage.Restore
+func (d *TenantDatabases) Restore(ctx context.Context, id uint64, model any) error {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Restore(ctx, id, model)
+}
+
+// Purge implements Storage.Purge
+func (d *TenantDatabases) Purge(ctx context.Context, id uint64, model any) error {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return s.Purge(ctx, id, model)
+}
+
+// List implements Storage.List
+func (d *TenantDatabases) List(ctx context.Context, query *Query, mainModel, assModel any) (int64, error) {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return s.List(ctx, query, mainModel, assModel)
+}
+
+// ListDeleted implements Storage.ListDeleted
+func (d *TenantDatabases) ListDeleted(ctx context.Context, query *Query, result any) (int64, error) {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return s.ListDeleted(ctx, query, result)
+}
+
+// Count implements Storage.Count
+func (d *TenantDatabases) Count(ctx context.Context, query *Query, model any) (int64, error) {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return s.Count(ctx, query, model)
+}
+
+// ListCursor implements Storage.ListCursor
+func (d *TenantDatabases) ListCursor(ctx context.Context, query *Query, result any) (*CursorPage, error) {
+	s, err := d.Tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.ListCursor(ctx, query, result)
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fize/go-ext/config"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestTenantDatabases(t *testing.T) {
+	cfg, err := config.NewSQLConfig(config.WithDB(filepath.Join(t.TempDir(), TenantPlaceholder+".db")))
+	assert.NoError(t, err)
+	dbs := NewTenantDatabases(TenantDatabase(cfg))
+	defer dbs.Close()
+
+	a := ContextWithTenant(context.Background(), "a")
+	b := ContextWithTenant(context.Background(), "b")
+	for _, ctx := range []context.Context{a, b} {
+		s, err := dbs.Tenant(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, s.Client().(*gorm.DB).AutoMigrate(&TestModel{}))
+	}
+	assert.FileExists(t, filepath.Join(filepath.Dir(cfg.DB), "a.db"))
+
+	assert.NoError(t, dbs.Create(a, &TestModel{ID: 1, Name: "alice"}))
+	assert.NoError(t, dbs.Create(b, &TestModel{ID: 1, Name: "bob"}))
+	assert.NoError(t, dbs.Ping(context.Background()))
+
+	// Cached reads are kept apart by tenant
+	cached := NewCachedStorage(dbs)
+	var model TestModel
+	assert.NoError(t, cached.Get(a, 1, &model))
+	assert.Equal(t, "alice", model.Name)
+	assert.NoError(t, cached.Get(b, 1, &model))
+	assert.Equal(t, "bob", model.Name)
+
+	err = dbs.Transaction(a, func(tx Storage) error {
+		return tx.Create(a, &TestModel{ID: 2, Name: "carol"})
+	})
+	assert.NoError(t, err)
+	count, err := dbs.Count(b, &Query{}, &TestModel{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	assert.ErrorIs(t, dbs.Get(context.Background(), 1, &model), ErrNoTenant)
+	_, err = dbs.Tenant(ContextWithTenant(context.Background(), "../etc"))
+	assert.EqualError(t, err, `failed to open the database of tenant ../etc: invalid tenant "../etc"`)
+}
+
+func TestTenantDatabasePlaceholder(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// The placeholder of dsn and replicas is replaced
+	cfg, err := config.NewSQLConfig(config.WithDSN(filepath.Join(dir, TenantPlaceholder+".db")))
+	assert.NoError(t, err)
+	s, err := TenantDatabase(cfg)(ctx, "a")
+	assert.NoError(t, err)
+	assert.NoError(t, s.Close())
+	assert.FileExists(t, filepath.Join(dir, "a.db"))
+
+	tests := []struct {
+		name    string
+		opts    []config.SQLConfigOption
+		wantErr string
+	}{
+		{"dsn", []config.SQLConfigOption{config.WithDSN(filepath.Join(dir, "shared.db"))}, "dsn has no {tenant} placeholder"},
+		{"db", []config.SQLConfigOption{config.WithDB(filepath.Join(dir, "shared.db"))}, "db has no {tenant} placeholder"},
+		{
+			"replica",
+			[]config.SQLConfigOption{config.WithDB(filepath.Join(dir, "{tenant}.db")), config.WithReplicas(filepath.Join(dir, "replica.db"))},
+			"replica " + filepath.Join(dir, "replica.db") + " has no {tenant} placeholder",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.NewSQLConfig(tt.opts...)
+			assert.NoError(t, err)
+			_, err = TenantDatabase(cfg)(ctx, "a")
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestTenantDatabasesOpen(t *testing.T) {
+	release := make(chan struct{})
+	var failed atomic.Bool
+	dbs := NewTenantDatabases(func(ctx context.Context, tenant string) (Storage, error) {
+		switch tenant {
+		case "slow":
+			<-release
+		case "flaky":
+			if !failed.Swap(true) {
+				return nil, errors.New("connection refused")
+			}
+		}
+		return &sqlStorage{db: setupSqliteDB(t)}, nil
+	})
+
+	// A database being opened does not block the other tenants
+	done := make(chan error)
+	go func() {
+		_, err := dbs.Tenant(ContextWithTenant(context.Background(), "slow"))
+		done <- err
+	}()
+	_, err := dbs.Tenant(ContextWithTenant(context.Background(), "a"))
+	assert.NoError(t, err)
+	assert.NoError(t, dbs.Ping(context.Background()))
+	close(release)
+	assert.NoError(t, <-done)
+
+	// A failed open is not cached
+	flaky := ContextWithTenant(context.Background(), "flaky")
+	_, err = dbs.Tenant(flaky)
+	assert.EqualError(t, err, "failed to open the database of tenant flaky: connection refused")
+	_, err = dbs.Tenant(flaky)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// txKey is the context key of the transaction carried by a context
+type txKey struct{}
+
+// TxOption configures a transaction
+type TxOption func(*sql.TxOptions)
+
+// WithIsolation sets the isolation level of the transaction, e.g. sql.LevelSerializable.
+// It applies to the outermost transaction only, nested transactions are savepoints.
+func WithIsolation(level sql.IsolationLevel) TxOption {
+	return func(o *sql.TxOptions) {
+		o.Isolation = level
+	}
+}
+
+// WithReadOnly makes the transaction read-only
+func WithReadOnly() TxOption {
+	return func(o *sql.TxOptions) {
+		o.ReadOnly = true
+	}
+}
+
+// ContextWithTx returns a context carrying tx, the storage passed to a Transaction function.
+// Calls of any Storage with this context join the transaction, e.g. store.Create(ctx, model)
+// in code that does not know about the transaction.
+func ContextWithTx(ctx context.Context, tx Storage) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// TxFromContext returns the transaction carried by ctx
+func TxFromContext(ctx context.Context) (Storage, bool) {
+	tx, ok := ctx.Value(txKey{}).(Storage)
+	return tx, ok
+}
+
+// txOptions builds the options of a transaction, nil keeps the driver defaults
+func txOptions(opts []TxOption) *sql.TxOptions {
+	if len(opts) == 0 {
+		return nil
+	}
+	o := &sql.TxOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// conn returns the connection of a call with ctx: the transaction carried by ctx
+// if it was started from s, otherwise the database or transaction of s.
+// The statements get the tenant condition of ctx, see TenantStorage.
+func (s *sqlStorage) conn(ctx context.Context) *gorm.DB {
+	if tx, ok := s.txOf(ctx); ok {
+		return withTenantCondition(ctx, tx.db.WithContext(ctx))
+	}
+	return withTenantCondition(ctx, s.db.WithContext(ctx))
+}
+
+// txOf returns the transaction carried by ctx if it was started from s
+func (s *sqlStorage) txOf(ctx context.Context) (*sqlStorage, bool) {
+	if s.root != nil {
+		return nil, false
+	}
+	tx, ok := TxFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	// Decorators such as CachedStorage wrap the transaction
+	for {
+		u, ok := tx.(interface{ Unwrap() Storage })
+		if !ok {
+			break
+		}
+		tx = u.Unwrap()
+	}
+	ts, ok := tx.(*sqlStorage)
+	return ts, ok && ts.root == s
+}
+
+// Transaction implements Storage.Transaction.
+// Calling Transaction inside a transaction, on tx or with a context carrying it,
+// creates a savepoint that is rolled back alone when fn fails.
+func (s *sqlStorage) Transaction(ctx context.Context, fn func(tx Storage) error, opts ...TxOption) error {
+	err := s.conn(ctx).Transaction(func(db *gorm.DB) error {
+		root := s
+		if s.root != nil {
+			root = s.root
+		}
+		return fn(&sqlStorage{db: db, name: s.name, root: root, cursorKey: s.cursorKey})
+	}, txOptions(opts))
+	return translateError(err)
+}
+
+// errCloseTx is returned when closing the storage of a transaction
+var errCloseTx = errors.New("cannot close a transaction, return from the transaction function instead")
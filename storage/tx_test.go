@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// names returns the names of the test models in s
+func names(t *testing.T, s Storage) []string {
+	t.Helper()
+	var models []TestModel
+	_, err := s.List(context.Background(), &Query{Sort: []Sort{Asc("name")}}, &models, nil)
+	assert.NoError(t, err)
+	var result []string
+	for _, m := range models {
+		result = append(result, m.Name)
+	}
+	return result
+}
+
+func TestTransaction(t *testing.T) {
+	errAbort := errors.New("abort")
+
+	tests := []struct {
+		name    string
+		fn      func(ctx context.Context, store, tx Storage) error
+		wantErr error
+		want    []string
+	}{
+		{
+			name: "commit",
+			fn: func(ctx context.Context, _, tx Storage) error {
+				if err := tx.Create(ctx, &TestModel{Name: "a"}); err != nil {
+					return err
+				}
+				return tx.Create(ctx, &TestModel{Name: "b"})
+			},
+			want: []string{"a", "b"},
+		},
+		{
+			name: "rollback",
+			fn: func(ctx context.Context, _, tx Storage) error {
+				if err := tx.Create(ctx, &TestModel{Name: "a"}); err != nil {
+					return err
+				}
+				return errAbort
+			},
+			wantErr: errAbort,
+		},
+		{
+			name: "nested savepoint",
+			fn: func(ctx context.Context, _, tx Storage) error {
+				if err := tx.Create(ctx, &TestModel{Name: "a"}); err != nil {
+					return err
+				}
+				err := tx.Transaction(ctx, func(inner Storage) error {
+					if err := inner.Create(ctx, &TestModel{Name: "b"}); err != nil {
+						return err
+					}
+					return errAbort
+				})
+				if !errors.Is(err, errAbort) {
+					return err
+				}
+				return tx.Create(ctx, &TestModel{Name: "c"})
+			},
+			want: []string{"a", "c"},
+		},
+		{
+			name: "context joins the transaction",
+			fn: func(ctx context.Context, store, tx Storage) error {
+				ctx = ContextWithTx(ctx, tx)
+				if err := store.Create(ctx, &TestModel{Name: "a"}); err != nil {
+					return err
+				}
+				// a nested transaction started from the context is a savepoint
+				if err := store.Transaction(ctx, func(inner Storage) error {
+					return inner.Create(ctx, &TestModel{Name: "b"})
+				}); err != nil {
+					return err
+				}
+				return errAbort
+			},
+			wantErr: errAbort,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &sqlStorage{db: setupSqliteDB(t)}
+			ctx := context.Background()
+
+			err := store.Transaction(ctx, func(tx Storage) error {
+				return tt.fn(ctx, store, tx)
+			})
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, names(t, store))
+		})
+	}
+}
+
+func TestTransactionOtherStorage(t *testing.T) {
+	store := &sqlStorage{db: setupSqliteDB(t)}
+	other := &sqlStorage{db: setupSqliteDB(t)}
+	ctx := context.Background()
+
+	err := store.Transaction(ctx, func(tx Storage) error {
+		// a transaction of another database is not joined
+		return other.Create(ContextWithTx(ctx, tx), &TestModel{Name: "other"})
+	}, WithReadOnly())
+	assert.NoError(t, err)
+	assert.Nil(t, names(t, store))
+	assert.Equal(t, []string{"other"}, names(t, other))
+}
+
+func TestTransactionClose(t *testing.T) {
+	store := &sqlStorage{db: setupSqliteDB(t)}
+	err := store.Transaction(context.Background(), func(tx Storage) error {
+		return tx.Close()
+	})
+	assert.ErrorIs(t, err, errCloseTx)
+}
+
+func TestTxOptions(t *testing.T) {
+	assert.Nil(t, txOptions(nil))
+	assert.Equal(t, &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true},
+		txOptions([]TxOption{WithIsolation(sql.LevelSerializable), WithReadOnly()}))
+}